@@ -2,6 +2,9 @@ package commands
 
 import (
 	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -10,7 +13,9 @@ import (
 
 var (
 	apiClient *http.Client
-	baseUrl   string
+	// Used for long lived requests like following logs, it has no timeout
+	streamClient *http.Client
+	baseUrl      string
 )
 
 func init() {
@@ -29,9 +34,35 @@ func init() {
 			},
 		},
 	}
+	streamClient = &http.Client{
+		Transport: apiClient.Transport,
+	}
 	// viper é uma biblioteca de configuração que permite ler e escrever configurações de forma fácil.
 	// SetDefault é usado para definir um valor padrão para uma chave de configuração.
 	viper.SetDefault("api.url", "http://localhost:8080") // Define a URL base do servidor API
 	//GetString é usado para obter o valor de uma chave de configuração como uma string.
 	baseUrl = viper.GetString("api.url") // URL base do servidor API
 }
+
+// Gets path from the api and decodes the JSON response into v
+func getJSON(path string, v interface{}) error {
+	resp, err := apiClient.Get(baseUrl + path)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/siluk00/task_scheduler/internal/domain"
@@ -22,6 +23,26 @@ func NewCreateCommand() *cobra.Command {
 		status      string
 		scheduledAt string
 		file        string
+		secretNames []string
+		exitCodes   []int
+		required    []string
+		forbidden   []string
+		jsonResult  bool
+		limits      domain.ResourceLimits
+		labels      map[string]string
+		queue       string
+		sla         int
+		onSuccess   []string
+		onFailure   []string
+		passOutput  bool
+		steps       []string
+		matrix      []string
+		maxParallel int
+		threshold   int
+		locks       []string
+		concurrency string
+		schedule    string
+		timezone    string
 	)
 
 	cmd := &cobra.Command{
@@ -47,6 +68,42 @@ func NewCreateCommand() *cobra.Command {
 					Description: description,
 					Command:     command,
 					Status:      domain.TaskStatus(status),
+					Secrets:     secretNames,
+					Labels:      labels,
+					Queue:       queue,
+					SLASeconds:  sla,
+					OnSuccess:   onSuccess,
+					OnFailure:   onFailure,
+					PassOutput:  passOutput,
+					Locks:       locks,
+					Schedule:    schedule,
+					Timezone:    timezone,
+				}
+				task.ConcurrencyPolicy = domain.ConcurrencyPolicy(concurrency)
+				for _, step := range steps {
+					task.Steps = append(task.Steps, domain.Step{Command: step})
+				}
+
+				if len(matrix) > 0 {
+					params, err := parseMatrixParams(matrix)
+					if err != nil {
+						fmt.Printf("Invalid matrix: %v\n", err)
+						return
+					}
+					task.Matrix = &domain.Matrix{Params: params, MaxParallel: maxParallel, FailureThreshold: threshold}
+				}
+
+				if len(exitCodes) > 0 || len(required) > 0 || len(forbidden) > 0 || jsonResult {
+					task.Success = &domain.SuccessCriteria{
+						AcceptedExitCodes: exitCodes,
+						RequiredOutput:    required,
+						ForbiddenOutput:   forbidden,
+						JSONResult:        jsonResult,
+					}
+				}
+
+				if !limits.IsZero() {
+					task.Limits = &limits
 				}
 
 				if scheduledAt != "" {
@@ -82,14 +139,39 @@ func NewCreateCommand() *cobra.Command {
 	cmd.Flags().StringVarP(&name, "name", "n", "", "Task name")
 	cmd.Flags().StringVarP(&description, "description", "d", "", "Task description")
 	cmd.Flags().StringVarP(&command, "command", "c", "", "Command to execute")
+	cmd.Flags().StringArrayVar(&steps, "step", nil, "Command of a step, run in order instead of --command (repeatable, use --file for timeouts)")
+	cmd.Flags().StringArrayVar(&matrix, "matrix", nil, "Parameter set key=value,key=value of a child task running the command (repeatable)")
+	cmd.Flags().IntVar(&maxParallel, "max-parallel", 0, "Matrix children running at once (all if 0)")
+	cmd.Flags().IntVar(&threshold, "failure-threshold", 0, "Failed matrix children tolerated before the run fails")
 	cmd.Flags().StringVarP(&status, "status", "s", "pending", "Task status (pending, running, completed, failed)")
 	cmd.Flags().StringVarP(&scheduledAt, "scheduled-at", "t", "", "Scheduled time in RFC3339 format")
+	cmd.Flags().StringVar(&schedule, "schedule", "", "Cron expression the task runs again on, e.g. \"0 2 * * *\" or @daily")
+	cmd.Flags().StringVar(&timezone, "timezone", "", "IANA timezone of the schedule, e.g. America/Sao_Paulo (UTC if empty)")
 	cmd.Flags().StringVarP(&file, "file", "f", "", "Path to JSON file containing task data")
+	cmd.Flags().StringSliceVar(&secretNames, "secret", nil, "Secret injected as an environment variable (repeatable)")
+	cmd.Flags().IntSliceVar(&exitCodes, "accept-exit-codes", nil, "Exit codes considered successful (default 0)")
+	cmd.Flags().StringArrayVar(&required, "require-output", nil, "Regex that must match the output (repeatable)")
+	cmd.Flags().StringArrayVar(&forbidden, "forbid-output", nil, "Regex that must not match the output (repeatable)")
+	cmd.Flags().BoolVar(&jsonResult, "json-result", false, "Parse the last stdout line as the JSON result of the run")
+	cmd.Flags().StringToStringVarP(&labels, "label", "l", nil, "Labels as key=value (repeatable)")
+	cmd.Flags().StringSliceVar(&locks, "lock", nil, "Named resource locked while the task runs, e.g. db-main (repeatable)")
+	cmd.Flags().StringVar(&concurrency, "concurrency-policy", "", "Run coming while another run of the task is running (allow, forbid, replace, queue)")
+	cmd.Flags().StringVarP(&queue, "queue", "q", "", "Task queue consumed by the workers that run the task (default queue if empty)")
+	cmd.Flags().IntVar(&sla, "sla", 0, "Seconds a run is expected to take at most, longer runs are notified as run.sla_missed")
+	cmd.Flags().StringSliceVar(&onSuccess, "on-success", nil, "Tasks triggered when a run succeeds")
+	cmd.Flags().StringSliceVar(&onFailure, "on-failure", nil, "Tasks triggered when a run fails")
+	cmd.Flags().BoolVar(&passOutput, "pass-output", false, "Pass the result and the end of the stdout of the run to the triggered tasks")
+	cmd.Flags().Uint64Var(&limits.CPUTimeSeconds, "limit-cpu", 0, "CPU time limit in seconds")
+	cmd.Flags().Uint64Var(&limits.AddressSpaceBytes, "limit-memory", 0, "Address space limit in bytes")
+	cmd.Flags().Uint64Var(&limits.OpenFiles, "limit-files", 0, "Open files limit")
+	cmd.Flags().Uint64Var(&limits.Processes, "limit-processes", 0, "Processes limit")
+	cmd.Flags().Uint64Var(&limits.FileSizeBytes, "limit-file-size", 0, "Largest file the task can write in bytes")
 
 	//self-documented
 	cmd.MarkFlagRequired("id")
 	cmd.MarkFlagRequired("name")
-	cmd.MarkFlagRequired("command")
+	cmd.MarkFlagsOneRequired("command", "step")
+	cmd.MarkFlagsMutuallyExclusive("command", "step")
 
 	return cmd
 }
@@ -115,6 +197,23 @@ func createTask(task domain.Task) error {
 	return nil
 }
 
+// Parses the --matrix flags, each one a parameter set like customer=acme,region=eu
+func parseMatrixParams(values []string) ([]map[string]string, error) {
+	sets := make([]map[string]string, 0, len(values))
+	for _, value := range values {
+		params := make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			name, v, ok := strings.Cut(pair, "=")
+			if !ok || name == "" {
+				return nil, fmt.Errorf("%q is not a key=value pair", pair)
+			}
+			params[name] = v
+		}
+		sets = append(sets, params)
+	}
+	return sets, nil
+}
+
 func loadTaskFromFile(filePath string) (domain.Task, error) {
 	var task domain.Task
 
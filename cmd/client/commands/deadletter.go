@@ -0,0 +1,199 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+// Groups the subcommands that inspect, replay and purge the dead lettered messages
+func NewDeadLetterCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "dlq",
+		Aliases: []string{"deadletter"},
+		Short:   "Manage the task messages that could not be processed",
+	}
+
+	cmd.AddCommand(newDeadLetterListCommand())
+	cmd.AddCommand(newDeadLetterGetCommand())
+	cmd.AddCommand(newDeadLetterReplayCommand())
+	cmd.AddCommand(newDeadLetterDeleteCommand())
+	cmd.AddCommand(newDeadLetterPurgeCommand())
+
+	return cmd
+}
+
+func newDeadLetterListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the dead letters",
+		Run: func(cmd *cobra.Command, args []string) {
+			var letters []domain.DeadLetter
+			if err := getJSON("/deadletters/", &letters); err != nil {
+				fmt.Printf("Error listing dead letters: %v\n", err)
+				return
+			}
+
+			if len(letters) == 0 {
+				fmt.Println("No dead letters found")
+				return
+			}
+
+			fmt.Printf("%-25s %-20s %-13s %8s  %s\n", "ID", "TASK", "REASON", "ATTEMPTS", "DEAD LETTERED AT")
+			for _, letter := range letters {
+				fmt.Printf("%-25s %-20s %-13s %8d  %s\n", letter.ID, letter.TaskID, letter.Reason,
+					letter.Attempts, letter.DeadLetteredAt.Format("2006-01-02 15:04:05"))
+			}
+		},
+	}
+
+	return cmd
+}
+
+func newDeadLetterGetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get <id>",
+		Short: "Show a dead letter with its message",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var letter domain.DeadLetter
+			if err := getJSON("/deadletters/"+args[0], &letter); err != nil {
+				fmt.Printf("Error getting dead letter: %v\n", err)
+				return
+			}
+
+			fmt.Println("Dead Letter Details:")
+			fmt.Printf("ID:              %s\n", letter.ID)
+			fmt.Printf("Task:            %s\n", letter.TaskID)
+			fmt.Printf("Queue:           %s\n", letter.Queue)
+			fmt.Printf("Reason:          %s\n", letter.Reason)
+			fmt.Printf("Error:           %s\n", letter.Error)
+			fmt.Printf("Attempts:        %d\n", letter.Attempts)
+			fmt.Printf("Dead lettered:   %s\n", letter.DeadLetteredAt.Format("2006-01-02 15:04:05"))
+
+			if len(letter.Headers) > 0 {
+				fmt.Println("Headers:")
+				keys := make([]string, 0, len(letter.Headers))
+				for k := range letter.Headers {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					fmt.Printf("  %s: %s\n", k, letter.Headers[k])
+				}
+			}
+
+			fmt.Println("Body:")
+			fmt.Println(letter.Body)
+		},
+	}
+
+	return cmd
+}
+
+func newDeadLetterReplayCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay <id>",
+		Short: "Publish a dead letter in the task queue again",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			resp, err := apiClient.Post(baseUrl+"/deadletters/"+args[0]+"/replay", "application/json", nil)
+			if err != nil {
+				fmt.Printf("Error making request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				body, _ := io.ReadAll(resp.Body)
+				fmt.Printf("Error replaying dead letter: %s\n", string(body))
+				return
+			}
+
+			fmt.Println("Dead letter replayed successfully")
+		},
+	}
+
+	return cmd
+}
+
+func newDeadLetterDeleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a dead letter without replaying it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req, err := http.NewRequest(http.MethodDelete, baseUrl+"/deadletters/"+args[0], nil)
+			if err != nil {
+				fmt.Printf("Error creating request: %v\n", err)
+				return
+			}
+
+			resp, err := apiClient.Do(req)
+			if err != nil {
+				fmt.Printf("Error making request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusNoContent {
+				body, _ := io.ReadAll(resp.Body)
+				fmt.Printf("Error deleting dead letter: %s\n", string(body))
+				return
+			}
+
+			fmt.Println("Dead letter deleted successfully")
+		},
+	}
+
+	return cmd
+}
+
+func newDeadLetterPurgeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Delete every dead letter",
+		Run: func(cmd *cobra.Command, args []string) {
+			req, err := http.NewRequest(http.MethodDelete, baseUrl+"/deadletters/", nil)
+			if err != nil {
+				fmt.Printf("Error creating request: %v\n", err)
+				return
+			}
+
+			resp, err := apiClient.Do(req)
+			if err != nil {
+				fmt.Printf("Error making request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				fmt.Printf("Error reading response: %v\n", err)
+				return
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				fmt.Printf("Error purging dead letters: %s\n", string(body))
+				return
+			}
+
+			var result struct {
+				Purged int `json:"purged"`
+			}
+			if err := json.Unmarshal(body, &result); err != nil {
+				fmt.Printf("Error decoding response: %v\n", err)
+				return
+			}
+
+			fmt.Printf("%d dead letters purged\n", result.Purged)
+		},
+	}
+
+	return cmd
+}
@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 
+	"github.com/siluk00/task_scheduler/internal/domain"
 	"github.com/spf13/cobra"
 )
 
@@ -48,6 +51,8 @@ func NewGetCommand() *cobra.Command {
 					return
 				}
 				printTaskPretty(task)
+				printTaskSteps(taskID, body)
+				printTaskMatrix(taskID, body)
 			}
 		},
 	}
@@ -63,6 +68,21 @@ func printTaskPretty(task map[string]interface{}) {
 	fmt.Printf("Description:\t %s\n", task["description"])
 	fmt.Printf("Command:\t %s\n", task["command"])
 	fmt.Printf("Status:\t\t %s\n", task["status"])
+	if secrets, ok := task["secrets"].([]interface{}); ok && len(secrets) > 0 {
+		fmt.Printf("Secrets:\t %v\n", secrets)
+	}
+	if locks, ok := task["locks"].([]interface{}); ok && len(locks) > 0 {
+		fmt.Printf("Locks:\t\t %v\n", locks)
+	}
+	if policy, ok := task["concurrency_policy"].(string); ok && policy != "" {
+		fmt.Printf("Concurrency:\t %s\n", policy)
+	}
+	if schedule, ok := task["schedule"].(string); ok && schedule != "" {
+		fmt.Printf("Schedule:\t %s\n", schedule)
+	}
+	if timezone, ok := task["timezone"].(string); ok && timezone != "" {
+		fmt.Printf("Timezone:\t %s\n", timezone)
+	}
 	fmt.Printf("Created At:\t %s\n", task["created_at"])
 	fmt.Printf("Updated At:\t %s\n", task["updated_at"])
 	if scheduledAt, ok := task["scheduled_at"]; ok {
@@ -71,3 +91,114 @@ func printTaskPretty(task map[string]interface{}) {
 		fmt.Println("Scheduled At:\t Not Scheduled")
 	}
 }
+
+// Prints the steps of a multi-step task and their result in its latest run
+func printTaskSteps(taskID string, body []byte) {
+	var task domain.Task
+	if err := json.Unmarshal(body, &task); err != nil || len(task.Steps) == 0 {
+		return
+	}
+
+	var runs []domain.TaskRun
+	if err := getJSON("/tasks/"+taskID+"/runs", &runs); err != nil {
+		fmt.Printf("Error getting the runs: %v\n", err)
+	}
+
+	results := make(map[string]domain.StepResult)
+	if len(runs) > 0 {
+		fmt.Printf("Latest Run:\t %s (%s)\n", runs[0].ID, runs[0].Status)
+		for _, result := range runs[0].Steps {
+			results[result.Name] = result
+		}
+	}
+
+	fmt.Println("Steps:")
+	for i, step := range task.Steps {
+		name := step.DisplayName(i)
+		fmt.Printf("  %d. %-20s %s\n", i+1, name, step.Command)
+
+		result, ok := results[name]
+		if !ok {
+			continue
+		}
+		fmt.Printf("     %-20s exit code %d", result.Status, result.ExitCode)
+		if result.Error != "" {
+			fmt.Printf(", %s", result.Error)
+		}
+		fmt.Println()
+		if result.Output != nil {
+			printStepOutput(result.Output.Stdout)
+			printStepOutput(result.Output.Stderr)
+		}
+	}
+}
+
+// Prints the children of a matrix task with their parameters and status, and the
+// progress of its latest run
+func printTaskMatrix(taskID string, body []byte) {
+	var task domain.Task
+	if err := json.Unmarshal(body, &task); err != nil || task.Matrix == nil {
+		return
+	}
+
+	fmt.Printf("Matrix:\t\t %d parameter sets, %d at once, %d failures tolerated\n",
+		len(task.Matrix.Params), task.Matrix.Parallelism(), task.Matrix.FailureThreshold)
+
+	var runs []domain.TaskRun
+	if err := getJSON("/tasks/"+taskID+"/runs", &runs); err != nil {
+		fmt.Printf("Error getting the runs: %v\n", err)
+	}
+	if len(runs) > 0 && runs[0].Matrix != nil {
+		group := runs[0].Matrix
+		fmt.Printf("Latest Run:\t %s (%s)", runs[0].ID, runs[0].Status)
+		if runs[0].Status.IsFinished() {
+			fmt.Printf(": %d completed, %d failed, %d skipped", group.Completed, group.Failed, group.Skipped)
+		}
+		fmt.Println()
+	}
+
+	var tasks []domain.Task
+	if err := getJSON("/tasks", &tasks); err != nil {
+		fmt.Printf("Error getting the children: %v\n", err)
+		return
+	}
+	statuses := make(map[string]domain.TaskStatus)
+	for _, t := range tasks {
+		if t.Parent == taskID {
+			statuses[t.ID] = t.Status
+		}
+	}
+
+	fmt.Println("Children:")
+	for i, params := range task.Matrix.Params {
+		id := domain.MatrixChildID(taskID, i)
+		status, ok := statuses[id]
+		if !ok {
+			status = "-"
+		}
+
+		names := make([]string, 0, len(params))
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		pairs := make([]string, len(names))
+		for j, name := range names {
+			pairs[j] = name + "=" + params[name]
+		}
+		fmt.Printf("  %-24s %-10s %s\n", id, status, strings.Join(pairs, ","))
+	}
+}
+
+// Prints the last lines of the output of a step, indented under it
+func printStepOutput(output string) {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) > 5 {
+		lines = lines[len(lines)-5:]
+	}
+	for _, line := range lines {
+		if line != "" {
+			fmt.Printf("     | %s\n", line)
+		}
+	}
+}
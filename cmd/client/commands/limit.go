@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+// Groups the subcommands that manage the rate limits of the tasks
+func NewLimitCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "limit",
+		Short: "Manage the rate limits of the tasks of a queue or with a label",
+	}
+
+	cmd.AddCommand(newLimitSetCommand())
+	cmd.AddCommand(newLimitListCommand())
+	cmd.AddCommand(newLimitDeleteCommand())
+
+	return cmd
+}
+
+func newLimitSetCommand() *cobra.Command {
+	var limit domain.RateLimit
+
+	cmd := &cobra.Command{
+		Use:   "set <name>",
+		Short: "Create or replace a rate limit, enforced by every worker",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := setRateLimit(args[0], &limit); err != nil {
+				fmt.Printf("Error setting rate limit: %v\n", err)
+				return
+			}
+
+			fmt.Println("Rate limit stored successfully")
+		},
+	}
+
+	cmd.Flags().StringVarP(&limit.Queue, "queue", "q", "", "Queue whose tasks are limited")
+	cmd.Flags().StringVarP(&limit.Label, "label", "l", "", "Label of the limited tasks as key=value, e.g. team=reports")
+	cmd.Flags().IntVar(&limit.MaxConcurrent, "max-concurrent", 0, "Runs at once (no cap if 0)")
+	cmd.Flags().IntVar(&limit.StartsPerMinute, "starts-per-minute", 0, "Runs started per minute (no limit if 0)")
+	cmd.MarkFlagsOneRequired("queue", "label")
+	cmd.MarkFlagsMutuallyExclusive("queue", "label")
+	cmd.MarkFlagsOneRequired("max-concurrent", "starts-per-minute")
+
+	return cmd
+}
+
+func newLimitListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the rate limits",
+		Run: func(cmd *cobra.Command, args []string) {
+			var limits []domain.RateLimit
+			if err := getJSON("/limits/", &limits); err != nil {
+				fmt.Printf("Error listing rate limits: %v\n", err)
+				return
+			}
+
+			if len(limits) == 0 {
+				fmt.Println("No rate limits found")
+				return
+			}
+
+			fmt.Printf("%-20s %-30s %-15s %s\n", "NAME", "TASKS", "MAX CONCURRENT", "STARTS PER MINUTE")
+			for _, limit := range limits {
+				tasks := "queue " + limit.Queue
+				if limit.Label != "" {
+					tasks = "label " + limit.Label
+				}
+				fmt.Printf("%-20s %-30s %-15s %s\n", limit.Name, tasks,
+					limitValue(limit.MaxConcurrent), limitValue(limit.StartsPerMinute))
+			}
+		},
+	}
+
+	return cmd
+}
+
+func newLimitDeleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a rate limit",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req, err := http.NewRequest(http.MethodDelete, baseUrl+"/limits/"+args[0], nil)
+			if err != nil {
+				fmt.Printf("Error creating request: %v\n", err)
+				return
+			}
+
+			resp, err := apiClient.Do(req)
+			if err != nil {
+				fmt.Printf("Error making request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusNoContent {
+				body, _ := io.ReadAll(resp.Body)
+				fmt.Printf("Error deleting rate limit: %s\n", string(body))
+				return
+			}
+
+			fmt.Println("Rate limit deleted successfully")
+		},
+	}
+
+	return cmd
+}
+
+func setRateLimit(name string, limit *domain.RateLimit) error {
+	body, err := json.Marshal(limit)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rate limit: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, baseUrl+"/limits/"+name, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// The value of a cap of the limit, "-" when it has none
+func limitValue(n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func NewLogsCommand() *cobra.Command {
+	var (
+		runID  string
+		follow bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs <task-id>",
+		Short: "Show the output of a task run, the latest run by default",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			taskID := args[0]
+
+			if runID == "" {
+				latest, err := latestRunID(taskID)
+				if err != nil {
+					fmt.Printf("Error finding the latest run: %v\n", err)
+					return
+				}
+				runID = latest
+			}
+
+			var err error
+			if follow {
+				err = followLogs(taskID, runID)
+			} else {
+				err = printLogs(taskID, runID)
+			}
+
+			if err != nil {
+				fmt.Printf("Error getting logs: %v\n", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&runID, "run", "r", "", "Run ID (defaults to the latest run)")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow the output while the task runs")
+
+	return cmd
+}
+
+// Gets the ID of the most recent run of the task
+func latestRunID(taskID string) (string, error) {
+	resp, err := apiClient.Get(baseUrl + "/tasks/" + taskID + "/runs")
+	if err != nil {
+		return "", fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var runs []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&runs); err != nil {
+		return "", fmt.Errorf("error decoding response: %w", err)
+	}
+
+	if len(runs) == 0 {
+		return "", errors.New("the task has no runs yet")
+	}
+
+	id, _ := runs[0]["id"].(string)
+	return id, nil
+}
+
+func printLogs(taskID, runID string) error {
+	resp, err := apiClient.Get(baseUrl + "/tasks/" + taskID + "/runs/" + runID + "/logs")
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var output struct {
+		Stdout string `json:"stdout"`
+		Stderr string `json:"stderr"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&output); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+
+	fmt.Fprint(os.Stdout, output.Stdout)
+	fmt.Fprint(os.Stderr, output.Stderr)
+	return nil
+}
+
+// Reads the Server-Sent Events of the run until the end event
+func followLogs(taskID, runID string) error {
+	resp, err := streamClient.Get(baseUrl + "/tasks/" + taskID + "/runs/" + runID + "/logs/stream")
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var event string
+	var data []string
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// a blank line dispatches the event
+		if line == "" {
+			done, err := handleLogEvent(event, strings.Join(data, "\n"))
+			if done || err != nil {
+				return err
+			}
+			event, data = "", nil
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(line, "event:"); ok {
+			event = strings.TrimSpace(value)
+		} else if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Prints an event of the log stream, returns true on the end event
+func handleLogEvent(event, data string) (bool, error) {
+	switch event {
+	case "output":
+		var chunk struct {
+			Stream string `json:"stream"`
+			Data   string `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("error decoding output: %w", err)
+		}
+		if chunk.Stream == "stderr" {
+			fmt.Fprint(os.Stderr, chunk.Data)
+		} else {
+			fmt.Fprint(os.Stdout, chunk.Data)
+		}
+	case "end":
+		var run map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &run); err == nil {
+			fmt.Fprintf(os.Stderr, "Run %s finished with status %s\n", run["id"], run["status"])
+		}
+		return true, nil
+	case "error":
+		return true, fmt.Errorf("stream error: %s", data)
+	}
+
+	return false, nil
+}
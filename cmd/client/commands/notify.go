@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/spf13/cobra"
+)
+
+// Groups the subcommands that manage the notification webhooks and emails
+func NewNotifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Manage the webhooks and emails notified on task events",
+	}
+
+	cmd.AddCommand(newNotifyAddCommand())
+	cmd.AddCommand(newNotifyListCommand())
+	cmd.AddCommand(newNotifyDeleteCommand())
+	cmd.AddCommand(newNotifyDeliveriesCommand())
+	cmd.AddCommand(newNotifyTestCommand())
+
+	return cmd
+}
+
+func newNotifyAddCommand() *cobra.Command {
+	var (
+		rule   domain.NotificationRule
+		events []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add",
+		Short: "Add a webhook or email recipients for the events of a task, or of every task without --task",
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, event := range events {
+				rule.Events = append(rule.Events, domain.EventType(event))
+			}
+
+			var created domain.NotificationRule
+			if err := postJSON(apiClient, "/notifications/", rule, http.StatusCreated, &created); err != nil {
+				fmt.Printf("Error adding notification rule: %v\n", err)
+				return
+			}
+
+			fmt.Printf("Notification rule %s added\n", created.ID)
+		},
+	}
+
+	cmd.Flags().StringVarP(&rule.URL, "url", "u", "", "Webhook URL")
+	cmd.Flags().StringSliceVar(&rule.Email, "email", nil, "Email recipients notified instead of a webhook")
+	cmd.Flags().StringVar(&rule.TaskID, "task", "", "Task notified (every task if empty)")
+	cmd.Flags().StringSliceVarP(&events, "event", "e", []string{string(domain.EventRunFailed)},
+		"Events notified: task.created, task.updated, task.deleted, run.started, run.succeeded, run.failed, run.sla_missed")
+	cmd.Flags().StringVar(&rule.Secret, "secret", "", "Key of the X-Signature-256 HMAC-SHA256 signature")
+	cmd.MarkFlagsOneRequired("url", "email")
+	cmd.MarkFlagsMutuallyExclusive("url", "email")
+
+	return cmd
+}
+
+func newNotifyListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the notification rules",
+		Run: func(cmd *cobra.Command, args []string) {
+			var rules []domain.NotificationRule
+			if err := getJSON("/notifications/", &rules); err != nil {
+				fmt.Printf("Error listing notification rules: %v\n", err)
+				return
+			}
+
+			if len(rules) == 0 {
+				fmt.Println("No notification rules found")
+				return
+			}
+
+			fmt.Printf("%-18s %-20s %-30s %s\n", "ID", "TASK", "EVENTS", "TARGET")
+			for _, rule := range rules {
+				task := rule.TaskID
+				if task == "" {
+					task = "*"
+				}
+				events := make([]string, len(rule.Events))
+				for i, event := range rule.Events {
+					events[i] = string(event)
+				}
+				fmt.Printf("%-18s %-20s %-30s %s\n", rule.ID, task, strings.Join(events, ","), rule.Target())
+			}
+		},
+	}
+
+	return cmd
+}
+
+func newNotifyDeleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a notification rule",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req, err := http.NewRequest(http.MethodDelete, baseUrl+"/notifications/"+args[0], nil)
+			if err != nil {
+				fmt.Printf("Error creating request: %v\n", err)
+				return
+			}
+
+			resp, err := apiClient.Do(req)
+			if err != nil {
+				fmt.Printf("Error making request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusNoContent {
+				body, _ := io.ReadAll(resp.Body)
+				fmt.Printf("Error deleting notification rule: %s\n", string(body))
+				return
+			}
+
+			fmt.Println("Notification rule deleted successfully")
+		},
+	}
+
+	return cmd
+}
+
+func newNotifyDeliveriesCommand() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "deliveries",
+		Short: "Show the most recent webhook and email deliveries",
+		Run: func(cmd *cobra.Command, args []string) {
+			var deliveries []domain.NotificationDelivery
+			if err := getJSON("/notifications/deliveries?limit="+strconv.Itoa(limit), &deliveries); err != nil {
+				fmt.Printf("Error listing notification deliveries: %v\n", err)
+				return
+			}
+
+			if len(deliveries) == 0 {
+				fmt.Println("No notification deliveries found")
+				return
+			}
+
+			fmt.Printf("%-25s %-18s %-15s %-9s %8s %6s  %s\n", "ID", "EVENT", "TASK", "RESULT", "ATTEMPTS", "STATUS", "URL")
+			for _, d := range deliveries {
+				fmt.Printf("%-25s %-18s %-15s %-9s %8d %6d  %s\n", d.ID, d.Event, d.TaskID, deliveryResult(&d),
+					d.Attempts, d.StatusCode, d.URL)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 50, "Maximum deliveries shown")
+
+	return cmd
+}
+
+func newNotifyTestCommand() *cobra.Command {
+	var (
+		url, secret string
+		email       []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "test [rule-id]",
+		Short: "Send a test notification to the webhook or the recipients of a rule, to --url or to --email",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			test := map[string]interface{}{"url": url, "secret": secret, "email": email}
+			if len(args) == 1 {
+				test = map[string]interface{}{"rule_id": args[0]}
+			} else if url == "" && len(email) == 0 {
+				fmt.Println("Error: a rule ID, --url or --email is required")
+				return
+			}
+
+			// the api retries the notification with backoff, so the request has no timeout
+			var delivery domain.NotificationDelivery
+			if err := postJSON(streamClient, "/notifications/test", test, http.StatusOK, &delivery); err != nil {
+				fmt.Printf("Error testing notification: %v\n", err)
+				return
+			}
+
+			if !delivery.Delivered {
+				fmt.Printf("Test notification failed after %d attempts: %s\n", delivery.Attempts, delivery.Error)
+				return
+			}
+			fmt.Printf("Test notification delivered to %s (status %d)\n", delivery.URL, delivery.StatusCode)
+		},
+	}
+
+	cmd.Flags().StringVarP(&url, "url", "u", "", "Webhook URL tested instead of a rule")
+	cmd.Flags().StringVar(&secret, "secret", "", "Key of the signature sent to --url")
+	cmd.Flags().StringSliceVar(&email, "email", nil, "Email recipients tested instead of a rule")
+
+	return cmd
+}
+
+func deliveryResult(d *domain.NotificationDelivery) string {
+	if d.Delivered {
+		return "delivered"
+	}
+	return "failed"
+}
+
+// Posts v as JSON to path and decodes the response into out, expecting the status code
+func postJSON(client *http.Client, path string, v interface{}, status int, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := client.Post(baseUrl+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != status {
+		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
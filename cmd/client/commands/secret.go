@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Groups the subcommands that manage the secrets store
+func NewSecretCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Manage secrets injected in tasks",
+	}
+
+	cmd.AddCommand(newSecretSetCommand())
+	cmd.AddCommand(newSecretListCommand())
+	cmd.AddCommand(newSecretDeleteCommand())
+
+	return cmd
+}
+
+func newSecretSetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set <name> [value]",
+		Short: "Create or replace a secret, the value is read from stdin if omitted",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+
+			var value string
+			if len(args) == 2 {
+				value = args[1]
+			} else {
+				// Reading from stdin keeps the value out of the shell history
+				line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+				if err != nil && err != io.EOF {
+					fmt.Printf("Error reading secret value: %v\n", err)
+					return
+				}
+				value = strings.TrimRight(line, "\r\n")
+			}
+
+			if err := setSecret(name, value); err != nil {
+				fmt.Printf("Error setting secret: %v\n", err)
+				return
+			}
+
+			fmt.Println("Secret stored successfully")
+		},
+	}
+
+	return cmd
+}
+
+func newSecretListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List secret names",
+		Run: func(cmd *cobra.Command, args []string) {
+			resp, err := apiClient.Get(baseUrl + "/secrets")
+			if err != nil {
+				fmt.Printf("Error making request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				fmt.Printf("Error reading response: %v\n", err)
+				return
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				fmt.Printf("Error listing secrets: %s\n", string(body))
+				return
+			}
+
+			var list []map[string]interface{}
+			if err := json.Unmarshal(body, &list); err != nil {
+				fmt.Printf("Error decoding response: %v\n", err)
+				return
+			}
+
+			if len(list) == 0 {
+				fmt.Println("No secrets found")
+				return
+			}
+
+			for _, secret := range list {
+				fmt.Printf("%s\t(updated at %s)\n", secret["name"], secret["updated_at"])
+			}
+		},
+	}
+
+	return cmd
+}
+
+func newSecretDeleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a secret",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req, err := http.NewRequest(http.MethodDelete, baseUrl+"/secrets/"+args[0], nil)
+			if err != nil {
+				fmt.Printf("Error creating request: %v\n", err)
+				return
+			}
+
+			resp, err := apiClient.Do(req)
+			if err != nil {
+				fmt.Printf("Error making request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusNoContent {
+				body, _ := io.ReadAll(resp.Body)
+				fmt.Printf("Error deleting secret: %s\n", string(body))
+				return
+			}
+
+			fmt.Println("Secret deleted successfully")
+		},
+	}
+
+	return cmd
+}
+
+func setSecret(name, value string) error {
+	body, err := json.Marshal(map[string]string{"value": value})
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, baseUrl+"/secrets/"+name, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
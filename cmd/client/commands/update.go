@@ -20,6 +20,19 @@ func NewUpdateCommand() *cobra.Command {
 		status      string
 		scheduledAt string
 		file        string
+		secretNames []string
+		queue       string
+		sla         int
+		onSuccess   []string
+		onFailure   []string
+		passOutput  bool
+		matrix      []string
+		maxParallel int
+		threshold   int
+		locks       []string
+		concurrency string
+		schedule    string
+		timezone    string
 	)
 
 	cmd := &cobra.Command{
@@ -67,6 +80,57 @@ func NewUpdateCommand() *cobra.Command {
 					if status != "" {
 						task.Status = domain.TaskStatus(status)
 					}
+					if len(secretNames) > 0 {
+						task.Secrets = secretNames
+					}
+					if queue != "" {
+						task.Queue = queue
+					}
+					if cmd.Flags().Changed("sla") {
+						task.SLASeconds = sla
+					}
+					if cmd.Flags().Changed("on-success") {
+						task.OnSuccess = onSuccess
+					}
+					if cmd.Flags().Changed("on-failure") {
+						task.OnFailure = onFailure
+					}
+					if cmd.Flags().Changed("pass-output") {
+						task.PassOutput = passOutput
+					}
+					if cmd.Flags().Changed("lock") {
+						task.Locks = locks
+					}
+					if cmd.Flags().Changed("concurrency-policy") {
+						task.ConcurrencyPolicy = domain.ConcurrencyPolicy(concurrency)
+					}
+					if len(matrix) > 0 {
+						params, err := parseMatrixParams(matrix)
+						if err != nil {
+							fmt.Printf("Invalid matrix: %v\n", err)
+							return
+						}
+						if task.Matrix == nil {
+							task.Matrix = &domain.Matrix{}
+						}
+						task.Matrix.Params = params
+					}
+					if task.Matrix != nil && cmd.Flags().Changed("max-parallel") {
+						task.Matrix.MaxParallel = maxParallel
+					}
+					if task.Matrix != nil && cmd.Flags().Changed("failure-threshold") {
+						task.Matrix.FailureThreshold = threshold
+					}
+					if cmd.Flags().Changed("schedule") || cmd.Flags().Changed("timezone") {
+						if cmd.Flags().Changed("schedule") {
+							task.Schedule = schedule
+						}
+						if cmd.Flags().Changed("timezone") {
+							task.Timezone = timezone
+						}
+						// the server schedules the next run on the new schedule
+						task.ScheduledAt = time.Time{}
+					}
 					if scheduledAt != "" {
 						task.ScheduledAt, err = time.Parse(time.RFC3339, scheduledAt)
 						if err != nil {
@@ -92,7 +156,20 @@ func NewUpdateCommand() *cobra.Command {
 	cmd.Flags().StringVarP(&command, "command", "c", "", "Command to execute")
 	cmd.Flags().StringVarP(&status, "status", "s", "", "Task status")
 	cmd.Flags().StringVarP(&scheduledAt, "scheduled-at", "t", "", "Scheduled time (RFC3339 format)")
+	cmd.Flags().StringVar(&schedule, "schedule", "", "Cron expression the task runs again on (empty stops it repeating)")
+	cmd.Flags().StringVar(&timezone, "timezone", "", "IANA timezone of the schedule")
 	cmd.Flags().StringVarP(&file, "file", "f", "", "JSON file with task data")
+	cmd.Flags().StringSliceVar(&secretNames, "secret", nil, "Secrets injected as environment variables")
+	cmd.Flags().StringVarP(&queue, "queue", "q", "", "Task queue consumed by the workers that run the task")
+	cmd.Flags().IntVar(&sla, "sla", 0, "Seconds a run is expected to take at most (0 removes the SLA)")
+	cmd.Flags().StringSliceVar(&onSuccess, "on-success", nil, "Tasks triggered when a run succeeds")
+	cmd.Flags().StringSliceVar(&onFailure, "on-failure", nil, "Tasks triggered when a run fails")
+	cmd.Flags().BoolVar(&passOutput, "pass-output", false, "Pass the result and the end of the stdout of the run to the triggered tasks")
+	cmd.Flags().StringSliceVar(&locks, "lock", nil, "Named resources locked while the task runs")
+	cmd.Flags().StringVar(&concurrency, "concurrency-policy", "", "Run coming while another run of the task is running (allow, forbid, replace, queue)")
+	cmd.Flags().StringArrayVar(&matrix, "matrix", nil, "Parameter sets replacing the ones of the matrix (repeatable)")
+	cmd.Flags().IntVar(&maxParallel, "max-parallel", 0, "Matrix children running at once (all if 0)")
+	cmd.Flags().IntVar(&threshold, "failure-threshold", 0, "Failed matrix children tolerated before the run fails")
 
 	return cmd
 }
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func NewUsageCommand() *cobra.Command {
+	var (
+		from    string
+		to      string
+		groupBy string
+		label   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Show the resource usage of the runs per task or per label",
+		Run: func(cmd *cobra.Command, args []string) {
+			now := time.Now()
+			if from == "" {
+				from = now.Add(-24 * time.Hour).Format(time.RFC3339)
+			}
+			if to == "" {
+				to = now.Format(time.RFC3339)
+			}
+
+			query := url.Values{}
+			query.Set("from", from)
+			query.Set("to", to)
+			query.Set("group_by", groupBy)
+			if label != "" {
+				query.Set("label", label)
+			}
+
+			resp, err := apiClient.Get(baseUrl + "/usage?" + query.Encode())
+			if err != nil {
+				fmt.Printf("Error making request: %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				fmt.Printf("Error reading response: %v\n", err)
+				return
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				fmt.Printf("Error getting usage: %s\n", string(body))
+				return
+			}
+
+			var summaries []struct {
+				Key         string `json:"key"`
+				Runs        int    `json:"runs"`
+				Failed      int    `json:"failed"`
+				WallTimeMs  int64  `json:"wall_time_ms"`
+				UserCPUMs   int64  `json:"user_cpu_ms"`
+				SystemCPUMs int64  `json:"system_cpu_ms"`
+				MaxRSSKB    int64  `json:"max_rss_kb"`
+			}
+			if err := json.Unmarshal(body, &summaries); err != nil {
+				fmt.Printf("Error decoding response: %v\n", err)
+				return
+			}
+
+			fmt.Printf("Resource usage between %s and %s:\n", from, to)
+			if len(summaries) == 0 {
+				fmt.Println("No runs found in this time range")
+				return
+			}
+
+			fmt.Printf("%-30s %6s %6s %12s %12s %12s %12s\n", groupBy, "RUNS", "FAILED", "WALL", "USER CPU", "SYS CPU", "MAX RSS")
+			for _, s := range summaries {
+				fmt.Printf("%-30s %6d %6d %12s %12s %12s %10dKB\n", s.Key, s.Runs, s.Failed,
+					time.Duration(s.WallTimeMs)*time.Millisecond,
+					time.Duration(s.UserCPUMs)*time.Millisecond,
+					time.Duration(s.SystemCPUMs)*time.Millisecond,
+					s.MaxRSSKB)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&from, "from", "f", "", "Start time (RFC3339 format), defaults to 24 hours ago")
+	cmd.Flags().StringVarP(&to, "to", "t", "", "End time (RFC3339 format), defaults to now")
+	cmd.Flags().StringVarP(&groupBy, "group-by", "g", "task", "Group by task or label")
+	cmd.Flags().StringVar(&label, "label", "", "Only this label key when grouping by label")
+
+	return cmd
+}
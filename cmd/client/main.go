@@ -26,6 +26,12 @@ func main() {
 	//rootCmd.AddCommand(commands.NewHealthCheckCommand())
 	rootCmd.AddCommand(commands.NewScheduleCommand())
 	rootCmd.AddCommand(commands.NewExecuteCommand())
+	rootCmd.AddCommand(commands.NewSecretCommand())
+	rootCmd.AddCommand(commands.NewLogsCommand())
+	rootCmd.AddCommand(commands.NewUsageCommand())
+	rootCmd.AddCommand(commands.NewDeadLetterCommand())
+	rootCmd.AddCommand(commands.NewNotifyCommand())
+	rootCmd.AddCommand(commands.NewLimitCommand())
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Println(err)
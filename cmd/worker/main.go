@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -19,6 +21,11 @@ func main() {
 
 	cfg := config.LoadConfig()
 
+	// the queues flag overrides WORKER_QUEUES, e.g. worker --queues=gpu-free,reports
+	queues := flag.String("queues", strings.Join(cfg.WorkerQueues, ","), "Comma separated task queues to consume")
+	flag.Parse()
+	cfg.WorkerQueues = config.SplitList(*queues)
+
 	//Initialize worker
 	taskWorker, err := worker.NewTaskWorker(cfg)
 	if err != nil {
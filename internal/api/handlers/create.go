@@ -36,6 +36,21 @@ func (h *taskHandler) CreateTask(c *gin.Context) {
 		return
 	}
 
+	if status, err := h.checkQueue(c.Request.Context(), &task); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if status, err := h.checkFollowUps(c.Request.Context(), &task); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := scheduleRecurring(&task); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
 	if task.Status == "" {
 		task.Status = domain.TaskStatusPending // Default status if not provided
 	}
@@ -45,6 +60,8 @@ func (h *taskHandler) CreateTask(c *gin.Context) {
 		c.JSON(500, gin.H{"error": "Failed to create task"})
 		return
 	}
+	h.queueIfDue(c.Request.Context(), &task)
+	h.events.Publish(c.Request.Context(), domain.NewTaskEvent(domain.EventTaskCreated, &task))
 	//201 is the status code for Created
 	c.JSON(201, gin.H{"message": "Task created successfully", "task_id": task.ID})
 }
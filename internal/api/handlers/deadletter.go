@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/repository"
+)
+
+type deadLetterHandler struct {
+	repo      repository.DeadLetterHandler
+	publisher messaging.Publisher
+}
+
+// The publisher is nil when the message broker couldn't be created, then replaying answers 503
+func NewDeadLetterHandler(repo repository.DeadLetterHandler, publisher messaging.Publisher) *deadLetterHandler {
+	return &deadLetterHandler{
+		repo:      repo,
+		publisher: publisher,
+	}
+}
+
+// ListDeadLetters lists the dead lettered messages
+// @Summary Lists dead letters
+// @Description Lists the task messages that could not be processed, oldest first
+// @Tags deadletters
+// @Produce json
+// @Success 200 {array} domain.DeadLetter
+// @Failure 500 {object} map[string]string
+// @Router /deadletters [get]
+func (h *deadLetterHandler) ListDeadLetters(c *gin.Context) {
+	letters, err := h.repo.ListDeadLetters(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if letters == nil {
+		letters = []*domain.DeadLetter{}
+	}
+
+	c.JSON(http.StatusOK, letters)
+}
+
+// GetDeadLetter returns a dead letter
+// @Summary Gets a dead letter
+// @Description Gets a dead lettered message with its body, headers and the reason it was dead lettered
+// @Tags deadletters
+// @Produce json
+// @Param id path string true "dead letter ID"
+// @Success 200 {object} domain.DeadLetter
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /deadletters/{id} [get]
+func (h *deadLetterHandler) GetDeadLetter(c *gin.Context) {
+	letter, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, letter)
+}
+
+// ReplayDeadLetter publishes a dead letter in its task queue again
+// @Summary Replays a dead letter
+// @Description Publishes the task message again as a first attempt and removes it from the dead letters
+// @Tags deadletters
+// @Produce json
+// @Param id path string true "dead letter ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /deadletters/{id}/replay [post]
+func (h *deadLetterHandler) ReplayDeadLetter(c *gin.Context) {
+	if h.publisher == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "message broker is not available"})
+		return
+	}
+
+	letter, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	taskMsg, err := domain.ParseTaskMessage([]byte(letter.Body))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "the message is not a task message, it would be dead lettered again"})
+		return
+	}
+
+	// published as a first attempt with a new run, keeping the correlation ID
+	body, err := json.Marshal(taskMsg.Redeliver(1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the headers set by the worker and the broker are dropped so the attempts start over
+	headers := make(map[string]string)
+	for k, v := range letter.Headers {
+		if !strings.HasPrefix(k, "x-") {
+			headers[k] = v
+		}
+	}
+
+	err = h.publisher.Publish(c.Request.Context(), messaging.Publishing{
+		Exchange:   messaging.TasksExchange,
+		RoutingKey: messaging.TaskRoutingKey(messaging.TaskQueueName(letter.Queue)),
+		Body:       body,
+		Headers:    headers,
+		Mandatory:  true,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish message: " + err.Error()})
+		return
+	}
+
+	if err := h.repo.DeleteDeadLetter(c.Request.Context(), letter.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dead letter replayed", "id": letter.ID})
+}
+
+// DeleteDeadLetter removes a dead letter
+// @Summary Deletes a dead letter
+// @Description Deletes a dead letter without replaying it
+// @Tags deadletters
+// @Produce json
+// @Param id path string true "dead letter ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /deadletters/{id} [delete]
+func (h *deadLetterHandler) DeleteDeadLetter(c *gin.Context) {
+	letter, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.DeleteDeadLetter(c.Request.Context(), letter.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PurgeDeadLetters removes every dead letter
+// @Summary Purges the dead letters
+// @Description Deletes every dead letter and returns how many were deleted
+// @Tags deadletters
+// @Produce json
+// @Success 200 {object} map[string]int
+// @Failure 500 {object} map[string]string
+// @Router /deadletters [delete]
+func (h *deadLetterHandler) PurgeDeadLetters(c *gin.Context) {
+	purged, err := h.repo.PurgeDeadLetters(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
+
+// Writes the error response and returns false when the dead letter can't be found
+func (h *deadLetterHandler) find(c *gin.Context) (*domain.DeadLetter, bool) {
+	letter, err := h.repo.FindDeadLetter(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if letter == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return nil, false
+	}
+
+	return letter, true
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/siluk00/task_scheduler/internal/domain"
 )
 
 // DeleteTask removes a task
@@ -38,6 +39,7 @@ func (h *taskHandler) DeleteTask(c *gin.Context) {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	h.events.Publish(c.Request.Context(), domain.NewTaskEvent(domain.EventTaskDeleted, taskToDelete))
 
 	// C.Status is a method to set the HTTP status code of the response.
 	// http.StatusNoContent is the status code for No Content (204).
@@ -1,16 +1,47 @@
 package handlers
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+type healthHandler struct {
+	broker messaging.Broker
+}
+
+// The broker is nil when it couldn't be created
+func NewHealthHandler(broker messaging.Broker) *healthHandler {
+	return &healthHandler{
+		broker: broker,
+	}
+}
 
 // O método healthCheck é um manipulador de rota que responde a requisições GET na rota /health.
 // Ele retorna um JSON simples indicando que o servidor está funcionando corretamente.
 // Isso é útil para verificar se o servidor está ativo e respondendo.
 // Ele pode ser usado por ferramentas de monitoramento ou health checks de serviços externos.
-// O manipulador recebe um contexto (c *gin.Context) que contém informações sobre a requisição
-// e a resposta.
-func (h *taskHandler) HealthCheck(c *gin.Context) {
+// O estado da conexão com o message broker é incluído, e a resposta é 503 quando ele não está conectado.
+// @Summary Health check
+// @Description Reports the server status and the state of the message broker connection
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /health [get]
+func (h *healthHandler) HealthCheck(c *gin.Context) {
+	state := "unavailable"
+	if h.broker != nil {
+		state = h.broker.State()
+	}
+
 	//gin.H é um atalho para criar um mapa de strings para JSON.
 	// Ele é usado para construir respostas JSON de forma simples e rápida.
-	// Aqui, estamos retornando um JSON com o status "ok".
-	c.JSON(200, gin.H{"status": "ok"})
+	if state != messaging.StateConnected {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "degraded", "message_broker": state})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "message_broker": state})
 }
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/notify"
+	"github.com/siluk00/task_scheduler/internal/repository"
+)
+
+type notificationHandler struct {
+	repo     repository.NotificationHandler
+	notifier *notify.Notifier
+}
+
+func NewNotificationHandler(repo repository.NotificationHandler, notifier *notify.Notifier) *notificationHandler {
+	return &notificationHandler{
+		repo:     repo,
+		notifier: notifier,
+	}
+}
+
+// The webhook or the recipients of a rule, a URL and secret, or email recipients to send a test notification to
+type notificationTest struct {
+	RuleID string   `json:"rule_id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Email  []string `json:"email"`
+}
+
+// CreateNotificationRule creates a notification rule
+// @Summary Creates a notification rule
+// @Description Creates a webhook POSTed, or an email sent to the email recipients, on the selected events of a task, or of every task when task_id is empty
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param rule body domain.NotificationRule true "rule"
+// @Success 201 {object} domain.NotificationRule
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications [post]
+func (h *notificationHandler) CreateNotificationRule(c *gin.Context) {
+	var input domain.NotificationRule
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification rule data"})
+		return
+	}
+
+	rule := domain.NewNotificationRule()
+	rule.TaskID = input.TaskID
+	rule.URL = input.URL
+	rule.Email = input.Email
+	rule.Events = input.Events
+	rule.Secret = input.Secret
+
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.SaveRule(c.Request.Context(), rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, redactRule(rule))
+}
+
+// ListNotificationRules lists the notification rules
+// @Summary Lists notification rules
+// @Description Lists the notification rules without their secrets
+// @Tags notifications
+// @Produce json
+// @Success 200 {array} domain.NotificationRule
+// @Failure 500 {object} map[string]string
+// @Router /notifications [get]
+func (h *notificationHandler) ListNotificationRules(c *gin.Context) {
+	rules, err := h.repo.ListRules(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	redacted := make([]*domain.NotificationRule, 0, len(rules))
+	for _, rule := range rules {
+		redacted = append(redacted, redactRule(rule))
+	}
+
+	c.JSON(http.StatusOK, redacted)
+}
+
+// DeleteNotificationRule removes a notification rule
+// @Summary Deletes a notification rule
+// @Description Deletes a notification rule by its ID
+// @Tags notifications
+// @Produce json
+// @Param id path string true "rule ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/{id} [delete]
+func (h *notificationHandler) DeleteNotificationRule(c *gin.Context) {
+	rule, err := h.repo.FindRule(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if rule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	if err := h.repo.DeleteRule(c.Request.Context(), rule.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListNotificationDeliveries lists the delivery log
+// @Summary Lists notification deliveries
+// @Description Lists the most recent webhook and email deliveries with the result of their last attempt, newest first
+// @Tags notifications
+// @Produce json
+// @Param limit query int false "maximum deliveries returned, 50 by default"
+// @Success 200 {array} domain.NotificationDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/deliveries [get]
+func (h *notificationHandler) ListNotificationDeliveries(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	deliveries, err := h.repo.ListDeliveries(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// TestNotification sends a test notification
+// @Summary Sends a test notification
+// @Description Sends a notification.test payload to the webhook or the recipients of a rule, to a URL signed with a secret, or to email recipients, with the usual retries
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param test body notificationTest true "rule_id, url and secret, or email"
+// @Success 200 {object} domain.NotificationDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /notifications/test [post]
+func (h *notificationHandler) TestNotification(c *gin.Context) {
+	var test notificationTest
+	if err := c.ShouldBindJSON(&test); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification test data"})
+		return
+	}
+
+	rule := &domain.NotificationRule{URL: test.URL, Secret: test.Secret, Email: test.Email}
+	if test.RuleID != "" {
+		found, err := h.repo.FindRule(c.Request.Context(), test.RuleID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if found == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return
+		}
+		rule = found
+	} else {
+		// any event makes a valid rule, only the target is checked
+		rule.Events = []domain.EventType{domain.EventRunFailed}
+		if err := rule.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	delivery := h.notifier.Deliver(c.Request.Context(), rule, &domain.NotificationPayload{
+		Event:      domain.EventNotificationTest,
+		TaskID:     rule.TaskID,
+		OccurredAt: time.Now(),
+	})
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// Returns a copy of the rule without its secret
+func redactRule(rule *domain.NotificationRule) *domain.NotificationRule {
+	redacted := *rule
+	redacted.Secret = ""
+	return &redacted
+}
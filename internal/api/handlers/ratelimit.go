@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/repository"
+)
+
+type rateLimitHandler struct {
+	repo repository.RateLimitHandler
+}
+
+func NewRateLimitHandler(repo repository.RateLimitHandler) *rateLimitHandler {
+	return &rateLimitHandler{
+		repo: repo,
+	}
+}
+
+// SetRateLimit creates or replaces a rate limit
+// @Summary Sets a rate limit
+// @Description Caps the runs at once and the starts per minute of the tasks of a queue or with a label, across every worker
+// @Tags limits
+// @Accept json
+// @Produce json
+// @Param name path string true "limit name"
+// @Param limit body domain.RateLimit true "rate limit"
+// @Success 200 {object} domain.RateLimit
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /limits/{name} [put]
+func (h *rateLimitHandler) SetRateLimit(c *gin.Context) {
+	var limit domain.RateLimit
+	if err := c.ShouldBindJSON(&limit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rate limit data"})
+		return
+	}
+
+	limit.Name = c.Param("name")
+	if err := limit.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.SetLimit(c.Request.Context(), &limit); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store rate limit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, limit)
+}
+
+// ListRateLimits lists the rate limits
+// @Summary Lists rate limits
+// @Tags limits
+// @Produce json
+// @Success 200 {array} domain.RateLimit
+// @Failure 500 {object} map[string]string
+// @Router /limits [get]
+func (h *rateLimitHandler) ListRateLimits(c *gin.Context) {
+	list, err := h.repo.ListLimits(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if list == nil {
+		list = []*domain.RateLimit{}
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// DeleteRateLimit removes a rate limit
+// @Summary Deletes a rate limit
+// @Description Deletes a rate limit by its name, the runs it holds back start on their next try
+// @Tags limits
+// @Produce json
+// @Param name path string true "limit name"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /limits/{name} [delete]
+func (h *rateLimitHandler) DeleteRateLimit(c *gin.Context) {
+	name := c.Param("name")
+	limit, err := h.repo.FindLimit(c.Request.Context(), name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if limit == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	if err := h.repo.DeleteLimit(c.Request.Context(), name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/repository"
+)
+
+// How long a streaming request waits for new output before checking the client again
+const streamPollInterval = 5 * time.Second
+
+type runHandler struct {
+	taskRepo repository.TaskHandler
+	runRepo  repository.RunHandler
+}
+
+func NewRunHandler(taskRepo repository.TaskHandler, runRepo repository.RunHandler) *runHandler {
+	return &runHandler{
+		taskRepo: taskRepo,
+		runRepo:  runRepo,
+	}
+}
+
+// ListRuns lists the runs of a task
+// @Summary Lists task runs
+// @Description Lists the executions of a task, newest first
+// @Tags runs
+// @Produce json
+// @Param id path string true "task id"
+// @Success 200 {array} domain.TaskRun
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tasks/{id}/runs [get]
+func (h *runHandler) ListRuns(c *gin.Context) {
+	id := c.Param("id")
+
+	task, err := h.taskRepo.FindById(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if task == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+
+	runs, err := h.runRepo.ListRuns(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if runs == nil {
+		runs = []*domain.TaskRun{}
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// GetRun gets a run of a task
+// @Summary Gets a task run
+// @Description Gets a single execution of a task
+// @Tags runs
+// @Produce json
+// @Param id path string true "task id"
+// @Param run path string true "run id"
+// @Success 200 {object} domain.TaskRun
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tasks/{id}/runs/{run} [get]
+func (h *runHandler) GetRun(c *gin.Context) {
+	run, ok := h.findRun(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// GetRunLogs gets the output of a run
+// @Summary Gets run output
+// @Description Gets the captured stdout and stderr of a run
+// @Tags runs
+// @Produce json
+// @Param id path string true "task id"
+// @Param run path string true "run id"
+// @Success 200 {object} domain.RunOutput
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tasks/{id}/runs/{run}/logs [get]
+func (h *runHandler) GetRunLogs(c *gin.Context) {
+	run, ok := h.findRun(c)
+	if !ok {
+		return
+	}
+
+	output, err := h.runRepo.GetOutput(c.Request.Context(), run.TaskID, run.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, output)
+}
+
+// StreamRunLogs streams the output of a run
+// @Summary Streams run output
+// @Description Streams the output of a run as Server-Sent Events while the process runs.
+// @Description Each "output" event carries a domain.OutputChunk, the "end" event carries the finished run.
+// @Tags runs
+// @Produce text/event-stream
+// @Param id path string true "task id"
+// @Param run path string true "run id"
+// @Success 200 {object} domain.OutputChunk
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tasks/{id}/runs/{run}/logs/stream [get]
+func (h *runHandler) StreamRunLogs(c *gin.Context) {
+	run, ok := h.findRun(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	// the Last-Event-ID header lets a reconnecting client resume where it stopped
+	last := c.GetHeader("Last-Event-ID")
+	if last == "" {
+		last = "0"
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	// c.Stream calls the function until it returns false or the client goes away
+	c.Stream(func(w io.Writer) bool {
+		chunks, done, err := h.runRepo.ReadOutput(ctx, run.TaskID, run.ID, last, streamPollInterval)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.SSEvent("error", gin.H{"error": err.Error()})
+			}
+			return false
+		}
+
+		for _, chunk := range chunks {
+			c.Render(-1, sse.Event{Event: "output", Id: chunk.ID, Data: chunk})
+			last = chunk.ID
+		}
+
+		if done {
+			finished, err := h.runRepo.FindRun(ctx, run.TaskID, run.ID)
+			if err != nil || finished == nil {
+				finished = run
+			}
+			c.SSEvent("end", finished)
+			return false
+		}
+
+		return true
+	})
+}
+
+// Finds the run of the path parameters, writing the error response if it fails
+func (h *runHandler) findRun(c *gin.Context) (*domain.TaskRun, bool) {
+	run, err := h.runRepo.FindRun(c.Request.Context(), c.Param("id"), c.Param("run"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if run == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return nil, false
+	}
+
+	return run, true
+}
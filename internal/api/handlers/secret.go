@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/repository"
+)
+
+type secretHandler struct {
+	repo repository.SecretHandler
+}
+
+// The repo is nil when no master key is configured, then every route answers 503
+func NewSecretHandler(repo repository.SecretHandler) *secretHandler {
+	return &secretHandler{
+		repo: repo,
+	}
+}
+
+func (h *secretHandler) available(c *gin.Context) bool {
+	if h.repo == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "secrets store is not configured"})
+		return false
+	}
+	return true
+}
+
+// SetSecret creates or replaces a secret
+// @Summary Sets a secret
+// @Description Stores a secret encrypted, the value is never returned
+// @Tags secrets
+// @Accept json
+// @Produce json
+// @Param name path string true "secret name"
+// @Param secret body domain.Secret true "secret value"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /secrets/{name} [put]
+func (h *secretHandler) SetSecret(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	var secret domain.Secret
+	if err := c.ShouldBindJSON(&secret); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid secret data"})
+		return
+	}
+
+	secret.Name = c.Param("name")
+	if err := secret.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.repo.Set(c.Request.Context(), &secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Secret stored successfully", "name": secret.Name})
+}
+
+// ListSecrets lists the secret names
+// @Summary Lists secrets
+// @Description Lists the stored secrets without their values
+// @Tags secrets
+// @Produce json
+// @Success 200 {array} domain.Secret
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /secrets [get]
+func (h *secretHandler) ListSecrets(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	list, err := h.repo.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if list == nil {
+		list = []*domain.Secret{}
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// DeleteSecret removes a secret
+// @Summary Deletes a secret
+// @Description Deletes a secret by its name
+// @Tags secrets
+// @Produce json
+// @Param name path string true "secret name"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /secrets/{name} [delete]
+func (h *secretHandler) DeleteSecret(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	name := c.Param("name")
+	secret, err := h.repo.Get(c.Request.Context(), name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if secret == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+
+	if err := h.repo.Delete(c.Request.Context(), name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
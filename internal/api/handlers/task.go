@@ -7,15 +7,108 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/events"
+	"github.com/siluk00/task_scheduler/internal/messaging"
 	"github.com/siluk00/task_scheduler/internal/repository"
+	"github.com/siluk00/task_scheduler/internal/scheduling"
+	"github.com/siluk00/task_scheduler/pkg/config"
 )
 
 type taskHandler struct {
-	repo repository.TaskHandler
+	// the scheduler mode and horizon, tasks due soon are queued when they are saved in delayed mode
+	config *config.AppConfig
+	repo   repository.TaskHandler
+	// the registered consumers of the task queues, the queues aren't checked when it is nil
+	consumers repository.ConsumerHandler
+	// publishes task.created, task.updated and task.deleted, nothing is published when it is nil
+	events *events.Publisher
 }
 
-func NewTaskHandler(repo repository.TaskHandler) *taskHandler {
+func NewTaskHandler(cfg *config.AppConfig, repo repository.TaskHandler, consumers repository.ConsumerHandler, publisher *events.Publisher) *taskHandler {
 	return &taskHandler{
-		repo: repo,
+		config:    cfg,
+		repo:      repo,
+		consumers: consumers,
+		events:    publisher,
+	}
+}
+
+// Checks that a worker consumes the named queue of the task, otherwise it would never run.
+// The default queue isn't checked so tasks can be created before the workers start.
+// Returns the status code and the error of the response.
+func (h *taskHandler) checkQueue(ctx context.Context, task *domain.Task) (int, error) {
+	if h.consumers == nil || task.Queue == "" || task.Queue == messaging.DefaultTaskQueue {
+		return 0, nil
+	}
+
+	count, err := h.consumers.CountConsumers(ctx, task.Queue)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to check queue: %w", err)
+	}
+	if count == 0 {
+		return http.StatusBadRequest, fmt.Errorf("no worker consumes the queue %s", task.Queue)
+	}
+	return 0, nil
+}
+
+// Checks that the follow-up tasks never lead back to the task, a cycle would trigger its tasks
+// over and over. The follow-ups are followed through the stored tasks, the missing ones are skipped.
+// Returns the status code and the error of the response.
+func (h *taskHandler) checkFollowUps(ctx context.Context, task *domain.Task) (int, error) {
+	next := append(append([]string(nil), task.OnSuccess...), task.OnFailure...)
+	visited := make(map[string]bool)
+	for len(next) > 0 {
+		id := next[0]
+		next = next[1:]
+		if id == task.ID {
+			return http.StatusBadRequest, fmt.Errorf("%w: the follow-up tasks lead back to task %s", domain.ErrInvalidFollowUp, task.ID)
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		followUp, err := h.repo.FindById(ctx, id)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("failed to check follow-up task %s: %w", id, err)
+		}
+		if followUp != nil {
+			next = append(append(next, followUp.OnSuccess...), followUp.OnFailure...)
+		}
+	}
+	return 0, nil
+}
+
+// Schedules a recurring task without a scheduled time at the next occurrence of its schedule
+func scheduleRecurring(task *domain.Task) error {
+	if !task.ScheduledAt.IsZero() {
+		return nil
+	}
+
+	next, err := task.NextRun(time.Now())
+	if err != nil {
+		return err
+	}
+	task.ScheduledAt = next
+	return nil
+}
+
+// Queues the saved task right away when the delayed scheduler would queue it in its next pass.
+// A failure is only logged, the task stays pending and the scheduler queues it.
+func (h *taskHandler) queueIfDue(ctx context.Context, task *domain.Task) {
+	queued, err := scheduling.QueueDueTask(ctx, h.config, h.repo, task)
+	if err != nil {
+		log.Printf("Failed to queue task %s, leaving it to the scheduler: %v", task.ID, err)
+		return
+	}
+	if queued {
+		log.Printf("Task %s queued to run at %s", task.ID, task.ScheduledAt.Format(time.RFC3339))
 	}
 }
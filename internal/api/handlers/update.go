@@ -49,6 +49,31 @@ func (h *taskHandler) UpdateTask(c *gin.Context) {
 		return
 	}
 
+	if status, err := h.checkQueue(c.Request.Context(), &task); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if status, err := h.checkFollowUps(c.Request.Context(), &task); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := scheduleRecurring(&task); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the messages of a rescheduled task are dropped, it is queued again at the new time
+	task.RescheduledAt = existingTask.RescheduledAt
+	if !task.ScheduledAt.Equal(existingTask.ScheduledAt) || task.Schedule != existingTask.Schedule ||
+		task.Timezone != existingTask.Timezone {
+		task.RescheduledAt = time.Now()
+		if task.Status == domain.TaskStatusQueued {
+			task.Status = domain.TaskStatusPending
+		}
+	}
+
 	task.CreatedAt = existingTask.CreatedAt // Preserve the original created time
 	task.UpdatedAt = time.Now()             // Preserve the original updated time
 
@@ -57,6 +82,8 @@ func (h *taskHandler) UpdateTask(c *gin.Context) {
 		c.JSON(500, gin.H{"error": "Failed to update task"})
 		return
 	}
+	h.queueIfDue(c.Request.Context(), &task)
+	h.events.Publish(c.Request.Context(), domain.NewTaskEvent(domain.EventTaskUpdated, &task))
 
 	c.JSON(200, gin.H{"message": "Task updated successfully", "task_id": task.ID})
 }
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/repository"
+)
+
+type usageHandler struct {
+	runRepo repository.RunHandler
+}
+
+func NewUsageHandler(runRepo repository.RunHandler) *usageHandler {
+	return &usageHandler{
+		runRepo: runRepo,
+	}
+}
+
+// GetUsage aggregates the resource usage of the runs
+// @Summary Resource usage
+// @Description Sums wall time, cpu time and peak memory of the runs started in a time span, per task or per label
+// @Tags runs
+// @Produce json
+// @Param from query string true "begin date (RFC3339)"
+// @Param to query string true "end date (RFC3339)"
+// @Param group_by query string false "task (default) or label"
+// @Param label query string false "only this label key when grouping by label"
+// @Success 200 {array} domain.UsageSummary
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /usage [get]
+func (h *usageHandler) GetUsage(c *gin.Context) {
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+		return
+	}
+
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+		return
+	}
+
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to date before from date"})
+		return
+	}
+
+	groupBy := c.DefaultQuery("group_by", domain.UsageByTask)
+	if groupBy != domain.UsageByTask && groupBy != domain.UsageByLabel {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be task or label"})
+		return
+	}
+
+	runs, err := h.runRepo.ListRunsBetween(c.Request.Context(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, domain.SummarizeUsage(runs, groupBy, c.Query("label")))
+}
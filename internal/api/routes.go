@@ -3,6 +3,7 @@ package api
 import (
 	_ "github.com/siluk00/task_scheduler/docs"
 	"github.com/siluk00/task_scheduler/internal/api/handlers"
+	"github.com/siluk00/task_scheduler/internal/notify"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -15,20 +16,71 @@ func (s *Server) setupRoutes() {
 
 	//s.router.GET("/metrics", s.metricsHandler)
 
-	taskHandler := handlers.NewTaskHandler(s.taskRepo)
+	taskHandler := handlers.NewTaskHandler(s.config, s.taskRepo, s.consumerRepo, s.events)
+	runHandler := handlers.NewRunHandler(s.taskRepo, s.runRepo)
 
-	s.router.GET("/health", taskHandler.HealthCheck)
+	healthHandler := handlers.NewHealthHandler(s.broker)
+
+	s.router.GET("/health", healthHandler.HealthCheck)
 
 	taskGroup := s.router.Group("/tasks")
 	{
 		taskGroup.POST("/", taskHandler.CreateTask)
 		taskGroup.GET("/:id", taskHandler.GetTask)
-		taskGroup.GET("/health", taskHandler.HealthCheck)
+		taskGroup.GET("/health", healthHandler.HealthCheck)
 		taskGroup.PUT("/:id", taskHandler.UpdateTask)
 		taskGroup.DELETE("/:id", taskHandler.DeleteTask)
 		taskGroup.GET("/", taskHandler.ListTasks)
 		taskGroup.GET("/scheduled", taskHandler.GetScheduledTasks)
 		taskGroup.PUT("/tasks/:id/execute", taskHandler.ExecuteTask)
+		taskGroup.GET("/:id/runs", runHandler.ListRuns)
+		taskGroup.GET("/:id/runs/:run", runHandler.GetRun)
+		taskGroup.GET("/:id/runs/:run/logs", runHandler.GetRunLogs)
+		taskGroup.GET("/:id/runs/:run/logs/stream", runHandler.StreamRunLogs)
+	}
+
+	usageHandler := handlers.NewUsageHandler(s.runRepo)
+	s.router.GET("/usage", usageHandler.GetUsage)
+
+	secretHandler := handlers.NewSecretHandler(s.secretRepo)
+
+	secretGroup := s.router.Group("/secrets")
+	{
+		secretGroup.GET("/", secretHandler.ListSecrets)
+		secretGroup.PUT("/:name", secretHandler.SetSecret)
+		secretGroup.DELETE("/:name", secretHandler.DeleteSecret)
+	}
+
+	rateLimitHandler := handlers.NewRateLimitHandler(s.rateLimitRepo)
+
+	limitGroup := s.router.Group("/limits")
+	{
+		limitGroup.GET("/", rateLimitHandler.ListRateLimits)
+		limitGroup.PUT("/:name", rateLimitHandler.SetRateLimit)
+		limitGroup.DELETE("/:name", rateLimitHandler.DeleteRateLimit)
+	}
+
+	deadLetterHandler := handlers.NewDeadLetterHandler(s.deadLetterRepo, s.broker)
+
+	deadLetterGroup := s.router.Group("/deadletters")
+	{
+		deadLetterGroup.GET("/", deadLetterHandler.ListDeadLetters)
+		deadLetterGroup.DELETE("/", deadLetterHandler.PurgeDeadLetters)
+		deadLetterGroup.GET("/:id", deadLetterHandler.GetDeadLetter)
+		deadLetterGroup.POST("/:id/replay", deadLetterHandler.ReplayDeadLetter)
+		deadLetterGroup.DELETE("/:id", deadLetterHandler.DeleteDeadLetter)
+	}
+
+	notificationHandler := handlers.NewNotificationHandler(s.notificationRepo,
+		notify.NewNotifier(s.config, s.notificationRepo))
+
+	notificationGroup := s.router.Group("/notifications")
+	{
+		notificationGroup.GET("/", notificationHandler.ListNotificationRules)
+		notificationGroup.POST("/", notificationHandler.CreateNotificationRule)
+		notificationGroup.GET("/deliveries", notificationHandler.ListNotificationDeliveries)
+		notificationGroup.POST("/test", notificationHandler.TestNotification)
+		notificationGroup.DELETE("/:id", notificationHandler.DeleteNotificationRule)
 	}
 
 	s.router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
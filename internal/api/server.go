@@ -3,11 +3,16 @@ package api
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/gin-gonic/gin"
 	goRedis "github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/events"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/messaging/factory"
 	"github.com/siluk00/task_scheduler/internal/repository"
 	"github.com/siluk00/task_scheduler/internal/repository/redis"
+	"github.com/siluk00/task_scheduler/internal/secrets"
 	"github.com/siluk00/task_scheduler/pkg/config"
 )
 
@@ -15,6 +20,19 @@ type Server struct {
 	config   *config.AppConfig
 	router   *gin.Engine
 	taskRepo repository.TaskHandler
+	runRepo  repository.RunHandler
+	// nil when no secrets master key is configured
+	secretRepo     repository.SecretHandler
+	deadLetterRepo repository.DeadLetterHandler
+	consumerRepo   repository.ConsumerHandler
+	// the notification rules and the delivery log
+	notificationRepo repository.NotificationHandler
+	// the rate limits the workers enforce
+	rateLimitRepo repository.RateLimitHandler
+	// publishes the replayed dead letters, nil when the broker is misconfigured
+	broker messaging.Broker
+	// publishes the task events, nil without a broker
+	events *events.Publisher
 	//Adicionar serviços/repositorios aqui
 }
 
@@ -42,6 +60,37 @@ func NewServer(cfg *config.AppConfig) (*Server, error) {
 		config:   cfg,
 		router:   gin.Default(),
 		taskRepo: taskRepo,
+		runRepo:  redis.NewRunRepository(rdb),
+
+		deadLetterRepo: redis.NewDeadLetterRepository(rdb),
+		consumerRepo:   redis.NewConsumerRepository(rdb),
+
+		notificationRepo: redis.NewNotificationRepository(rdb),
+		rateLimitRepo:    redis.NewRateLimitRepository(rdb),
+	}
+
+	if cfg.SecretsMasterKey != "" {
+		cipher, err := secrets.NewCipher(cfg.SecretsMasterKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create secrets cipher: %w", err)
+		}
+		server.secretRepo = redis.NewSecretRepository(rdb, cipher)
+	} else {
+		log.Println("SECRETS_MASTER_KEY not set, secrets store disabled")
+	}
+
+	// the server starts while the broker is unreachable, the broker keeps dialing in the background
+	if broker, err := factory.NewConnectingBroker(cfg, rdb); err != nil {
+		log.Printf("Message broker unavailable, dead letters can't be replayed and no events are published: %v", err)
+	} else {
+		server.broker = broker
+		server.events = events.NewPublisher(broker)
+		go func() {
+			// waits for the broker to connect
+			if err := server.events.Declare(context.Background()); err != nil {
+				log.Printf("Failed to declare the events exchange: %v", err)
+			}
+		}()
 	}
 
 	server.setupRoutes()
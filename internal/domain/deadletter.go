@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"time"
+)
+
+// Why a message was dead lettered
+const (
+	// The message body is not a task
+	DeadLetterMalformed = "malformed"
+	// Processing the task failed in every delivery attempt
+	DeadLetterMaxAttempts = "max_attempts"
+	// The broker dead lettered a rejected message
+	DeadLetterRejected = "rejected"
+)
+
+// A message of the task queue that could not be processed
+type DeadLetter struct {
+	ID string `json:"id"`
+	// Empty when the body couldn't be read as a task
+	TaskID   string `json:"task_id,omitempty"`
+	Queue    string `json:"queue"`
+	Reason   string `json:"reason"`
+	Error    string `json:"error,omitempty"`
+	Attempts int    `json:"attempts"`
+	// The message as it was published, replaying it publishes it again
+	Body           string            `json:"body"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	DeadLetteredAt time.Time         `json:"dead_lettered_at"`
+}
+
+// Creates a DeadLetter with a new sortable ID
+func NewDeadLetter(body []byte, headers map[string]string) *DeadLetter {
+	now := time.Now()
+
+	return &DeadLetter{
+		ID:             now.UTC().Format("20060102T150405") + "-" + randomHex(4),
+		Body:           string(body),
+		Headers:        headers,
+		DeadLetteredAt: now,
+	}
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"time"
+)
+
+// The lifecycle events published for other services to react to
+type EventType string
+
+const (
+	EventTaskCreated  EventType = "task.created"
+	EventTaskUpdated  EventType = "task.updated"
+	EventTaskDeleted  EventType = "task.deleted"
+	EventRunStarted   EventType = "run.started"
+	EventRunSucceeded EventType = "run.succeeded"
+	EventRunFailed    EventType = "run.failed"
+	// The run took longer than the SLA of the task, published after it finished
+	EventRunSLAMissed EventType = "run.sla_missed"
+)
+
+// Version of the Event schema written by this code,
+// it changes only when a field is removed or changes meaning
+const EventVersion = 1
+
+// The body of the lifecycle event messages, published with the type as routing key
+type Event struct {
+	ID         string    `json:"id"`
+	Version    int       `json:"version"`
+	Type       EventType `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	TaskID     string    `json:"task_id"`
+	// The task after the change, the deleted task for task.deleted
+	Task *Task `json:"task,omitempty"`
+	// The run, only in the run events
+	Run *TaskRun `json:"run,omitempty"`
+	// Of the task message that started the run
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// Creates a task event with a snapshot of the task
+func NewTaskEvent(eventType EventType, task *Task) *Event {
+	snapshot := *task
+
+	return &Event{
+		ID:         randomHex(8),
+		Version:    EventVersion,
+		Type:       eventType,
+		OccurredAt: time.Now(),
+		TaskID:     task.ID,
+		Task:       &snapshot,
+	}
+}
+
+// Creates a run event with a snapshot of the run, run.succeeded or run.failed
+// are chosen by the status of a finished run
+func NewRunEvent(task *Task, run *TaskRun) *Event {
+	eventType := EventRunStarted
+	switch run.Status {
+	case TaskStatusCompleted:
+		eventType = EventRunSucceeded
+	case TaskStatusFailed:
+		eventType = EventRunFailed
+	}
+
+	event := NewTaskEvent(eventType, task)
+	snapshot := *run
+	event.Run = &snapshot
+	event.CorrelationID = run.CorrelationID
+	return event
+}
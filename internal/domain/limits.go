@@ -0,0 +1,51 @@
+package domain
+
+// Names of the limits recorded on a run when the process was killed by one of them.
+// The other limits make system calls fail inside the process, which can't be told apart
+// from any other failure.
+const (
+	LimitCPUTime  = "cpu_time"
+	LimitFileSize = "file_size"
+)
+
+// Resource limits applied to the process of a task with setrlimit.
+// A zero value means no limit.
+type ResourceLimits struct {
+	CPUTimeSeconds    uint64 `json:"cpu_time_seconds,omitempty"`
+	AddressSpaceBytes uint64 `json:"address_space_bytes,omitempty"`
+	OpenFiles         uint64 `json:"open_files,omitempty"`
+	// Counted per user by the kernel, so it includes the other processes of the same UID
+	Processes uint64 `json:"processes,omitempty"`
+	// Largest file the process can write
+	FileSizeBytes uint64 `json:"file_size_bytes,omitempty"`
+}
+
+// Returns the limits of l, using the defaults for the ones l doesn't set
+func (l *ResourceLimits) WithDefaults(defaults ResourceLimits) ResourceLimits {
+	if l == nil {
+		return defaults
+	}
+
+	merged := *l
+	if merged.CPUTimeSeconds == 0 {
+		merged.CPUTimeSeconds = defaults.CPUTimeSeconds
+	}
+	if merged.AddressSpaceBytes == 0 {
+		merged.AddressSpaceBytes = defaults.AddressSpaceBytes
+	}
+	if merged.OpenFiles == 0 {
+		merged.OpenFiles = defaults.OpenFiles
+	}
+	if merged.Processes == 0 {
+		merged.Processes = defaults.Processes
+	}
+	if merged.FileSizeBytes == 0 {
+		merged.FileSizeBytes = defaults.FileSizeBytes
+	}
+	return merged
+}
+
+// Checks if no limit is set
+func (l ResourceLimits) IsZero() bool {
+	return l == ResourceLimits{}
+}
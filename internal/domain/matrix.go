@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Most parameter sets a matrix may have
+const MaxMatrixSize = 1000
+
+var ErrInvalidMatrix = errors.New("invalid matrix")
+
+// Runs the command of a task once per parameter set, each in a child task "<task>-<n>"
+// getting the parameters as environment variables. The run of the task finishes
+// once all the children did.
+type Matrix struct {
+	Params []map[string]string `json:"params"`
+	// Children running at once, all of them when 0
+	MaxParallel int `json:"max_parallel,omitempty"`
+	// Failed children tolerated, the run fails when more fail and the children not started yet are skipped
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+}
+
+// The progress of the children of a run of a matrix task
+type MatrixGroup struct {
+	TaskID    string `json:"task_id"`
+	RunID     string `json:"run_id"`
+	Total     int    `json:"total"`
+	Started   int    `json:"started"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+	// Not started because too many children failed
+	Skipped int `json:"skipped"`
+}
+
+// The ID of the child task of the i-th parameter set (from 0)
+func MatrixChildID(taskID string, i int) string {
+	return taskID + "-" + strconv.Itoa(i+1)
+}
+
+// Children started at once when the run starts
+func (m *Matrix) Parallelism() int {
+	if m.MaxParallel > 0 && m.MaxParallel < len(m.Params) {
+		return m.MaxParallel
+	}
+	return len(m.Params)
+}
+
+func (m *Matrix) Validate() error {
+	if len(m.Params) == 0 || len(m.Params) > MaxMatrixSize || m.MaxParallel < 0 || m.FailureThreshold < 0 {
+		return ErrInvalidMatrix
+	}
+	for _, params := range m.Params {
+		for name := range params {
+			if !IsValidSecretName(name) {
+				return ErrInvalidMatrix
+			}
+		}
+	}
+	return nil
+}
+
+// Reports if every child finished or was skipped
+func (g *MatrixGroup) Finished() bool {
+	return g.Completed+g.Failed+g.Skipped >= g.Total
+}
+
+// Reports if more children failed than the matrix tolerates
+func (g *MatrixGroup) ExceededFailures(m *Matrix) bool {
+	return g.Failed > m.FailureThreshold
+}
@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Version of the TaskMessage schema written by this code
+const TaskMessageVersion = 1
+
+var ErrInvalidTaskMessage = errors.New("invalid task message")
+
+// The body of the messages of the task queue. Only the task ID travels, the worker
+// reads the current task from the repository when the message arrives.
+type TaskMessage struct {
+	Version int    `json:"version"`
+	TaskID  string `json:"task_id"`
+	// The run this delivery creates, a redelivery gets a new one
+	RunID string `json:"run_id"`
+	// Starts at 1 and grows every time a failed message is published again
+	Attempt int `json:"attempt"`
+	// Shared by every delivery and run coming from the same request
+	CorrelationID string    `json:"correlation_id"`
+	EnqueuedAt    time.Time `json:"enqueued_at"`
+	// The scheduled time the message was published ahead for, zero when it was published when due
+	DueAt time.Time `json:"due_at,omitempty"`
+	// Trace context and other propagated headers, e.g. traceparent
+	Headers map[string]string `json:"headers,omitempty"`
+	// The "<task>/<run>" whose end triggered this run, empty for scheduled runs
+	TriggeredBy string `json:"triggered_by,omitempty"`
+	// Passed to the command as environment variables
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Creates the message of the first attempt to run the task
+func NewTaskMessage(taskID string) *TaskMessage {
+	return &TaskMessage{
+		Version:       TaskMessageVersion,
+		TaskID:        taskID,
+		RunID:         NewRunID(),
+		Attempt:       1,
+		CorrelationID: randomHex(8),
+		EnqueuedAt:    time.Now(),
+	}
+}
+
+// Returns a copy to publish again as the given attempt, with a new run ID
+func (m *TaskMessage) Redeliver(attempt int) *TaskMessage {
+	next := *m
+	next.Version = TaskMessageVersion
+	next.RunID = NewRunID()
+	next.Attempt = attempt
+	next.EnqueuedAt = time.Now()
+	if next.CorrelationID == "" {
+		next.CorrelationID = randomHex(8)
+	}
+	return &next
+}
+
+// Reads a task message. Messages from before the envelope carried the whole task,
+// they are read as version 0 with the ID of the task.
+func ParseTaskMessage(body []byte) (*TaskMessage, error) {
+	var msg struct {
+		TaskMessage
+		// the ID of a task published as the message body
+		LegacyID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTaskMessage, err)
+	}
+
+	if msg.Version > TaskMessageVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidTaskMessage, msg.Version)
+	}
+
+	if msg.Version == 0 {
+		msg.TaskID = msg.LegacyID
+	}
+	if msg.TaskID == "" {
+		return nil, fmt.Errorf("%w: missing task ID", ErrInvalidTaskMessage)
+	}
+	if msg.Attempt < 1 {
+		msg.Attempt = 1
+	}
+
+	return &msg.TaskMessage, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Sent by `taskctl notify test` to check a webhook or the email recipients
+	EventNotificationTest EventType = "notification.test"
+	// An email summing up the notifications of a rule that came at once
+	EventNotificationDigest EventType = "notification.digest"
+)
+
+var (
+	ErrInvalidNotificationURL    = errors.New("invalid notification URL, it must be http or https")
+	ErrInvalidNotificationEmail  = errors.New("invalid notification email address")
+	ErrInvalidNotificationTarget = errors.New("a notification rule has either a URL or email recipients")
+	ErrInvalidNotificationEvents = errors.New("invalid notification events")
+
+	notificationEvents = map[EventType]bool{
+		EventTaskCreated:  true,
+		EventTaskUpdated:  true,
+		EventTaskDeleted:  true,
+		EventRunStarted:   true,
+		EventRunSucceeded: true,
+		EventRunFailed:    true,
+		EventRunSLAMissed: true,
+	}
+)
+
+// A webhook POSTed to URL, or an email sent to the Email recipients, on the selected events
+// of a task, or of every task when TaskID is empty
+type NotificationRule struct {
+	ID string `json:"id"`
+	// Empty for a global rule
+	TaskID string      `json:"task_id,omitempty"`
+	URL    string      `json:"url,omitempty"`
+	Email  []string    `json:"email,omitempty"`
+	Events []EventType `json:"events"`
+	// Key of the HMAC-SHA256 signature of the payload, never returned by the API
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *NotificationRule) Validate() error {
+	if r.URL != "" && len(r.Email) > 0 {
+		return ErrInvalidNotificationTarget
+	}
+	if len(r.Email) > 0 {
+		if err := ValidateNotificationEmail(r.Email); err != nil {
+			return err
+		}
+	} else if err := ValidateNotificationURL(r.URL); err != nil {
+		return err
+	}
+
+	if len(r.Events) == 0 {
+		return ErrInvalidNotificationEvents
+	}
+	for _, event := range r.Events {
+		if !notificationEvents[event] {
+			return ErrInvalidNotificationEvents
+		}
+	}
+
+	if r.TaskID != "" && !isValidTaskId(r.TaskID) {
+		return ErrInvalidTaskId
+	}
+
+	return nil
+}
+
+// Webhooks are absolute http or https URLs
+func ValidateNotificationURL(raw string) error {
+	if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidNotificationURL
+	}
+	return nil
+}
+
+// Email recipients are plain addresses, e.g. ops@example.com
+func ValidateNotificationEmail(addresses []string) error {
+	for _, address := range addresses {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil || parsed.Address != address {
+			return ErrInvalidNotificationEmail
+		}
+	}
+	return nil
+}
+
+// Where the notifications of the rule go, the URL or a mailto URL with the recipients
+func (r *NotificationRule) Target() string {
+	if len(r.Email) > 0 {
+		return "mailto:" + strings.Join(r.Email, ",")
+	}
+	return r.URL
+}
+
+// Reports if the rule wants the event
+func (r *NotificationRule) Matches(event *Event) bool {
+	if r.TaskID != "" && r.TaskID != event.TaskID {
+		return false
+	}
+	for _, eventType := range r.Events {
+		if eventType == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// The JSON body POSTed to the webhooks
+type NotificationPayload struct {
+	Event  EventType  `json:"event"`
+	TaskID string     `json:"task_id"`
+	Status TaskStatus `json:"status,omitempty"`
+	Task   *Task      `json:"task,omitempty"`
+	Run    *TaskRun   `json:"run,omitempty"`
+	// The end of the output of the run, only in the run events
+	OutputTail *RunOutput `json:"output_tail,omitempty"`
+	OccurredAt time.Time  `json:"occurred_at"`
+}
+
+// A webhook or an email sent for a rule, with the result of its last attempt
+type NotificationDelivery struct {
+	ID     string `json:"id"`
+	RuleID string `json:"rule_id,omitempty"`
+	// The webhook URL, or a mailto URL for the emails
+	URL    string    `json:"url"`
+	Event  EventType `json:"event"`
+	TaskID string    `json:"task_id,omitempty"`
+	RunID  string    `json:"run_id,omitempty"`
+	// Attempts made, the failed ones are retried with backoff
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	CreatedAt  time.Time `json:"created_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Creates a NotificationRule with a new ID
+func NewNotificationRule() *NotificationRule {
+	return &NotificationRule{
+		ID:        randomHex(8),
+		CreatedAt: time.Now(),
+	}
+}
+
+// Creates the delivery of the payload to the target of the rule, with a new sortable ID
+func NewNotificationDelivery(rule *NotificationRule, payload *NotificationPayload) *NotificationDelivery {
+	now := time.Now()
+
+	delivery := &NotificationDelivery{
+		ID:        now.UTC().Format("20060102T150405") + "-" + randomHex(4),
+		RuleID:    rule.ID,
+		URL:       rule.Target(),
+		Event:     payload.Event,
+		TaskID:    payload.TaskID,
+		CreatedAt: now,
+	}
+	if payload.Run != nil {
+		delivery.RunID = payload.Run.ID
+	}
+	return delivery
+}
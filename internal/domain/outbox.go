@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"time"
+)
+
+// A message recorded in the same transaction as the change that causes it,
+// the outbox relay publishes it afterwards and deletes it once the broker confirms it
+type OutboxMessage struct {
+	ID         string            `json:"id"`
+	Exchange   string            `json:"exchange"`
+	RoutingKey string            `json:"routing_key"`
+	Body       []byte            `json:"body"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Mandatory  bool              `json:"mandatory,omitempty"`
+	// The broker delivers the message at this time, now if it is zero or past
+	DeliverAt time.Time `json:"deliver_at,omitempty"`
+	// The task whose change recorded the message
+	TaskID    string    `json:"task_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Creates an OutboxMessage with a new sortable ID
+func NewOutboxMessage(exchange, routingKey string, body []byte) *OutboxMessage {
+	now := time.Now()
+
+	return &OutboxMessage{
+		ID:         now.UTC().Format("20060102T150405") + "-" + randomHex(4),
+		Exchange:   exchange,
+		RoutingKey: routingKey,
+		Body:       body,
+		CreatedAt:  now,
+	}
+}
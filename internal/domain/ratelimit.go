@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRateLimit = errors.New("invalid rate limit")
+
+// Caps the runs of the tasks of a queue or with a label across every worker: how many of them run
+// at once and how many start per minute. A task matching several limits waits for room in all of them.
+type RateLimit struct {
+	Name string `json:"name"`
+	// The limited tasks are those of the queue or those with the label, as key=value
+	Queue string `json:"queue,omitempty"`
+	Label string `json:"label,omitempty"`
+	// Runs at once, no cap when 0
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+	// Runs started per minute, no limit when 0. The starts come out of a bucket
+	// holding a minute of them, so that many may start at once after a quiet minute.
+	StartsPerMinute int       `json:"starts_per_minute,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func (l *RateLimit) Validate() error {
+	if !IsValidQueueName(l.Name) {
+		return ErrInvalidRateLimit
+	}
+
+	// exactly one of queue and label
+	if (l.Queue == "") == (l.Label == "") {
+		return ErrInvalidRateLimit
+	}
+	if l.Queue != "" && !IsValidQueueName(l.Queue) {
+		return ErrInvalidRateLimit
+	}
+	if key, _, ok := strings.Cut(l.Label, "="); l.Label != "" && (!ok || key == "") {
+		return ErrInvalidRateLimit
+	}
+
+	if l.MaxConcurrent < 0 || l.StartsPerMinute < 0 || (l.MaxConcurrent == 0 && l.StartsPerMinute == 0) {
+		return ErrInvalidRateLimit
+	}
+	return nil
+}
+
+// Reports if the limit applies to the task, queue is the one the task runs in
+func (l *RateLimit) Matches(task *Task, queue string) bool {
+	if l.Queue != "" {
+		return l.Queue == queue
+	}
+	key, value, _ := strings.Cut(l.Label, "=")
+	labelValue, ok := task.Labels[key]
+	return ok && labelValue == value
+}
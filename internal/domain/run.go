@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The output streams of an execution
+type OutputStream string
+
+const (
+	OutputStdout OutputStream = "stdout"
+	OutputStderr OutputStream = "stderr"
+)
+
+// A single execution of a task
+type TaskRun struct {
+	ID         string     `json:"id"`
+	TaskID     string     `json:"task_id"`
+	Status     TaskStatus `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at,omitempty"`
+	ExitCode   int        `json:"exit_code"`
+	Error      string     `json:"error,omitempty"`
+	// Set when the output went over the configured size cap
+	OutputTruncated bool `json:"output_truncated,omitempty"`
+	// The structured result parsed from stdout when the task uses a JSON result
+	Result json.RawMessage `json:"result,omitempty"`
+	// The resource limit the process hit, if any
+	LimitExceeded string         `json:"limit_exceeded,omitempty"`
+	Usage         *ResourceUsage `json:"usage,omitempty"`
+	// The labels of the task when the run started
+	Labels map[string]string `json:"labels,omitempty"`
+	// Of the task message that started the run
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// The "<task>/<run>" whose end triggered this run, empty for scheduled runs
+	TriggeredBy string `json:"triggered_by,omitempty"`
+	// The result of every step of a multi-step task
+	Steps []StepResult `json:"steps,omitempty"`
+	// The children of a run of a matrix task, as of its start and its end
+	Matrix *MatrixGroup `json:"matrix,omitempty"`
+}
+
+// The captured output of a run
+type RunOutput struct {
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+}
+
+// A piece of output as it was written by the process.
+// ID is the position of the chunk, used to resume streaming.
+type OutputChunk struct {
+	ID     string       `json:"id"`
+	Stream OutputStream `json:"stream"`
+	Data   string       `json:"data"`
+}
+
+// Returns a new sortable run ID
+func NewRunID() string {
+	return time.Now().UTC().Format("20060102T150405") + "-" + randomHex(4)
+}
+
+// Creates a running TaskRun of the task with a new sortable ID
+func NewTaskRun(task *Task) *TaskRun {
+	now := time.Now()
+
+	return &TaskRun{
+		ID:        NewRunID(),
+		TaskID:    task.ID,
+		Status:    TaskStatusRunning,
+		StartedAt: now,
+		Labels:    task.Labels,
+	}
+}
+
+// Reports if the finished run took longer than the SLA of the task
+func (r *TaskRun) MissedSLA(task *Task) bool {
+	return task.SLASeconds > 0 && r.FinishedAt.Sub(r.StartedAt) > time.Duration(task.SLASeconds)*time.Second
+}
+
+// Marks the run as finished with the given status
+func (r *TaskRun) Finish(status TaskStatus, exitCode int, err error) {
+	r.Status = status
+	r.ExitCode = exitCode
+	r.FinishedAt = time.Now()
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
@@ -0,0 +1,232 @@
+package domain
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	// the zones don't depend on the tz database of the host
+	_ "time/tzdata"
+)
+
+// Days searched for the next occurrence of a schedule, enough to reach a 29th of February
+const maxScheduleDays = 5 * 366
+
+var (
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	ErrInvalidTimezone = errors.New("invalid timezone")
+
+	scheduleMacros = map[string]string{
+		"@hourly":   "0 * * * *",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@weekly":   "0 0 * * 0",
+		"@monthly":  "0 0 1 * *",
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+	}
+)
+
+// A cron expression: minute, hour, day of the month, month and day of the week (0 or 7 is Sunday).
+// Each field is *, a value, a range like 1-5 or a list of them, a step like */15 or 8-18/2 may follow.
+// When both days are restricted a day matching either of them matches, as in cron.
+type Schedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// the day of the month or of the week is *
+	anyDay, anyWeekday bool
+	// neither the minute nor the hour is *, the time repeated when the clocks go back runs once
+	fixedTime bool
+}
+
+// Parses a cron expression or one of the macros @hourly, @daily, @weekly, @monthly and @yearly
+func ParseSchedule(expr string) (*Schedule, error) {
+	if macro, ok := scheduleMacros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, ErrInvalidSchedule
+	}
+
+	var s Schedule
+	var err error
+	if s.minutes, err = parseScheduleField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if s.hours, err = parseScheduleField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if s.days, err = parseScheduleField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if s.months, err = parseScheduleField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if s.weekdays, err = parseScheduleField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+	}
+	// as in cron */2 counts as * too
+	s.anyDay = strings.HasPrefix(fields[2], "*")
+	s.anyWeekday = strings.HasPrefix(fields[4], "*")
+	s.fixedTime = !strings.HasPrefix(fields[0], "*") && !strings.HasPrefix(fields[1], "*")
+
+	// e.g. the 30th of February
+	if s.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.UTC).IsZero() {
+		return nil, ErrInvalidSchedule
+	}
+	return &s, nil
+}
+
+// Parses a field of a cron expression into the set of its values between min and max
+func parseScheduleField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, ErrInvalidSchedule
+			}
+			step = n
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(first); err != nil {
+				return 0, ErrInvalidSchedule
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(last); err != nil {
+					return 0, ErrInvalidSchedule
+				}
+			} else if hasStep {
+				// 5/15 is 5-max/15
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, ErrInvalidSchedule
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// Returns the first occurrence after t of the schedule in the wall clock of loc, zero if there is none.
+// A time skipped when the clocks go forward runs as much later as they went forward, so 02:30 on
+// a day they jump from 02:00 to 03:00 runs at 03:30. A time repeated when the clocks go back runs
+// both times, unless neither the minute nor the hour is * (e.g. 30 1 * * *), then only the first time.
+func (s *Schedule) Next(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	// the days are counted on the calendar, away from the transitions of loc
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+	for range maxScheduleDays {
+		if s.matchesDay(day) {
+			if next := s.nextInDay(day, t, loc); !next.IsZero() {
+				return next
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchesDay(day time.Time) bool {
+	if s.months&(1<<int(day.Month())) == 0 {
+		return false
+	}
+	inDays := s.days&(1<<day.Day()) != 0
+	inWeekdays := s.weekdays&(1<<int(day.Weekday())) != 0
+	if s.anyDay || s.anyWeekday {
+		return inDays && inWeekdays
+	}
+	return inDays || inWeekdays
+}
+
+// The earliest time of the schedule on the day after t. The times are tried in the order of the
+// wall clock, which is also their order but for those skipped by the clocks going forward and the
+// second time of those repeated when they go back, so the earliest is only known at another time.
+func (s *Schedule) nextInDay(day, t time.Time, loc *time.Location) time.Time {
+	var next time.Time
+	for hour := range 24 {
+		if s.hours&(1<<hour) == 0 {
+			continue
+		}
+		for minute := range 60 {
+			if s.minutes&(1<<minute) == 0 {
+				continue
+			}
+
+			times, skipped := resolveWallClock(day.Add(time.Duration(hour)*time.Hour+time.Duration(minute)*time.Minute), loc)
+			if s.fixedTime {
+				times = times[:1]
+			}
+			for _, at := range times {
+				if at.After(t) && (next.IsZero() || at.Before(next)) {
+					next = at
+				}
+			}
+			if !next.IsZero() && !skipped && len(times) == 1 {
+				return next
+			}
+		}
+	}
+	return next
+}
+
+// Returns the times the wall clock of loc shows the time of day of wall, given in UTC, in order:
+// two when the clocks go back over it. When they skip it the time is moved forward as much as they
+// did, which is reported.
+func resolveWallClock(wall time.Time, loc *time.Location) ([]time.Time, bool) {
+	// the offsets of loc around the wall time, they differ when the clock changes
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(24 * time.Hour).In(loc).Zone()
+
+	var times []time.Time
+	for _, offset := range []int{before, after} {
+		at := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if !sameWallClock(at, wall) || (len(times) == 1 && times[0].Equal(at)) {
+			continue
+		}
+		times = append(times, at)
+	}
+	if len(times) == 2 && times[1].Before(times[0]) {
+		times[0], times[1] = times[1], times[0]
+	}
+	if len(times) > 0 {
+		return times, false
+	}
+	// skipped, the offset before the change moves it forward as much as the clock did
+	return []time.Time{wall.Add(-time.Duration(before) * time.Second).In(loc)}, true
+}
+
+func sameWallClock(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd && a.Hour() == b.Hour() && a.Minute() == b.Minute() && a.Second() == b.Second()
+}
+
+// Loads the zone of an IANA name like America/Sao_Paulo, UTC when it is empty.
+// The zone of the host, Local, isn't accepted as it differs between machines.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	return loc, nil
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// A named credential stored encrypted and injected into the environment
+// of the tasks that reference it. Value is never returned by the API.
+type Secret struct {
+	Name      string    `json:"name"`
+	Value     string    `json:"value,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var (
+	ErrInvalidSecretName  = errors.New("invalid secret name")
+	ErrInvalidSecretValue = errors.New("invalid secret value")
+
+	// Secret names become environment variable names, so they follow the same rules
+	secretNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+func (s *Secret) Validate() error {
+	if !IsValidSecretName(s.Name) {
+		return ErrInvalidSecretName
+	}
+
+	if s.Value == "" {
+		return ErrInvalidSecretValue
+	}
+
+	return nil
+}
+
+// Checks if name can be used as a secret name and environment variable
+func IsValidSecretName(name string) bool {
+	return len(name) <= 128 && secretNameRegexp.MatchString(name)
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+type StepStatus string
+
+const (
+	StepStatusPending   StepStatus = "pending"
+	StepStatusRunning   StepStatus = "running"
+	StepStatusCompleted StepStatus = "completed"
+	StepStatusFailed    StepStatus = "failed"
+	// Not run because an earlier step failed
+	StepStatusSkipped StepStatus = "skipped"
+)
+
+var ErrInvalidSteps = errors.New("invalid steps")
+
+// A command of a multi-step task, the steps run in order in the same worker
+type Step struct {
+	// Shown in the run, "step-<n>" when empty
+	Name    string `json:"name,omitempty"`
+	Command string `json:"command"`
+	// Seconds the step may run before it is killed, 0 means no timeout
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// A failure of the step doesn't stop the run nor fail it
+	ContinueOnError bool `json:"continue_on_error,omitempty"`
+}
+
+// The result of a step in a run
+type StepResult struct {
+	Name       string     `json:"name"`
+	Status     StepStatus `json:"status"`
+	StartedAt  time.Time  `json:"started_at,omitempty"`
+	FinishedAt time.Time  `json:"finished_at,omitempty"`
+	ExitCode   int        `json:"exit_code"`
+	Error      string     `json:"error,omitempty"`
+	// The end of the output the step wrote
+	Output *RunOutput     `json:"output,omitempty"`
+	Usage  *ResourceUsage `json:"usage,omitempty"`
+}
+
+// The name of the i-th step (from 0) in the runs
+func (s *Step) DisplayName(i int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return "step-" + strconv.Itoa(i+1)
+}
+
+func (s *Step) Timeout() time.Duration {
+	return time.Duration(s.TimeoutSeconds) * time.Second
+}
+
+func validateSteps(steps []Step) error {
+	for _, step := range steps {
+		if step.Command == "" || step.TimeoutSeconds < 0 || len(step.Name) > 100 {
+			return ErrInvalidSteps
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Rules deciding if a run succeeded. Without them only exit code 0 is a success.
+type SuccessCriteria struct {
+	// Exit codes considered successful, defaults to 0
+	AcceptedExitCodes []int `json:"accepted_exit_codes,omitempty"`
+	// Regexes that must match stdout or stderr
+	RequiredOutput []string `json:"required_output,omitempty"`
+	// Regexes that must not match stdout nor stderr
+	ForbiddenOutput []string `json:"forbidden_output,omitempty"`
+	// The last non empty line of stdout must be JSON, it is stored as the run result
+	JSONResult bool `json:"json_result,omitempty"`
+}
+
+var (
+	ErrInvalidSuccessCriteria = errors.New("invalid success criteria")
+	ErrUnacceptedExitCode     = errors.New("exit code not accepted")
+	ErrRequiredOutputMissing  = errors.New("required output missing")
+	ErrForbiddenOutput        = errors.New("forbidden output found")
+	ErrInvalidJSONResult      = errors.New("invalid JSON result")
+)
+
+func (s *SuccessCriteria) Validate() error {
+	for _, expr := range append(slices.Clone(s.RequiredOutput), s.ForbiddenOutput...) {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSuccessCriteria, err)
+		}
+	}
+
+	return nil
+}
+
+// Checks the result of a process against the criteria. A nil criteria only accepts exit code 0.
+// Returns the JSON result when JSONResult is set, or an error describing why the run failed.
+func (s *SuccessCriteria) Evaluate(exitCode int, stdout, stderr string) (json.RawMessage, error) {
+	accepted := []int{0}
+	if s != nil && len(s.AcceptedExitCodes) > 0 {
+		accepted = s.AcceptedExitCodes
+	}
+
+	if !slices.Contains(accepted, exitCode) {
+		return nil, fmt.Errorf("%w: %d", ErrUnacceptedExitCode, exitCode)
+	}
+
+	if s == nil {
+		return nil, nil
+	}
+
+	for _, expr := range s.RequiredOutput {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSuccessCriteria, err)
+		}
+		if !re.MatchString(stdout) && !re.MatchString(stderr) {
+			return nil, fmt.Errorf("%w: %s", ErrRequiredOutputMissing, expr)
+		}
+	}
+
+	for _, expr := range s.ForbiddenOutput {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSuccessCriteria, err)
+		}
+		if re.MatchString(stdout) || re.MatchString(stderr) {
+			return nil, fmt.Errorf("%w: %s", ErrForbiddenOutput, expr)
+		}
+	}
+
+	if !s.JSONResult {
+		return nil, nil
+	}
+
+	line := lastLine(stdout)
+	if !json.Valid([]byte(line)) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidJSONResult, line)
+	}
+
+	return json.RawMessage(line), nil
+}
+
+// Returns the last non empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\r\n\t "), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -3,16 +3,36 @@ package domain
 import (
 	"errors"
 	"regexp"
+	"strings"
 	"time"
 )
 
 type TaskStatus string
 
 const (
-	TaskStatusPending   TaskStatus = "pending"
+	TaskStatusPending TaskStatus = "pending"
+	// Published with a delay, waiting in the broker for its scheduled time
+	TaskStatusQueued    TaskStatus = "queued"
 	TaskStatusRunning   TaskStatus = "running"
 	TaskStatusCompleted TaskStatus = "completed"
 	TaskStatusFailed    TaskStatus = "failed"
+	// Only of runs, an occurrence not run because of the concurrency policy of the task
+	TaskStatusSkipped TaskStatus = "skipped"
+)
+
+// What happens to a run of a task that comes while another run of the task is running.
+// The worker applies it when it takes the message of the run, see the consumer of the worker.
+type ConcurrencyPolicy string
+
+const (
+	// Both runs go on at once
+	ConcurrencyAllow ConcurrencyPolicy = "allow"
+	// The new run is skipped and recorded as such
+	ConcurrencyForbid ConcurrencyPolicy = "forbid"
+	// The running run is cancelled and the new one starts once it stopped
+	ConcurrencyReplace ConcurrencyPolicy = "replace"
+	// The new run waits for the running one to finish
+	ConcurrencyQueue ConcurrencyPolicy = "queue"
 )
 
 type Task struct {
@@ -24,21 +44,77 @@ type Task struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 	ScheduledAt time.Time  `json:"scheduled_at,omitempty"`
+	// Names of the secrets injected as environment variables when the task runs
+	Secrets []string `json:"secrets,omitempty"`
+	// Rules deciding if a run succeeded, by default only exit code 0 does
+	Success *SuccessCriteria `json:"success,omitempty"`
+	// Resource limits of the process, unset ones use the worker defaults
+	Limits *ResourceLimits `json:"limits,omitempty"`
+	// Free form key/value pairs used to group tasks, e.g. team=reports
+	Labels map[string]string `json:"labels,omitempty"`
+	// Task queue the task is published to, only the workers consuming it run the task.
+	// Empty means the default queue.
+	Queue string `json:"queue,omitempty"`
+	// Seconds a run is expected to finish within, a longer run publishes run.sla_missed
+	SLASeconds int `json:"sla_seconds,omitempty"`
+	// Tasks the worker triggers right after a run of this one succeeds or fails
+	OnSuccess []string `json:"on_success,omitempty"`
+	OnFailure []string `json:"on_failure,omitempty"`
+	// Passes the result and the end of the stdout of the run to the follow-up tasks
+	PassOutput bool `json:"pass_output,omitempty"`
+	// Commands run in order instead of Command, which stays empty
+	Steps []Step `json:"steps,omitempty"`
+	// Runs the command in a child task per parameter set instead of in the task itself
+	Matrix *Matrix `json:"matrix,omitempty"`
+	// The matrix task that spawned this child task
+	Parent string `json:"parent,omitempty"`
+	// Environment variables of the command, the parameter set of a child task
+	Params map[string]string `json:"params,omitempty"`
+	// Named resources, e.g. db-main, no two runs holding the same lock run at once
+	Locks []string `json:"locks,omitempty"`
+	// Empty means allow
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrency_policy,omitempty"`
+	// Cron expression of a recurring task, e.g. "0 2 * * *", see Schedule. When an occurrence
+	// is queued the task is scheduled again at the next one.
+	Schedule string `json:"schedule,omitempty"`
+	// IANA name of the zone of the schedule, e.g. America/Sao_Paulo, UTC when empty
+	Timezone string `json:"timezone,omitempty"`
+	// When the task was last moved to another time or schedule, the occurrences of a recurring
+	// task queued before are dropped
+	RescheduledAt time.Time `json:"rescheduled_at,omitempty"`
 }
 
 var (
 	validStatuses = map[TaskStatus]bool{
 		TaskStatusPending:   true,
+		TaskStatusQueued:    true,
 		TaskStatusRunning:   true,
 		TaskStatusCompleted: true,
 		TaskStatusFailed:    true,
 	}
 
+	validConcurrencyPolicies = map[ConcurrencyPolicy]bool{
+		"":                 true,
+		ConcurrencyAllow:   true,
+		ConcurrencyForbid:  true,
+		ConcurrencyReplace: true,
+		ConcurrencyQueue:   true,
+	}
+
 	ErrInvalidTaskId      = errors.New("invalid task ID")
 	ErrInvalidTaskStatus  = errors.New("invalid task status")
 	ErrInvalidTaskName    = errors.New("invalid task name")
 	ErrInvalidCommand     = errors.New("invalid command")
 	ErrInvalidScheduledAt = errors.New("invalid scheduled time")
+	ErrInvalidLabel       = errors.New("invalid label")
+	ErrInvalidQueue       = errors.New("invalid queue name")
+	ErrInvalidSLA         = errors.New("invalid SLA")
+	ErrInvalidFollowUp    = errors.New("invalid follow-up task")
+	ErrInvalidLock        = errors.New("invalid lock name")
+	ErrInvalidConcurrency = errors.New("invalid concurrency policy")
+	ErrInvalidParam       = errors.New("invalid param name")
+
+	queueNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 	//ErrTaskNotFound = errors.New("task not found")
 	//ErrTaskAlreadyExists = errors.New("task already exists")
 	//ErrTaskCreationFailed = errors.New("task creation failed")
@@ -52,6 +128,22 @@ var (
 	//ErrTaskNameEmpty = errors.New("task name cannot be empty"
 )
 
+// The tasks to trigger after a run of the task finished with the status
+func (t *Task) FollowUps(status TaskStatus) []string {
+	switch status {
+	case TaskStatusCompleted:
+		return t.OnSuccess
+	case TaskStatusFailed:
+		return t.OnFailure
+	}
+	return nil
+}
+
+// A completed or failed task won't run again until it is scheduled again, a skipped run never ran
+func (s TaskStatus) IsFinished() bool {
+	return s == TaskStatusCompleted || s == TaskStatusFailed || s == TaskStatusSkipped
+}
+
 func (t *Task) Validate() error {
 	if t.ID == "" || !isValidTaskId(t.ID) {
 		return ErrInvalidTaskId
@@ -61,10 +153,17 @@ func (t *Task) Validate() error {
 		return ErrInvalidTaskName
 	}
 
-	if t.Command == "" {
+	if t.Command == "" && len(t.Steps) == 0 {
 		return ErrInvalidCommand
 	}
 
+	if t.Command != "" && len(t.Steps) > 0 {
+		return ErrInvalidSteps
+	}
+	if err := validateSteps(t.Steps); err != nil {
+		return err
+	}
+
 	if !validStatuses[t.Status] {
 		return ErrInvalidTaskStatus
 	}
@@ -73,9 +172,88 @@ func (t *Task) Validate() error {
 		return ErrInvalidScheduledAt
 	}
 
+	if t.Schedule != "" {
+		if _, err := ParseSchedule(t.Schedule); err != nil {
+			return err
+		}
+	}
+	if _, err := LoadTimezone(t.Timezone); err != nil {
+		return err
+	}
+
+	for _, name := range t.Secrets {
+		if !IsValidSecretName(name) {
+			return ErrInvalidSecretName
+		}
+	}
+
+	for key := range t.Labels {
+		if key == "" || strings.ContainsAny(key, "=,") {
+			return ErrInvalidLabel
+		}
+	}
+
+	if t.Queue != "" && !IsValidQueueName(t.Queue) {
+		return ErrInvalidQueue
+	}
+
+	for _, name := range t.Locks {
+		if !IsValidLockName(name) {
+			return ErrInvalidLock
+		}
+	}
+
+	if !validConcurrencyPolicies[t.ConcurrencyPolicy] {
+		return ErrInvalidConcurrency
+	}
+
+	if t.SLASeconds < 0 {
+		return ErrInvalidSLA
+	}
+
+	for _, id := range append(append([]string(nil), t.OnSuccess...), t.OnFailure...) {
+		if !isValidTaskId(id) || id == t.ID {
+			return ErrInvalidFollowUp
+		}
+	}
+
+	if t.Matrix != nil {
+		if err := t.Matrix.Validate(); err != nil {
+			return err
+		}
+	}
+	for name := range t.Params {
+		if !IsValidSecretName(name) {
+			return ErrInvalidParam
+		}
+	}
+
+	if t.Success != nil {
+		if err := t.Success.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// The first occurrence of the schedule of the task after the time in its timezone,
+// zero if the task isn't recurring
+func (t *Task) NextRun(after time.Time) (time.Time, error) {
+	if t.Schedule == "" {
+		return time.Time{}, nil
+	}
+	schedule, err := ParseSchedule(t.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := LoadTimezone(t.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return schedule.Next(after, loc), nil
+}
+
 func isValidTaskId(id string) bool {
 	//O pacote regexp é usado para trabalhar com expressões regulares em Go.
 	// A expressão regular `^[a-zA-Z0-9-]+$` verifica se o ID contém apenas letras,
@@ -83,3 +261,18 @@ func isValidTaskId(id string) bool {
 	match, _ := regexp.MatchString(`^[a-zA-Z0-9-]+$`, id)
 	return match
 }
+
+// Reports if runs of the task may run at once
+func (p ConcurrencyPolicy) AllowsOverlap() bool {
+	return p == "" || p == ConcurrencyAllow
+}
+
+// Lock names follow the rules of the queue names, e.g. db-main
+func IsValidLockName(name string) bool {
+	return IsValidQueueName(name)
+}
+
+// Queue names are letters, digits, hyphens and underscores, e.g. gpu-free
+func IsValidQueueName(name string) bool {
+	return len(name) <= 64 && queueNameRegexp.MatchString(name)
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+)
+
+// Ways of grouping the usage summaries
+const (
+	UsageByTask  = "task"
+	UsageByLabel = "label"
+)
+
+// Resources used by a run, read from the rusage of the process
+type ResourceUsage struct {
+	WallTimeMs  int64 `json:"wall_time_ms"`
+	UserCPUMs   int64 `json:"user_cpu_ms"`
+	SystemCPUMs int64 `json:"system_cpu_ms"`
+	MaxRSSKB    int64 `json:"max_rss_kb"`
+}
+
+// The usage of a group of runs. MaxRSSKB is the highest of the group, the others are totals.
+type UsageSummary struct {
+	Key         string `json:"key"`
+	Runs        int    `json:"runs"`
+	Failed      int    `json:"failed"`
+	WallTimeMs  int64  `json:"wall_time_ms"`
+	UserCPUMs   int64  `json:"user_cpu_ms"`
+	SystemCPUMs int64  `json:"system_cpu_ms"`
+	MaxRSSKB    int64  `json:"max_rss_kb"`
+}
+
+// Sums the usage of the runs grouped by task ID or by label.
+// Grouping by label uses "key=value" as the group, a run counts for each of its labels,
+// labelKey restricts it to one label. The most expensive groups by CPU come first.
+func SummarizeUsage(runs []*TaskRun, groupBy, labelKey string) []UsageSummary {
+	groups := make(map[string]*UsageSummary)
+
+	add := func(key string, run *TaskRun) {
+		summary, ok := groups[key]
+		if !ok {
+			summary = &UsageSummary{Key: key}
+			groups[key] = summary
+		}
+
+		summary.Runs++
+		if run.Status == TaskStatusFailed {
+			summary.Failed++
+		}
+		if run.Usage != nil {
+			summary.WallTimeMs += run.Usage.WallTimeMs
+			summary.UserCPUMs += run.Usage.UserCPUMs
+			summary.SystemCPUMs += run.Usage.SystemCPUMs
+			summary.MaxRSSKB = max(summary.MaxRSSKB, run.Usage.MaxRSSKB)
+		}
+	}
+
+	for _, run := range runs {
+		if groupBy != UsageByLabel {
+			add(run.TaskID, run)
+			continue
+		}
+
+		for key, value := range run.Labels {
+			if labelKey == "" || key == labelKey {
+				add(key+"="+value, run)
+			}
+		}
+	}
+
+	summaries := make([]UsageSummary, 0, len(groups))
+	for _, summary := range groups {
+		summaries = append(summaries, *summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		ci := summaries[i].UserCPUMs + summaries[i].SystemCPUMs
+		cj := summaries[j].UserCPUMs + summaries[j].SystemCPUMs
+		if ci != cj {
+			return ci > cj
+		}
+		return strings.Compare(summaries[i].Key, summaries[j].Key) < 0
+	})
+
+	return summaries
+}
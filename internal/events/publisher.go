@@ -0,0 +1,54 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+// Publishes the lifecycle events in the events exchange with the event type as routing key.
+// Events are best effort: a failure is logged and never fails the change that caused it,
+// and a nil Publisher publishes nothing.
+type Publisher struct {
+	broker messaging.Broker
+}
+
+func NewPublisher(broker messaging.Broker) *Publisher {
+	return &Publisher{
+		broker: broker,
+	}
+}
+
+// Declares the topic exchange "tasks.events", subscribers bind their own queues to it
+func (p *Publisher) Declare(ctx context.Context) error {
+	return p.broker.Declare(ctx, messaging.Topology{
+		Exchanges: []messaging.Exchange{
+			{Name: messaging.EventsExchange, Kind: messaging.ExchangeTopic},
+		},
+	})
+}
+
+func (p *Publisher) Publish(ctx context.Context, event *domain.Event) {
+	if p == nil {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal %s event of task %s: %v", event.Type, event.TaskID, err)
+		return
+	}
+
+	// not mandatory, nobody listening is fine
+	err = p.broker.Publish(ctx, messaging.Publishing{
+		Exchange:   messaging.EventsExchange,
+		RoutingKey: string(event.Type),
+		Body:       body,
+	})
+	if err != nil {
+		log.Printf("Failed to publish %s event of task %s: %v", event.Type, event.TaskID, err)
+	}
+}
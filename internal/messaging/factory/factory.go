@@ -0,0 +1,44 @@
+package factory
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/messaging/rabbitmq"
+	"github.com/siluk00/task_scheduler/internal/messaging/redisstream"
+	"github.com/siluk00/task_scheduler/pkg/config"
+)
+
+const (
+	BrokerRabbitMQ = "rabbitmq"
+	BrokerRedis    = "redis"
+)
+
+// Creates the message broker selected in the configuration,
+// the redis client is used by the redis streams broker
+func NewBroker(cfg *config.AppConfig, rdb *redis.Client) (messaging.Broker, error) {
+	switch cfg.MessageBroker {
+	case BrokerRabbitMQ, "":
+		//gets a connection and a channel in rabbitmq
+		broker, err := rabbitmq.NewRabbitMQ(cfg.RedisMQURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to rabbitmq: %v", err.Error())
+		}
+		return broker, nil
+	case BrokerRedis:
+		return redisstream.NewBroker(rdb, time.Duration(cfg.StreamClaimIdleSeconds)*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown message broker %q", cfg.MessageBroker)
+	}
+}
+
+// Creates the message broker like NewBroker, but a rabbitmq broker is returned without waiting
+// for rabbitmq: it reports itself reconnecting and dials in the background until it connects
+func NewConnectingBroker(cfg *config.AppConfig, rdb *redis.Client) (messaging.Broker, error) {
+	if cfg.MessageBroker == BrokerRabbitMQ || cfg.MessageBroker == "" {
+		return rabbitmq.ConnectRabbitMQ(cfg.RedisMQURL), nil
+	}
+	return NewBroker(cfg, rdb)
+}
@@ -0,0 +1,341 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+// An in-process messaging.Broker with the same routing and ack semantics
+// as RabbitMQ, for tests and single process setups. Nothing is persisted.
+type Broker struct {
+	mu        sync.Mutex
+	exchanges map[string]string // name -> kind
+	queues    map[string]*queue
+	bindings  []messaging.Binding
+	closed    bool
+	done      chan struct{}
+}
+
+type queue struct {
+	// messages waiting to be delivered
+	ready []*message
+	// number of delivered messages not acked or nacked yet
+	unacked int
+	// signalled when a message is added to ready
+	notify chan struct{}
+	// where the messages nacked without requeue go
+	deadLetterExchange string
+}
+
+type message struct {
+	broker      *Broker
+	queue       string
+	routingKey  string
+	body        []byte
+	headers     map[string]string
+	redelivered bool
+	once        sync.Once
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		exchanges: make(map[string]string),
+		queues:    make(map[string]*queue),
+		done:      make(chan struct{}),
+	}
+}
+
+func (b *Broker) Declare(ctx context.Context, topology messaging.Topology) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return messaging.ErrClosed
+	}
+
+	for _, exchange := range topology.Exchanges {
+		if kind, ok := b.exchanges[exchange.Name]; ok && kind != exchange.Kind {
+			return fmt.Errorf("exchange %s already declared as %s", exchange.Name, kind)
+		}
+		b.exchanges[exchange.Name] = exchange.Kind
+	}
+
+	for _, q := range topology.Queues {
+		b.queue(q.Name).deadLetterExchange = q.DeadLetterExchange
+	}
+
+	for _, binding := range topology.Bindings {
+		if _, ok := b.exchanges[binding.Exchange]; !ok {
+			return fmt.Errorf("exchange %s not declared", binding.Exchange)
+		}
+		if _, ok := b.queues[binding.Queue]; !ok {
+			return fmt.Errorf("queue %s not declared", binding.Queue)
+		}
+		if !b.hasBinding(binding) {
+			b.bindings = append(b.bindings, binding)
+		}
+	}
+
+	return nil
+}
+
+// Routes the message to every queue bound to the exchange with a matching key.
+// Like RabbitMQ, a message that matches no queue is dropped unless it is mandatory.
+func (b *Broker) Publish(ctx context.Context, msg messaging.Publishing) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return messaging.ErrClosed
+	}
+
+	if delay := messaging.RoundDelay(msg.Delay); delay > 0 {
+		if _, ok := b.exchanges[msg.Exchange]; !ok {
+			return fmt.Errorf("exchange %s not declared", msg.Exchange)
+		}
+
+		msg.Delay, msg.Mandatory = 0, false
+		time.AfterFunc(delay, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if !b.closed {
+				_ = b.route(msg)
+			}
+		})
+		return nil
+	}
+
+	return b.route(msg)
+}
+
+// Adds the message to the matching queues. Must be called with the lock held.
+func (b *Broker) route(msg messaging.Publishing) error {
+	kind, ok := b.exchanges[msg.Exchange]
+	if !ok {
+		return fmt.Errorf("exchange %s not declared", msg.Exchange)
+	}
+
+	routed := false
+	for _, binding := range b.bindings {
+		if binding.Exchange == msg.Exchange && messaging.Matches(kind, binding.RoutingKey, msg.RoutingKey) {
+			routed = true
+			b.enqueue(binding.Queue, &message{
+				broker:     b,
+				queue:      binding.Queue,
+				routingKey: msg.RoutingKey,
+				body:       append([]byte(nil), msg.Body...),
+				headers:    copyHeaders(msg.Headers),
+			}, false)
+		}
+	}
+
+	if !routed && msg.Mandatory {
+		return messaging.ErrUnroutable
+	}
+	return nil
+}
+
+func (b *Broker) Consume(ctx context.Context, name string) (<-chan messaging.Message, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, messaging.ErrClosed
+	}
+	q, ok := b.queues[name]
+	b.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("queue %s not declared", name)
+	}
+
+	out := make(chan messaging.Message)
+	go func() {
+		defer close(out)
+		for {
+			msg := b.next(q)
+			if msg == nil {
+				select {
+				case <-q.notify:
+					continue
+				case <-ctx.Done():
+					return
+				case <-b.done:
+					return
+				}
+			}
+
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				_ = msg.Nack(true)
+				return
+			case <-b.done:
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+	return nil
+}
+
+func (b *Broker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return messaging.StateClosed
+	}
+	return messaging.StateConnected
+}
+
+// Returns the number of messages waiting in the queue and the number delivered but not acked
+func (b *Broker) Stats(name string) (ready, unacked int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		return 0, 0
+	}
+	return len(q.ready), q.unacked
+}
+
+// Takes the next ready message of the queue, nil if there is none
+func (b *Broker) next(q *queue) *message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(q.ready) == 0 {
+		return nil
+	}
+
+	msg := q.ready[0]
+	q.ready = q.ready[1:]
+	q.unacked++
+	return msg
+}
+
+// Adds the message to the queue, at the front when it comes back from a nack.
+// Must be called with the lock held.
+func (b *Broker) enqueue(name string, msg *message, front bool) {
+	q := b.queue(name)
+	if front {
+		q.ready = append([]*message{msg}, q.ready...)
+	} else {
+		q.ready = append(q.ready, msg)
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Returns the queue, creating it if needed. Must be called with the lock held.
+func (b *Broker) queue(name string) *queue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &queue{notify: make(chan struct{}, 1)}
+		b.queues[name] = q
+	}
+	return q
+}
+
+func (b *Broker) hasBinding(binding messaging.Binding) bool {
+	for _, existing := range b.bindings {
+		if existing == binding {
+			return true
+		}
+	}
+	return false
+}
+
+// settle finishes a delivery. A rejected message is requeued when asked or else dead lettered.
+func (b *Broker) settle(msg *message, rejected, requeue bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q := b.queue(msg.queue)
+	q.unacked--
+
+	if b.closed || !rejected {
+		return
+	}
+
+	if requeue {
+		b.enqueue(msg.queue, &message{
+			broker:      b,
+			queue:       msg.queue,
+			routingKey:  msg.routingKey,
+			body:        msg.body,
+			headers:     msg.headers,
+			redelivered: true,
+		}, true)
+		return
+	}
+
+	if q.deadLetterExchange != "" {
+		_ = b.route(messaging.Publishing{
+			Exchange:   q.deadLetterExchange,
+			RoutingKey: msg.routingKey,
+			Body:       msg.body,
+			Headers:    messaging.DeathHeaders(msg.headers, msg.queue),
+		})
+	}
+}
+
+func (m *message) Body() []byte {
+	return m.body
+}
+
+func (m *message) Headers() map[string]string {
+	return copyHeaders(m.headers)
+}
+
+func (m *message) Redelivered() bool {
+	return m.redelivered
+}
+
+func (m *message) Ack() error {
+	return m.settle(false, false)
+}
+
+func (m *message) Nack(requeue bool) error {
+	return m.settle(true, requeue)
+}
+
+func (m *message) settle(rejected, requeue bool) error {
+	settled := false
+	m.once.Do(func() {
+		m.broker.settle(m, rejected, requeue)
+		settled = true
+	})
+
+	if !settled {
+		return fmt.Errorf("message already acknowledged")
+	}
+	return nil
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		copied[k] = v
+	}
+	return copied
+}
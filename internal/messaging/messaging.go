@@ -1 +1,163 @@
 package messaging
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Kinds of exchange, they decide how a routing key selects the bound queues
+const (
+	ExchangeDirect = "direct"
+	ExchangeTopic  = "topic"
+	ExchangeFanout = "fanout"
+)
+
+// Headers set on a message dead lettered by the broker, like RabbitMQ does
+const (
+	HeaderFirstDeathQueue  = "x-first-death-queue"
+	HeaderFirstDeathReason = "x-first-death-reason"
+)
+
+// States of the connection of a broker
+const (
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateClosed       = "closed"
+)
+
+var (
+	ErrClosed = errors.New("broker connection closed")
+	// A mandatory message matched no queue
+	ErrUnroutable = errors.New("message could not be routed to any queue")
+	// The broker didn't take responsibility for the message
+	ErrNotConfirmed = errors.New("message was not confirmed by the broker")
+)
+
+// A message received from a queue. It must be acked or nacked once.
+type Message interface {
+	Body() []byte
+	Headers() map[string]string
+	// True if the message was delivered before and not acked
+	Redelivered() bool
+	Ack() error
+	// Rejects the message, putting it back in the queue when requeue is true.
+	// Otherwise it goes to the dead letter exchange of the queue, if it has one.
+	Nack(requeue bool) error
+}
+
+// A message to be published in an exchange
+type Publishing struct {
+	Exchange   string
+	RoutingKey string
+	Body       []byte
+	Headers    map[string]string
+	// Publishing fails with ErrUnroutable when no queue receives the message
+	Mandatory bool
+	// The message is routed once the delay elapses, rounded up to whole seconds.
+	// Mandatory doesn't apply to delayed messages since they are routed later.
+	Delay time.Duration
+}
+
+type Publisher interface {
+	// Returns once the broker has taken responsibility for the message
+	Publish(ctx context.Context, msg Publishing) error
+	Close() error
+}
+
+type Consumer interface {
+	// Delivers the messages of the queue until ctx is done or the connection is closed,
+	// then the channel is closed
+	Consume(ctx context.Context, queue string) (<-chan Message, error)
+	Close() error
+}
+
+type Exchange struct {
+	Name string
+	Kind string
+}
+
+type Queue struct {
+	Name string
+	// Exchange receiving the messages nacked without requeue, they keep their routing key
+	DeadLetterExchange string
+}
+
+type Binding struct {
+	Queue      string
+	Exchange   string
+	RoutingKey string
+}
+
+// The exchanges, queues and bindings an application needs
+type Topology struct {
+	Exchanges []Exchange
+	Queues    []Queue
+	Bindings  []Binding
+}
+
+// Publishes, consumes and declares the topology on a message broker
+type Broker interface {
+	Publisher
+	Consumer
+	// Declares the topology, declaring something that already exists is not an error
+	Declare(ctx context.Context, topology Topology) error
+	// The state of the connection, for health checks
+	State() string
+}
+
+// Returns a copy of the headers of a message rejected from queue with the
+// first death headers added, they are kept if the message was dead lettered before
+func DeathHeaders(headers map[string]string, queue string) map[string]string {
+	dead := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		dead[k] = v
+	}
+	if _, ok := dead[HeaderFirstDeathQueue]; !ok {
+		dead[HeaderFirstDeathQueue] = queue
+		dead[HeaderFirstDeathReason] = "rejected"
+	}
+	return dead
+}
+
+// Rounds the delay of a message up to whole seconds, so messages share delay queues
+func RoundDelay(delay time.Duration) time.Duration {
+	if delay <= 0 {
+		return 0
+	}
+	return (delay + time.Second - 1).Truncate(time.Second)
+}
+
+// Checks if a message with routingKey published in an exchange of the kind
+// reaches a queue bound with pattern. Topic patterns use "*" for one word and "#" for any number.
+func Matches(kind, pattern, routingKey string) bool {
+	switch kind {
+	case ExchangeFanout:
+		return true
+	case ExchangeTopic:
+		return matchTopic(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+	default:
+		return pattern == routingKey
+	}
+}
+
+func matchTopic(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchTopic(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchTopic(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchTopic(pattern[1:], words[1:])
+	}
+}
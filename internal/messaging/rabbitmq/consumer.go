@@ -1 +1,120 @@
 package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+// Adapts an amqp.Delivery to messaging.Message
+type delivery struct {
+	d amqp.Delivery
+}
+
+func (d *delivery) Body() []byte {
+	return d.d.Body
+}
+
+// Only the string headers are kept
+func (d *delivery) Headers() map[string]string {
+	headers := make(map[string]string, len(d.d.Headers))
+	for k, v := range d.d.Headers {
+		if s, ok := v.(string); ok {
+			headers[k] = s
+		}
+	}
+	return headers
+}
+
+func (d *delivery) Redelivered() bool {
+	return d.d.Redelivered
+}
+
+func (d *delivery) Ack() error {
+	return d.d.Ack(false)
+}
+
+func (d *delivery) Nack(requeue bool) error {
+	return d.d.Nack(false, requeue)
+}
+
+// Consumes the queue with manual acks. When the connection drops the queue is
+// consumed again on the new channel, the messages not acked yet are redelivered by rabbitmq.
+func (r *RabbitMQ) Consume(ctx context.Context, queue string) (<-chan messaging.Message, error) {
+	msgs, err := r.consume(ctx, queue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume messages %v", err)
+	}
+
+	out := make(chan messaging.Message)
+	go func() {
+		defer close(out)
+		for {
+			if !forward(ctx, msgs, out) {
+				return
+			}
+
+			// the channel was closed, wait for the reconnection
+			for {
+				msgs, err = r.consume(ctx, queue)
+				if err == nil {
+					break
+				}
+				if errors.Is(err, messaging.ErrClosed) || ctx.Err() != nil {
+					return
+				}
+				log.Printf("Failed to consume %s again, retrying: %v", queue, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(minReconnectDelay):
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func (r *RabbitMQ) consume(ctx context.Context, queue string) (<-chan amqp.Delivery, error) {
+	channel, _, err := r.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return channel.Consume(
+		queue,
+		"",    //consumer
+		false, //auto-ack
+		false, //exclusive
+		false, //no-local
+		false, //no-wait
+		nil,   //args
+	)
+}
+
+// Hands the deliveries to out until they end, returns false if it stopped because ctx is done
+func forward(ctx context.Context, msgs <-chan amqp.Delivery, out chan<- messaging.Message) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case d, ok := <-msgs:
+			if !ok {
+				return true
+			}
+			select {
+			case out <- &delivery{d: d}:
+			case <-ctx.Done():
+				// not handed to anyone, give it back to the queue
+				_ = d.Nack(false, true)
+				return false
+			}
+		}
+	}
+}
@@ -1 +1,109 @@
 package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+// Publishes a persistent JSON message and waits at most 5 seconds, including the wait
+// for a reconnection, for the broker to confirm it.
+// A mandatory message that no queue received fails with messaging.ErrUnroutable.
+func (r *RabbitMQ) Publish(ctx context.Context, msg messaging.Publishing) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	channel, returns, err := r.connection(ctx)
+	if err != nil {
+		return err
+	}
+
+	exchange, routingKey := msg.Exchange, msg.RoutingKey
+	if delay := messaging.RoundDelay(msg.Delay); delay > 0 {
+		// published through the default exchange straight into the delay queue
+		exchange = ""
+		routingKey, err = declareDelayQueue(channel, msg.Exchange, msg.RoutingKey, delay)
+		if err != nil {
+			return fmt.Errorf("failed to declare delay queue: %w", err)
+		}
+	}
+
+	messageID, err := newMessageID()
+	if err != nil {
+		return fmt.Errorf("failed to generate message id: %w", err)
+	}
+
+	confirm, err := channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		exchange,
+		routingKey,
+		msg.Mandatory,
+		false, //immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			MessageId:    messageID,
+			DeliveryMode: amqp.Persistent,
+			Headers:      toTable(msg.Headers),
+			Body:         msg.Body,
+			Timestamp:    time.Now(),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", messaging.ErrNotConfirmed, err)
+	}
+	if !acked {
+		return messaging.ErrNotConfirmed
+	}
+
+	returned, err := returns.returned(ctx, messageID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", messaging.ErrNotConfirmed, err)
+	}
+	if returned {
+		return fmt.Errorf("%w: exchange %s, routing key %s", messaging.ErrUnroutable, msg.Exchange, msg.RoutingKey)
+	}
+
+	return nil
+}
+
+// Declares the queue holding the messages for exchange and routingKey delayed by delay.
+// Its messages expire after the delay and rabbitmq dead letters them into the exchange,
+// the queue itself is deleted once it is unused for a minute longer than the delay.
+func declareDelayQueue(channel *amqp.Channel, exchange, routingKey string, delay time.Duration) (string, error) {
+	name := fmt.Sprintf("delay.%s.%s.%ds", exchange, routingKey, int64(delay/time.Second))
+
+	_, err := channel.QueueDeclare(
+		name,
+		true,  //durable
+		false, //auto-deleted
+		false, //exclusive
+		false, //no-wait
+		amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-expires":                 (delay + time.Minute).Milliseconds(),
+			"x-dead-letter-exchange":    exchange,
+			"x-dead-letter-routing-key": routingKey,
+		},
+	)
+	return name, err
+}
+
+func toTable(headers map[string]string) amqp.Table {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	table := make(amqp.Table, len(headers))
+	for k, v := range headers {
+		table[k] = v
+	}
+	return table
+}
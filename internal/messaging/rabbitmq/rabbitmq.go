@@ -4,80 +4,258 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/siluk00/task_scheduler/internal/messaging"
 )
 
-type MesssageQueue interface {
-	Publish(exchange, routingKey string, message []byte) error
-	Consume(queue string) (<-chan amqp.Delivery, error)
-	DeclareExchange(name, kind string) error
-	DeclareQueue(name string) (amqp.Queue, error)
-	BindQueue(queue, exchange, routingKey string) error
-	CLose() error
-}
+// Bounds of the wait between reconnection attempts, it doubles after each failure
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Implements messaging.Broker on top of a RabbitMQ connection.
+// The channel is in confirm mode so every publish waits for the broker ack.
+// When the connection drops it is dialed again, the declared topology is declared
+// again and the publishers and consumers resume on the new channel.
+type RabbitMQ struct {
+	url string
 
-type rabbitMQ struct {
+	mu      sync.Mutex
 	conn    *amqp.Connection
 	channel *amqp.Channel
+	// the mandatory messages no queue received
+	returns *returnWatcher
+	state   string
+	// closed and replaced every time the connection is restored
+	reconnected chan struct{}
+	// everything declared so far, declared again after reconnecting
+	topologies []messaging.Topology
+	closed     bool
+	done       chan struct{}
+}
+
+// Dials rabbitmq, failing if it is unreachable. Later disconnections are recovered from.
+func NewRabbitMQ(url string) (*RabbitMQ, error) {
+	conn, channel, returns, err := dial(url)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RabbitMQ{
+		url:         url,
+		conn:        conn,
+		channel:     channel,
+		returns:     returns,
+		state:       messaging.StateConnected,
+		reconnected: make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go r.watch()
+
+	return r, nil
 }
 
-func NewRabbitMQ(url string) (MesssageQueue, error) {
+// Returns a broker that is not connected yet and dials rabbitmq with backoff until it succeeds.
+// It reports StateReconnecting meanwhile, and later disconnections are recovered from.
+func ConnectRabbitMQ(url string) *RabbitMQ {
+	r := &RabbitMQ{
+		url:         url,
+		state:       messaging.StateReconnecting,
+		reconnected: make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go func() {
+		if r.reconnect(0) {
+			r.watch()
+		}
+	}()
+
+	return r
+}
+
+// Opens a connection and a channel in confirm mode
+func dial(url string) (*amqp.Connection, *amqp.Channel, *returnWatcher, error) {
 	conn, err := amqp.Dial(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to rabbitmq: %v", err.Error())
+		return nil, nil, nil, fmt.Errorf("failed to connect to rabbitmq: %v", err.Error())
 	}
 
 	channel, err := conn.Channel()
 	if err != nil {
 		defer conn.Close()
-		return nil, fmt.Errorf("failed to open channel: %v", err.Error())
+		return nil, nil, nil, fmt.Errorf("failed to open channel: %v", err.Error())
 	}
 
-	return &rabbitMQ{
-		conn:    conn,
-		channel: channel,
-	}, nil
+	if err := channel.Confirm(false); err != nil {
+		defer conn.Close()
+		return nil, nil, nil, fmt.Errorf("failed to enable publisher confirms: %v", err.Error())
+	}
+
+	return conn, channel, watchReturns(channel.NotifyReturn(make(chan amqp.Return, 1))), nil
 }
 
-func (r *rabbitMQ) Publish(exchange, routingKey string, message []byte) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	return r.channel.PublishWithContext(
-		ctx,
-		exchange,
-		routingKey,
-		false, //mandadory
-		false, //immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        message,
-			Timestamp:   time.Now(),
-		},
-	)
+// Waits for the connection or the channel to close and reconnects, until the broker is closed
+func (r *RabbitMQ) watch() {
+	for {
+		r.mu.Lock()
+		conn, channel := r.conn, r.channel
+		r.mu.Unlock()
+
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+		select {
+		case <-r.done:
+			return
+		case err := <-connClosed:
+			log.Printf("RabbitMQ connection closed: %v", err)
+		case err := <-channelClosed:
+			log.Printf("RabbitMQ channel closed: %v", err)
+			// the channel is opened again together with a new connection
+			_ = conn.Close()
+		}
+
+		if !r.reconnect(minReconnectDelay) {
+			return
+		}
+	}
 }
 
-func (r *rabbitMQ) Consume(queue string) (<-chan amqp.Delivery, error) {
-	msgs, err := r.channel.Consume(
-		queue,
-		"",    //consumer
-		false, //auto-ack
-		false, //exclusive
-		false, //no-local
-		false, //no-wait
-		nil,   //args
-	)
+// Dials with backoff, starting after delay, until it succeeds or the broker is closed
+func (r *RabbitMQ) reconnect(delay time.Duration) bool {
+	r.mu.Lock()
+	if !r.closed {
+		r.state = messaging.StateReconnecting
+	}
+	r.mu.Unlock()
+
+	for {
+		select {
+		case <-r.done:
+			return false
+		case <-time.After(delay):
+		}
+
+		conn, channel, returns, err := dial(r.url)
+		if err == nil {
+			if err = r.redeclare(channel); err != nil {
+				_ = conn.Close()
+			}
+		}
+		if err != nil {
+			delay = min(max(delay*2, minReconnectDelay), maxReconnectDelay)
+			log.Printf("Failed to reconnect to rabbitmq, retrying in %s: %v", delay, err)
+			continue
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			_ = conn.Close()
+			return false
+		}
+		r.conn, r.channel, r.returns = conn, channel, returns
+		r.state = messaging.StateConnected
+		close(r.reconnected)
+		r.reconnected = make(chan struct{})
+		r.mu.Unlock()
 
+		log.Println("Reconnected to rabbitmq")
+		return true
+	}
+}
+
+func (r *RabbitMQ) redeclare(channel *amqp.Channel) error {
+	r.mu.Lock()
+	topologies := append([]messaging.Topology(nil), r.topologies...)
+	r.mu.Unlock()
+
+	for _, topology := range topologies {
+		if err := declare(channel, topology); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the channel once connected, waiting for a reconnection until ctx is done
+func (r *RabbitMQ) connection(ctx context.Context) (*amqp.Channel, *returnWatcher, error) {
+	for {
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return nil, nil, messaging.ErrClosed
+		}
+		if r.state == messaging.StateConnected {
+			channel, returns := r.channel, r.returns
+			r.mu.Unlock()
+			return channel, returns, nil
+		}
+		reconnected := r.reconnected
+		r.mu.Unlock()
+
+		select {
+		case <-reconnected:
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("rabbitmq is not connected: %w", ctx.Err())
+		}
+	}
+}
+
+// Returns one of messaging.StateConnected, StateReconnecting or StateClosed
+func (r *RabbitMQ) State() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+// Declares the durable exchanges and queues and binds them.
+// The topology is declared again every time the connection is restored.
+func (r *RabbitMQ) Declare(ctx context.Context, topology messaging.Topology) error {
+	channel, _, err := r.connection(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to consume messages %v", err)
+		return err
+	}
+
+	if err := declare(channel, topology); err != nil {
+		return err
 	}
 
-	return msgs, nil
+	r.mu.Lock()
+	r.topologies = append(r.topologies, topology)
+	r.mu.Unlock()
+	return nil
 }
 
-func (r *rabbitMQ) DeclareExchange(name, kind string) error {
-	return r.channel.ExchangeDeclare(
+func declare(channel *amqp.Channel, topology messaging.Topology) error {
+	for _, exchange := range topology.Exchanges {
+		if err := declareExchange(channel, exchange.Name, exchange.Kind); err != nil {
+			return fmt.Errorf("failed to declare exchange %s: %w", exchange.Name, err)
+		}
+	}
+
+	for _, queue := range topology.Queues {
+		if _, err := declareQueue(channel, queue.Name, queue.DeadLetterExchange); err != nil {
+			return fmt.Errorf("failed to declare queue %s: %w", queue.Name, err)
+		}
+	}
+
+	for _, binding := range topology.Bindings {
+		if err := bindQueue(channel, binding.Queue, binding.Exchange, binding.RoutingKey); err != nil {
+			return fmt.Errorf("failed to bind queue %s: %w", binding.Queue, err)
+		}
+	}
+
+	return nil
+}
+
+func declareExchange(channel *amqp.Channel, name, kind string) error {
+	return channel.ExchangeDeclare(
 		name,
 		kind,
 		true,  //durable
@@ -88,19 +266,25 @@ func (r *rabbitMQ) DeclareExchange(name, kind string) error {
 	)
 }
 
-func (r *rabbitMQ) DeclareQueue(name string) (amqp.Queue, error) {
-	return r.channel.QueueDeclare(
+// Rejected messages are dead lettered by rabbitmq when deadLetterExchange is set
+func declareQueue(channel *amqp.Channel, name, deadLetterExchange string) (amqp.Queue, error) {
+	var args amqp.Table
+	if deadLetterExchange != "" {
+		args = amqp.Table{"x-dead-letter-exchange": deadLetterExchange}
+	}
+
+	return channel.QueueDeclare(
 		name,
 		true,  //durable
 		false, //auto-deleted
 		false, //exclusive
 		false, //no-wait
-		nil,   //arguments
+		args,  //arguments
 	)
 }
 
-func (r *rabbitMQ) BindQueue(queue, exchange, routingKey string) error {
-	return r.channel.QueueBind(
+func bindQueue(channel *amqp.Channel, queue, exchange, routingKey string) error {
+	return channel.QueueBind(
 		queue,
 		routingKey,
 		exchange,
@@ -109,16 +293,26 @@ func (r *rabbitMQ) BindQueue(queue, exchange, routingKey string) error {
 	)
 }
 
-func (r *rabbitMQ) CLose() error {
+func (r *RabbitMQ) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.state = messaging.StateClosed
+	close(r.done)
+
 	var errs []error
 
-	if r.channel != nil {
+	if r.channel != nil && !r.channel.IsClosed() {
 		if err := r.channel.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("failed to close channel: %v", err))
 		}
 	}
 
-	if r.conn != nil {
+	if r.conn != nil && !r.conn.IsClosed() {
 		if err := r.conn.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("failed to close connection: %v", err))
 		}
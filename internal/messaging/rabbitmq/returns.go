@@ -0,0 +1,101 @@
+package rabbitmq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// How long the return of a publish that stopped waiting for it is kept
+const returnRetention = time.Minute
+
+// Drains the returned messages of a channel so the amqp reader never blocks on them,
+// and tells a publish whether its message, matched by message ID, was returned.
+type returnWatcher struct {
+	checks chan returnCheck
+	// closed once the returns channel is closed together with its amqp channel
+	done chan struct{}
+}
+
+type returnCheck struct {
+	messageID string
+	returned  chan bool
+}
+
+func watchReturns(returns <-chan amqp.Return) *returnWatcher {
+	w := &returnWatcher{
+		checks: make(chan returnCheck),
+		done:   make(chan struct{}),
+	}
+	go w.run(returns)
+	return w
+}
+
+func (w *returnWatcher) run(returns <-chan amqp.Return) {
+	defer close(w.done)
+
+	returned := make(map[string]time.Time)
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return
+			}
+			returned[ret.MessageId] = time.Now()
+
+		case check := <-w.checks:
+			// rabbitmq sends the return of an unroutable message before its ack,
+			// so once the ack arrived the return was received or is still buffered
+			drain(returns, returned)
+
+			_, ok := returned[check.messageID]
+			delete(returned, check.messageID)
+			for id, at := range returned {
+				if time.Since(at) > returnRetention {
+					delete(returned, id)
+				}
+			}
+			check.returned <- ok
+		}
+	}
+}
+
+func drain(returns <-chan amqp.Return, returned map[string]time.Time) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return
+			}
+			returned[ret.MessageId] = time.Now()
+		default:
+			return
+		}
+	}
+}
+
+// Reports whether the message with messageID was returned, to be called after its ack
+func (w *returnWatcher) returned(ctx context.Context, messageID string) (bool, error) {
+	check := returnCheck{messageID: messageID, returned: make(chan bool, 1)}
+
+	select {
+	case w.checks <- check:
+	case <-w.done:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+
+	return <-check.returned, nil
+}
+
+func newMessageID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,156 @@
+package redisstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+// A stream entry delivered to this consumer. While it is not settled
+// a heartbeat keeps claiming it, so long running tasks aren't taken by other consumers.
+type message struct {
+	broker      *Broker
+	queue       string
+	stream      string
+	id          string
+	routingKey  string
+	body        []byte
+	headers     map[string]string
+	redelivered bool
+	once        sync.Once
+	stop        chan struct{}
+}
+
+func (b *Broker) newMessage(queue string, entry redis.XMessage, redelivered bool) *message {
+	body, _ := entry.Values["body"].(string)
+	routingKey, _ := entry.Values["routing_key"].(string)
+	rawHeaders, _ := entry.Values["headers"].(string)
+	// entries requeued by a nack carry the flag
+	if flag, _ := entry.Values["redelivered"].(string); flag == "1" {
+		redelivered = true
+	}
+
+	headers := make(map[string]string)
+	_ = json.Unmarshal([]byte(rawHeaders), &headers)
+
+	msg := &message{
+		broker:      b,
+		queue:       queue,
+		stream:      getQueueKey(queue),
+		id:          entry.ID,
+		routingKey:  routingKey,
+		body:        []byte(body),
+		headers:     headers,
+		redelivered: redelivered,
+		stop:        make(chan struct{}),
+	}
+	go msg.heartbeat()
+	return msg
+}
+
+// Resets the idle time of the entry by claiming it again for this consumer
+func (m *message) heartbeat() {
+	ticker := time.NewTicker(m.broker.claimIdle / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-m.broker.done:
+			return
+		case <-ticker.C:
+			_ = m.broker.client.XClaimJustID(context.Background(), &redis.XClaimArgs{
+				Stream:   m.stream,
+				Group:    consumerGroup,
+				Consumer: m.broker.consumer,
+				Messages: []string{m.id},
+			}).Err()
+		}
+	}
+}
+
+func (m *message) stopHeartbeat() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+}
+
+func (m *message) Body() []byte {
+	return m.body
+}
+
+func (m *message) Headers() map[string]string {
+	headers := make(map[string]string, len(m.headers))
+	for k, v := range m.headers {
+		headers[k] = v
+	}
+	return headers
+}
+
+func (m *message) Redelivered() bool {
+	return m.redelivered
+}
+
+func (m *message) Ack() error {
+	return m.settle(false, false)
+}
+
+// A requeued message is added again at the end of the stream flagged as redelivered,
+// otherwise it goes to the dead letter exchange of the queue if it has one
+func (m *message) Nack(requeue bool) error {
+	return m.settle(true, requeue)
+}
+
+func (m *message) settle(rejected, requeue bool) error {
+	err := errors.New("message already acknowledged")
+	m.once.Do(func() {
+		m.stopHeartbeat()
+
+		ctx := context.Background()
+		pipe := m.broker.client.TxPipeline()
+		if rejected && requeue {
+			headers, _ := json.Marshal(m.headers)
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: m.stream,
+				Values: map[string]interface{}{
+					"body": m.body, "headers": headers, "routing_key": m.routingKey, "redelivered": "1",
+				},
+			})
+		} else if rejected {
+			if err = m.deadLetter(ctx, pipe); err != nil {
+				return
+			}
+		}
+		pipe.XAck(ctx, m.stream, consumerGroup, m.id)
+		pipe.XDel(ctx, m.stream, m.id)
+		_, err = pipe.Exec(ctx)
+	})
+	return err
+}
+
+// Queues in pipe the delivery of the rejected message to the dead letter exchange
+func (m *message) deadLetter(ctx context.Context, pipe redis.Pipeliner) error {
+	exchange, err := m.broker.client.HGet(ctx, queuesKey, m.queue).Result()
+	if errors.Is(err, redis.Nil) || exchange == "" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to dead letter message: %w", err)
+	}
+
+	return m.broker.route(ctx, pipe, messaging.Publishing{
+		Exchange:   exchange,
+		RoutingKey: m.routingKey,
+		Body:       m.body,
+		Headers:    messaging.DeathHeaders(m.headers, m.queue),
+	})
+}
@@ -0,0 +1,344 @@
+package redisstream
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+const (
+	exchangesKey      = "mq:exchanges" // hash of exchange name -> kind
+	queuesKey         = "mq:queues"    // hash of queue name -> dead letter exchange
+	bindingsKeyPrefix = "mq:bindings:" // set of queue|routingKey per exchange
+	queueKeyPrefix    = "mq:queue:"    // one stream per queue
+	delayedKey        = "mq:delayed"   // sorted set of delayed messages scored by due time
+	consumerGroup     = "workers"
+
+	// How long a delivered message can stay unacked without news from its
+	// consumer before another consumer claims it, unless the broker is given another
+	defaultClaimIdle = time.Minute
+	// How long XREADGROUP waits before checking the context and the delayed messages again
+	readBlock = time.Second
+)
+
+// Implements messaging.Broker with redis streams: every queue is a stream
+// consumed by the "workers" consumer group, exchanges and bindings are kept
+// in redis so every process routes the same way.
+type Broker struct {
+	client    *redis.Client
+	consumer  string
+	claimIdle time.Duration
+	mu        sync.Mutex
+	closed    bool
+	done      chan struct{}
+}
+
+// A message left unacked for claimIdle by a consumer that stopped is delivered again,
+// the default is used when it isn't positive
+func NewBroker(client *redis.Client, claimIdle time.Duration) *Broker {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	host, _ := os.Hostname()
+
+	if claimIdle <= 0 {
+		claimIdle = defaultClaimIdle
+	}
+
+	return &Broker{
+		client:    client,
+		consumer:  fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix)),
+		claimIdle: claimIdle,
+		done:      make(chan struct{}),
+	}
+}
+
+func (b *Broker) Declare(ctx context.Context, topology messaging.Topology) error {
+	for _, exchange := range topology.Exchanges {
+		kind, err := b.client.HGet(ctx, exchangesKey, exchange.Name).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return fmt.Errorf("failed to declare exchange %s: %w", exchange.Name, err)
+		}
+		if err == nil && kind != exchange.Kind {
+			return fmt.Errorf("exchange %s already declared as %s", exchange.Name, kind)
+		}
+		if err := b.client.HSet(ctx, exchangesKey, exchange.Name, exchange.Kind).Err(); err != nil {
+			return fmt.Errorf("failed to declare exchange %s: %w", exchange.Name, err)
+		}
+	}
+
+	for _, queue := range topology.Queues {
+		// the group starts at the beginning, acked entries are deleted so only pending work is left.
+		// MKSTREAM creates the stream if it doesn't exist
+		err := b.client.XGroupCreateMkStream(ctx, getQueueKey(queue.Name), consumerGroup, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to declare queue %s: %w", queue.Name, err)
+		}
+		if err := b.client.HSet(ctx, queuesKey, queue.Name, queue.DeadLetterExchange).Err(); err != nil {
+			return fmt.Errorf("failed to declare queue %s: %w", queue.Name, err)
+		}
+	}
+
+	for _, binding := range topology.Bindings {
+		err := b.client.SAdd(ctx, bindingsKeyPrefix+binding.Exchange, binding.Queue+"|"+binding.RoutingKey).Err()
+		if err != nil {
+			return fmt.Errorf("failed to bind queue %s: %w", binding.Queue, err)
+		}
+	}
+
+	return nil
+}
+
+// A message waiting for its delay, the ID keeps equal messages apart in the sorted set
+type delayedMessage struct {
+	ID string `json:"id"`
+	messaging.Publishing
+}
+
+// Adds the message to the stream of every queue bound with a matching key.
+// A delayed message waits in a sorted set until a consumer routes it.
+func (b *Broker) Publish(ctx context.Context, msg messaging.Publishing) error {
+	if b.isClosed() {
+		return messaging.ErrClosed
+	}
+
+	if delay := messaging.RoundDelay(msg.Delay); delay > 0 {
+		return b.publishDelayed(ctx, msg, delay)
+	}
+
+	pipe := b.client.TxPipeline()
+	if err := b.route(ctx, pipe, msg); err != nil {
+		return err
+	}
+
+	// like RabbitMQ, a message that matches no queue is dropped unless it is mandatory
+	if pipe.Len() == 0 {
+		if msg.Mandatory {
+			return messaging.ErrUnroutable
+		}
+		return nil
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+	return nil
+}
+
+func (b *Broker) publishDelayed(ctx context.Context, msg messaging.Publishing, delay time.Duration) error {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	msg.Delay, msg.Mandatory = 0, false
+	data, err := json.Marshal(delayedMessage{ID: hex.EncodeToString(id), Publishing: msg})
+	if err != nil {
+		return fmt.Errorf("failed to marshal delayed message: %w", err)
+	}
+
+	err = b.client.ZAdd(ctx, delayedKey, redis.Z{
+		Score:  float64(time.Now().Add(delay).UnixMilli()),
+		Member: data,
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+	return nil
+}
+
+// Routes the delayed messages that are due. Every consumer does it,
+// WATCH makes sure each message is moved by only one of them.
+func (b *Broker) releaseDelayed(ctx context.Context) error {
+	err := b.client.Watch(ctx, func(tx *redis.Tx) error {
+		due, err := tx.ZRangeByScore(ctx, delayedKey, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+			Count: 100,
+		}).Result()
+		if err != nil || len(due) == 0 {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, member := range due {
+				var msg delayedMessage
+				if err := json.Unmarshal([]byte(member), &msg); err != nil {
+					log.Printf("Dropping invalid delayed message: %v", err)
+				} else if err := b.route(ctx, pipe, msg.Publishing); err != nil {
+					log.Printf("Dropping delayed message: %v", err)
+				}
+				pipe.ZRem(ctx, delayedKey, member)
+			}
+			return nil
+		})
+		return err
+	}, delayedKey)
+
+	// another consumer moved them first
+	if errors.Is(err, redis.TxFailedErr) {
+		return nil
+	}
+	return err
+}
+
+// Queues in pipe the XADDs delivering the message to the matching queues
+func (b *Broker) route(ctx context.Context, pipe redis.Pipeliner, msg messaging.Publishing) error {
+	kind, err := b.client.HGet(ctx, exchangesKey, msg.Exchange).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return fmt.Errorf("exchange %s not declared", msg.Exchange)
+		}
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+
+	bindings, err := b.client.SMembers(ctx, bindingsKeyPrefix+msg.Exchange).Result()
+	if err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	for _, binding := range bindings {
+		queue, pattern, _ := strings.Cut(binding, "|")
+		if messaging.Matches(kind, pattern, msg.RoutingKey) {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: getQueueKey(queue),
+				Values: map[string]interface{}{"body": msg.Body, "headers": headers, "routing_key": msg.RoutingKey},
+			})
+		}
+	}
+
+	return nil
+}
+
+// Reads the queue with the consumer group. Messages left unacked by a consumer
+// that stopped are claimed with XAUTOCLAIM and delivered again.
+func (b *Broker) Consume(ctx context.Context, queue string) (<-chan messaging.Message, error) {
+	if b.isClosed() {
+		return nil, messaging.ErrClosed
+	}
+
+	stream := getQueueKey(queue)
+	if err := b.client.XGroupCreateMkStream(ctx, stream, consumerGroup, "0").Err(); err != nil &&
+		!strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("failed to consume messages %v", err)
+	}
+
+	out := make(chan messaging.Message)
+	go func() {
+		defer close(out)
+
+		lastClaim, lastRelease := time.Time{}, time.Time{}
+		for ctx.Err() == nil && !b.isClosed() {
+			var entries []redis.XMessage
+			redelivered := false
+
+			if time.Since(lastRelease) > time.Second {
+				if err := b.releaseDelayed(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("Failed to release delayed messages: %v", err)
+				}
+				lastRelease = time.Now()
+			}
+
+			if time.Since(lastClaim) > b.claimIdle/2 {
+				claimed, _, err := b.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+					Stream:   stream,
+					Group:    consumerGroup,
+					Consumer: b.consumer,
+					MinIdle:  b.claimIdle,
+					Start:    "0-0",
+					Count:    1,
+				}).Result()
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Failed to claim stalled messages of %s: %v", queue, err)
+				}
+				if len(claimed) > 0 {
+					entries, redelivered = claimed, true
+				} else {
+					lastClaim = time.Now()
+				}
+			}
+
+			if len(entries) == 0 {
+				streams, err := b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+					Group:    consumerGroup,
+					Consumer: b.consumer,
+					Streams:  []string{stream, ">"},
+					Count:    1,
+					Block:    readBlock,
+				}).Result()
+				if err != nil {
+					if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+						log.Printf("Failed to read queue %s: %v", queue, err)
+						time.Sleep(time.Second)
+					}
+					continue
+				}
+				for _, s := range streams {
+					entries = append(entries, s.Messages...)
+				}
+			}
+
+			for _, entry := range entries {
+				msg := b.newMessage(queue, entry, redelivered)
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					// left pending, it will be claimed again
+					msg.stopHeartbeat()
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+	return nil
+}
+
+// The redis client reconnects by itself, a failed ping is reported as reconnecting
+func (b *Broker) State() string {
+	if b.isClosed() {
+		return messaging.StateClosed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.client.Ping(ctx).Err(); err != nil {
+		return messaging.StateReconnecting
+	}
+	return messaging.StateConnected
+}
+
+func (b *Broker) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+func getQueueKey(queue string) string {
+	return queueKeyPrefix + queue
+}
@@ -0,0 +1,57 @@
+package messaging
+
+import "strings"
+
+// The exchanges and queues of the task scheduler, shared by the worker and the api
+const (
+	TasksExchange   = "tasks"
+	TasksQueue      = "tasks_queue"
+	TasksRoutingKey = "tasks.routing.key"
+
+	// Receives the task messages that could not be processed
+	DeadLetterExchange = "tasks.dlx"
+	DeadLetterQueue    = "tasks_dead"
+
+	// Topic exchange of the lifecycle events, routed by their type, e.g. run.failed
+	EventsExchange = "tasks.events"
+	// Receives every event for the notifications sent by the workers
+	NotificationsQueue = "tasks_notifications"
+
+	// The task queue of the tasks that don't name one, it uses TasksQueue and TasksRoutingKey
+	DefaultTaskQueue = "default"
+)
+
+// Returns the broker queue of a named task queue, e.g. "tasks_queue.reports"
+func TaskQueue(name string) string {
+	if name == "" || name == DefaultTaskQueue {
+		return TasksQueue
+	}
+	return TasksQueue + "." + name
+}
+
+// Returns the routing key of a named task queue, e.g. "tasks.routing.key.reports"
+func TaskRoutingKey(name string) string {
+	if name == "" || name == DefaultTaskQueue {
+		return TasksRoutingKey
+	}
+	return TasksRoutingKey + "." + name
+}
+
+// Returns the name of the task queue given its broker queue, the reverse of TaskQueue
+func TaskQueueName(queue string) string {
+	if name, ok := strings.CutPrefix(queue, TasksQueue+"."); ok {
+		return name
+	}
+	return DefaultTaskQueue
+}
+
+// Headers the worker sets on the task messages
+const (
+	// Number of deliveries that failed to be processed
+	HeaderAttempts = "x-attempts"
+	// Broker queue the worker dead lettered the message from
+	HeaderQueue = "x-queue"
+	// Why and with which error the worker dead lettered the message
+	HeaderDeadLetterReason = "x-dead-letter-reason"
+	HeaderDeadLetterError  = "x-dead-letter-error"
+)
@@ -0,0 +1,322 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// Header of the emails with the ID of their delivery, the same in every attempt
+const HeaderEmailDelivery = "X-Notification-Delivery"
+
+var errNoStartTLS = errors.New("the SMTP server doesn't support STARTTLS")
+
+// The SMTP server the emails are sent through
+type smtpConfig struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	startTLS bool
+	timeout  time.Duration
+}
+
+// The emails of a rule waiting for the end of its digest window
+type digest struct {
+	rule     *domain.NotificationRule
+	payloads []*domain.NotificationPayload
+	timer    *time.Timer
+}
+
+// The subject and body of a single notification and of a digest
+var emailTemplates = template.Must(template.New("email").Funcs(template.FuncMap{
+	"taskName": taskName,
+	"summary":  summary,
+	"time":     func(t time.Time) string { return t.Format(time.RFC1123) },
+}).Parse(`
+{{- define "subject"}}[task-scheduler] {{if .TaskID}}Task {{taskName .}} {{end}}{{summary .}}{{end}}
+
+{{- define "body"}}{{if .TaskID}}Task {{taskName .}} {{end}}{{summary .}} at {{time .OccurredAt}}.
+
+Event:     {{.Event}}
+{{with .Status}}Status:    {{.}}
+{{end}}
+{{- with .Task}}{{with .Command}}Command:   {{.}}
+{{end}}{{end}}
+{{- with .Run}}Run:       {{.ID}}
+{{if not .StartedAt.IsZero}}Started:   {{time .StartedAt}}
+{{end}}
+{{- if not .FinishedAt.IsZero}}Finished:  {{time .FinishedAt}}
+{{end}}
+{{- if .Status.IsFinished}}Exit code: {{.ExitCode}}
+{{end}}
+{{- with .Error}}Error:     {{.}}
+{{end}}{{end}}
+{{- with .OutputTail}}{{with .Stderr}}
+End of stderr:
+{{.}}
+{{end}}{{with .Stdout}}
+End of stdout:
+{{.}}
+{{end}}{{end}}{{end}}
+
+{{- define "digestSubject"}}[task-scheduler] {{len .Notifications}} task notifications: {{.Counts}}{{end}}
+
+{{- define "digestBody"}}{{len .Notifications}} task notifications came at once:
+
+{{range .Notifications}}- {{time .OccurredAt}}: task {{taskName .}} {{summary .}}
+{{- with .Run}}, run {{.ID}}{{with .Error}}: {{.}}{{end}}{{end}}
+{{end}}{{end}}
+`))
+
+// The name of the task of the notification, its ID when the task isn't in the payload
+func taskName(payload *domain.NotificationPayload) string {
+	if payload.Task != nil && payload.Task.Name != "" {
+		return payload.Task.Name
+	}
+	return payload.TaskID
+}
+
+// What happened to the task, e.g. "failed"
+func summary(payload *domain.NotificationPayload) string {
+	switch payload.Event {
+	case domain.EventRunFailed:
+		return "failed"
+	case domain.EventRunSucceeded:
+		return "succeeded"
+	case domain.EventRunSLAMissed:
+		if payload.Task != nil {
+			return fmt.Sprintf("missed its SLA of %s", time.Duration(payload.Task.SLASeconds)*time.Second)
+		}
+		return "missed its SLA"
+	case domain.EventRunStarted:
+		return "started"
+	case domain.EventTaskCreated:
+		return "was created"
+	case domain.EventTaskUpdated:
+		return "was updated"
+	case domain.EventTaskDeleted:
+		return "was deleted"
+	case domain.EventNotificationTest:
+		return "test notification"
+	}
+	return string(payload.Event)
+}
+
+// Waits for the other emails of the rule within the digest window before sending them
+func (n *Notifier) queueEmail(rule *domain.NotificationRule, payload *domain.NotificationPayload) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	d, ok := n.digests[rule.ID]
+	if !ok {
+		d = &digest{rule: rule}
+		n.digests[rule.ID] = d
+		n.flushes.Add(1)
+		d.timer = time.AfterFunc(n.digestWindow, func() {
+			defer n.flushes.Done()
+			n.flushDigest(rule.ID)
+		})
+	}
+	d.payloads = append(d.payloads, payload)
+}
+
+// Sends the emails of the rule, in a digest if there are at least digestMin of them
+func (n *Notifier) flushDigest(ruleID string) {
+	n.mu.Lock()
+	d := n.digests[ruleID]
+	delete(n.digests, ruleID)
+	n.mu.Unlock()
+
+	if d == nil {
+		return
+	}
+
+	ctx := context.Background()
+	if len(d.payloads) < n.digestMin {
+		for _, payload := range d.payloads {
+			n.Deliver(ctx, d.rule, payload)
+		}
+		return
+	}
+
+	delivery := domain.NewNotificationDelivery(d.rule, &domain.NotificationPayload{Event: domain.EventNotificationDigest})
+	n.attempt(ctx, delivery, func() bool {
+		return n.sendEmail(d.rule, d.payloads, delivery)
+	})
+}
+
+// Sends the emails waiting for their digest window right away and waits for them
+func (n *Notifier) Close() {
+	n.mu.Lock()
+	var ids []string
+	for id, d := range n.digests {
+		if d.timer.Stop() {
+			ids = append(ids, id)
+		}
+	}
+	n.mu.Unlock()
+
+	for _, id := range ids {
+		n.flushDigest(id)
+		n.flushes.Done()
+	}
+	n.flushes.Wait()
+}
+
+// Sends the payloads to the recipients of the rule, a single one as a notification and
+// several as a digest, and records the result of the attempt in the delivery.
+// Reports if a failed attempt is worth retrying: all but the permanent SMTP errors are.
+func (n *Notifier) sendEmail(rule *domain.NotificationRule, payloads []*domain.NotificationPayload,
+	delivery *domain.NotificationDelivery) bool {
+	if n.smtp == nil {
+		delivery.Error = "no SMTP server is configured"
+		return false
+	}
+
+	subject, body, err := renderEmail(payloads)
+	if err != nil {
+		delivery.Error = fmt.Sprintf("failed to render email: %v", err)
+		return false
+	}
+
+	msg := buildEmail(n.smtp.from, rule.Email, subject, body, delivery.ID)
+	if err := n.smtp.send(rule.Email, msg); err != nil {
+		delivery.Error = err.Error()
+
+		var smtpErr *textproto.Error
+		if errors.As(err, &smtpErr) {
+			delivery.StatusCode = smtpErr.Code
+			return smtpErr.Code < 500
+		}
+		return !errors.Is(err, errNoStartTLS)
+	}
+
+	delivery.StatusCode = 250
+	delivery.Delivered = true
+	delivery.Error = ""
+	return false
+}
+
+// Returns the subject and the body of the email of the payloads
+func renderEmail(payloads []*domain.NotificationPayload) (string, string, error) {
+	var data any = payloads[0]
+	subjectTemplate, bodyTemplate := "subject", "body"
+
+	if len(payloads) > 1 {
+		counts := make(map[string]int)
+		var order []string
+		for _, payload := range payloads {
+			s := summary(payload)
+			if counts[s] == 0 {
+				order = append(order, s)
+			}
+			counts[s]++
+		}
+		parts := make([]string, 0, len(order))
+		for _, s := range order {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+		}
+
+		data = struct {
+			Notifications []*domain.NotificationPayload
+			Counts        string
+		}{payloads, strings.Join(parts, ", ")}
+		subjectTemplate, bodyTemplate = "digestSubject", "digestBody"
+	}
+
+	var subject, body bytes.Buffer
+	if err := emailTemplates.ExecuteTemplate(&subject, subjectTemplate, data); err != nil {
+		return "", "", err
+	}
+	if err := emailTemplates.ExecuteTemplate(&body, bodyTemplate, data); err != nil {
+		return "", "", err
+	}
+	return subject.String(), body.String(), nil
+}
+
+// Builds a plain text UTF-8 email, the SMTP client turns its line breaks into CRLF
+func buildEmail(from string, to []string, subject, body, deliveryID string) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\n", from)
+	fmt.Fprintf(&msg, "To: %s\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "%s: %s\n", HeaderEmailDelivery, deliveryID)
+	msg.WriteString("MIME-Version: 1.0\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\n\n")
+	msg.WriteString(body)
+	return msg.Bytes()
+}
+
+// Sends the message through the server, upgrading the connection with STARTTLS
+// and authenticating with PLAIN when they are configured
+func (s *smtpConfig) send(to []string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.host, strconv.Itoa(s.port)), s.timeout)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(s.timeout))
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.startTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errNoStartTLS
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if err := client.Quit(); err != nil {
+		log.Printf("Failed to close SMTP connection: %v", err)
+	}
+	return nil
+}
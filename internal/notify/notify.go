@@ -0,0 +1,177 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/repository"
+	"github.com/siluk00/task_scheduler/pkg/config"
+)
+
+// Bytes of stdout and of stderr sent as the output tail
+const outputTailBytes = 2048
+
+// Sends the notifications of the rules matching the lifecycle events
+type Notifier struct {
+	repo        repository.NotificationHandler
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	// nil when no SMTP server is configured
+	smtp         *smtpConfig
+	digestWindow time.Duration
+	digestMin    int
+	// the emails waiting for their digest window, by rule ID
+	mu      sync.Mutex
+	digests map[string]*digest
+	flushes sync.WaitGroup
+}
+
+func NewNotifier(cfg *config.AppConfig, repo repository.NotificationHandler) *Notifier {
+	timeout := time.Duration(max(cfg.NotifyTimeoutSeconds, 1)) * time.Second
+
+	var smtp *smtpConfig
+	if cfg.SMTPHost != "" {
+		smtp = &smtpConfig{
+			host:     cfg.SMTPHost,
+			port:     cfg.SMTPPort,
+			username: cfg.SMTPUsername,
+			password: cfg.SMTPPassword,
+			from:     cfg.SMTPFrom,
+			startTLS: cfg.SMTPStartTLS,
+			timeout:  timeout,
+		}
+	}
+
+	return &Notifier{
+		repo:         repo,
+		client:       &http.Client{Timeout: timeout},
+		maxAttempts:  max(cfg.NotifyMaxAttempts, 1),
+		backoff:      time.Duration(max(cfg.NotifyBackoffMs, 0)) * time.Millisecond,
+		smtp:         smtp,
+		digestWindow: time.Duration(max(cfg.NotifyDigestWindowMs, 0)) * time.Millisecond,
+		digestMin:    max(cfg.NotifyDigestMin, 2),
+		digests:      make(map[string]*digest),
+	}
+}
+
+// Sends the event to every rule that wants it, all at once, and waits for the deliveries.
+// Emails wait for the digest window of their rule instead, they are sent in the background.
+// Output is the output of the run of a run event, nil otherwise.
+// It only fails if the rules can't be read, failed deliveries are in the delivery log.
+func (n *Notifier) Notify(ctx context.Context, event *domain.Event, output *domain.RunOutput) error {
+	rules, err := n.repo.ListRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read notification rules: %w", err)
+	}
+
+	payload := NewPayload(event, output)
+
+	var wg sync.WaitGroup
+	for _, rule := range rules {
+		if !rule.Matches(event) {
+			continue
+		}
+		if len(rule.Email) > 0 && n.digestWindow > 0 {
+			n.queueEmail(rule, payload)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.Deliver(ctx, rule, payload)
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// Sends the payload to the rule right away, retrying the failed attempts with backoff, and records the delivery
+func (n *Notifier) Deliver(ctx context.Context, rule *domain.NotificationRule, payload *domain.NotificationPayload) *domain.NotificationDelivery {
+	delivery := domain.NewNotificationDelivery(rule, payload)
+	n.attempt(ctx, delivery, func() bool {
+		if len(rule.Email) > 0 {
+			return n.sendEmail(rule, []*domain.NotificationPayload{payload}, delivery)
+		}
+		return n.postWebhook(ctx, rule, payload, delivery)
+	})
+	return delivery
+}
+
+// Calls send until the delivery succeeds, send reports it is not worth retrying or the
+// attempts run out, waiting longer after every failed one. Then records the delivery.
+func (n *Notifier) attempt(ctx context.Context, delivery *domain.NotificationDelivery, send func() bool) {
+	for delivery.Attempts < n.maxAttempts {
+		if delivery.Attempts > 0 && !sleep(ctx, n.backoff<<(delivery.Attempts-1)) {
+			delivery.Error = ctx.Err().Error()
+			break
+		}
+		delivery.Attempts++
+
+		retry := send()
+		if delivery.Delivered || !retry {
+			break
+		}
+	}
+
+	delivery.FinishedAt = time.Now()
+	if !delivery.Delivered {
+		log.Printf("Notification %s of %s to %s failed after %d attempts: %s",
+			delivery.ID, delivery.Event, delivery.URL, delivery.Attempts, delivery.Error)
+	}
+	if err := n.repo.SaveDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		log.Printf("Failed to store notification delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// Builds the payload of the event, with the tail of the output of the run
+func NewPayload(event *domain.Event, output *domain.RunOutput) *domain.NotificationPayload {
+	payload := &domain.NotificationPayload{
+		Event:      event.Type,
+		TaskID:     event.TaskID,
+		Task:       event.Task,
+		Run:        event.Run,
+		OccurredAt: event.OccurredAt,
+	}
+
+	if event.Run != nil {
+		payload.Status = event.Run.Status
+	} else if event.Task != nil {
+		payload.Status = event.Task.Status
+	}
+
+	if output != nil {
+		payload.OutputTail = &domain.RunOutput{
+			Stdout: tail(output.Stdout, outputTailBytes),
+			Stderr: tail(output.Stderr, outputTailBytes),
+		}
+	}
+
+	return payload
+}
+
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
+
+// Waits for d unless the context is done first, reports if it waited
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// Headers of the webhook requests
+const (
+	// "sha256=" followed by the hex HMAC-SHA256 of the body keyed with the secret of the rule
+	HeaderSignature = "X-Signature-256"
+	HeaderEvent     = "X-Webhook-Event"
+	// The ID of the delivery, the same in every attempt
+	HeaderDelivery = "X-Webhook-Delivery"
+)
+
+// Returns the signature of the body, receivers compute it again with the shared secret
+// and compare it with the X-Signature-256 header using hmac.Equal
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// POSTs the payload to the URL of the rule and records the result of the attempt in the delivery.
+// Reports if a failed attempt is worth retrying: connection errors, 429 and 5xx responses are.
+func (n *Notifier) postWebhook(ctx context.Context, rule *domain.NotificationRule, payload *domain.NotificationPayload,
+	delivery *domain.NotificationDelivery) bool {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		delivery.Error = fmt.Sprintf("failed to marshal payload: %v", err)
+		return false
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = fmt.Sprintf("failed to create request: %v", err)
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(payload.Event))
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	if rule.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(rule.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		delivery.StatusCode = 0
+		delivery.Error = err.Error()
+		return true
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		delivery.Delivered = true
+		delivery.Error = ""
+		return false
+	}
+
+	delivery.Error = fmt.Sprintf("unexpected status code %d", resp.StatusCode)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
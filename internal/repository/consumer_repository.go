@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// The interface for registering which workers consume each task queue,
+// so tasks are only accepted for queues that some worker consumes
+type ConsumerHandler interface {
+	// Registers the worker as a consumer of the queues until ttl passes without registering again
+	RegisterConsumer(ctx context.Context, workerID string, queues []string, ttl time.Duration) error
+	UnregisterConsumer(ctx context.Context, workerID string, queues []string) error
+	// Counts the workers whose registration for the queue hasn't expired
+	CountConsumers(ctx context.Context, queue string) (int, error)
+}
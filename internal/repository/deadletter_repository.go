@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// The interface for storing the dead lettered messages until they are replayed or purged
+type DeadLetterHandler interface {
+	SaveDeadLetter(ctx context.Context, letter *domain.DeadLetter) error
+	FindDeadLetter(ctx context.Context, id string) (*domain.DeadLetter, error)
+	// Lists the dead letters, oldest first
+	ListDeadLetters(ctx context.Context) ([]*domain.DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, id string) error
+	// Deletes every dead letter and returns how many there were
+	PurgeDeadLetters(ctx context.Context) (int, error)
+}
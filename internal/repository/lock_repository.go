@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// The interface for the distributed locks of the named resources the tasks declare.
+// A lock is held by an owner until it releases it or its lease expires.
+type LockHandler interface {
+	// Takes all the locks for owner for ttl, or none of them. When one of them is
+	// already held it returns its name and owner instead.
+	AcquireLocks(ctx context.Context, names []string, owner string, ttl time.Duration) (held, holder string, err error)
+	// Extends the lease of the locks, fails if owner no longer holds any of them
+	RenewLocks(ctx context.Context, names []string, owner string, ttl time.Duration) error
+	// Releases the locks still held by owner
+	ReleaseLocks(ctx context.Context, names []string, owner string) error
+}
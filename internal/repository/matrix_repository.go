@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// The interface for tracking the children of the runs of matrix tasks.
+// The children finish on any worker, so the counters are updated atomically.
+type MatrixHandler interface {
+	CreateGroup(ctx context.Context, group *domain.MatrixGroup) error
+	// FindGroup returns nil without an error if the group does not exist
+	FindGroup(ctx context.Context, taskID, runID string) (*domain.MatrixGroup, error)
+	// Claims the next child to start and returns its index, Total or more once all were claimed
+	NextChild(ctx context.Context, taskID, runID string) (int, error)
+	// Counts a child that completed or failed and returns the group right after it
+	FinishChild(ctx context.Context, taskID, runID string, status domain.TaskStatus) (*domain.MatrixGroup, error)
+	// Counts a child that won't start and returns the group right after it
+	SkipChild(ctx context.Context, taskID, runID string) (*domain.MatrixGroup, error)
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// The interface for storing the notification rules and the log of their deliveries
+type NotificationHandler interface {
+	SaveRule(ctx context.Context, rule *domain.NotificationRule) error
+	FindRule(ctx context.Context, id string) (*domain.NotificationRule, error)
+	ListRules(ctx context.Context) ([]*domain.NotificationRule, error)
+	DeleteRule(ctx context.Context, id string) error
+	// Only the most recent deliveries are kept
+	SaveDelivery(ctx context.Context, delivery *domain.NotificationDelivery) error
+	// Lists up to limit deliveries, newest first
+	ListDeliveries(ctx context.Context, limit int) ([]*domain.NotificationDelivery, error)
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// The interface for relaying the outbox, the messages are recorded by
+// TaskHandler.UpdateWithOutbox in the same transaction as the task
+type OutboxHandler interface {
+	// Returns up to limit messages that are not claimed, oldest first, and claims them for lease.
+	// A message claimed by a relay that stopped is returned again once the lease expires.
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]*domain.OutboxMessage, error)
+	// Deletes a message once it is published
+	DeleteOutbox(ctx context.Context, id string) error
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// The interface for remembering the task messages the worker already processed,
+// so a message the broker delivers again doesn't run its task twice
+type ProcessedHandler interface {
+	IsProcessed(ctx context.Context, messageID string) (bool, error)
+	// Remembers the message as processed for ttl
+	MarkProcessed(ctx context.Context, messageID string, ttl time.Duration) error
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// The interface for the rate limits of the tasks and the counters enforcing them across the workers
+type RateLimitHandler interface {
+	// Creates or replaces a limit, keeping its creation time
+	SetLimit(ctx context.Context, limit *domain.RateLimit) error
+	// Returns nil when the limit doesn't exist
+	FindLimit(ctx context.Context, name string) (*domain.RateLimit, error)
+	ListLimits(ctx context.Context) ([]*domain.RateLimit, error)
+	DeleteLimit(ctx context.Context, name string) error
+
+	// Counts a start of owner in every limit, taking a running slot for ttl in those with a cap,
+	// or in none of them. When a limit has no room it returns its name and how long until its
+	// next start is allowed, 0 when it waits for a running slot instead.
+	AcquireSlots(ctx context.Context, limits []*domain.RateLimit, owner string, ttl time.Duration) (limited string, wait time.Duration, err error)
+	// Extends the lease of the running slots of owner
+	RenewSlots(ctx context.Context, limits []*domain.RateLimit, owner string, ttl time.Duration) error
+	// Frees the running slots of owner
+	ReleaseSlots(ctx context.Context, limits []*domain.RateLimit, owner string) error
+}
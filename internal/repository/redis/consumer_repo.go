@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// sorted set of the worker IDs consuming a queue scored by when their registration expires
+const consumersKeyPrefix = "consumers:"
+
+// Keeps the consumers of every task queue in redis
+type ConsumerRepository struct {
+	client *redis.Client
+}
+
+func NewConsumerRepository(client *redis.Client) *ConsumerRepository {
+	return &ConsumerRepository{
+		client: client,
+	}
+}
+
+func (r *ConsumerRepository) RegisterConsumer(ctx context.Context, workerID string, queues []string, ttl time.Duration) error {
+	now := time.Now()
+
+	pipe := r.client.TxPipeline()
+	for _, queue := range queues {
+		key := consumersKeyPrefix + queue
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: workerID})
+		// drops the workers that stopped without unregistering
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to register consumer: %w", err)
+	}
+	return nil
+}
+
+func (r *ConsumerRepository) UnregisterConsumer(ctx context.Context, workerID string, queues []string) error {
+	pipe := r.client.TxPipeline()
+	for _, queue := range queues {
+		pipe.ZRem(ctx, consumersKeyPrefix+queue, workerID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to unregister consumer: %w", err)
+	}
+	return nil
+}
+
+func (r *ConsumerRepository) CountConsumers(ctx context.Context, queue string) (int, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	count, err := r.client.ZCount(ctx, consumersKeyPrefix+queue, "("+now, "+inf").Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count consumers: %w", err)
+	}
+	return int(count), nil
+}
@@ -0,0 +1,123 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+const (
+	deadLetterKeyPrefix = "deadletter:"
+	// sorted set of the dead letter IDs scored by the time they were dead lettered
+	deadLetterIndex = "deadletters"
+)
+
+// Stores the dead lettered messages as JSON
+type DeadLetterRepository struct {
+	client *redis.Client
+}
+
+func NewDeadLetterRepository(client *redis.Client) *DeadLetterRepository {
+	return &DeadLetterRepository{
+		client: client,
+	}
+}
+
+func (r *DeadLetterRepository) SaveDeadLetter(ctx context.Context, letter *domain.DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, deadLetterKeyPrefix+letter.ID, data, 0)
+	pipe.ZAdd(ctx, deadLetterIndex, redis.Z{
+		Score:  float64(letter.DeadLetteredAt.UnixMilli()),
+		Member: letter.ID,
+	})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// FindDeadLetter returns nil without an error if the dead letter does not exist
+func (r *DeadLetterRepository) FindDeadLetter(ctx context.Context, id string) (*domain.DeadLetter, error) {
+	data, err := r.client.Get(ctx, deadLetterKeyPrefix+id).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get dead letter from redis: %w", err)
+	}
+
+	var letter domain.DeadLetter
+	if err := json.Unmarshal([]byte(data), &letter); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dead letter data: %w", err)
+	}
+	return &letter, nil
+}
+
+func (r *DeadLetterRepository) ListDeadLetters(ctx context.Context) ([]*domain.DeadLetter, error) {
+	ids, err := r.client.ZRange(ctx, deadLetterIndex, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	var letters []*domain.DeadLetter
+
+	for _, id := range ids {
+		letter, err := r.FindDeadLetter(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if letter != nil {
+			letters = append(letters, letter)
+		}
+	}
+
+	return letters, nil
+}
+
+func (r *DeadLetterRepository) DeleteDeadLetter(ctx context.Context, id string) error {
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, deadLetterKeyPrefix+id)
+	pipe.ZRem(ctx, deadLetterIndex, id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *DeadLetterRepository) PurgeDeadLetters(ctx context.Context) (int, error) {
+	ids, err := r.client.ZRange(ctx, deadLetterIndex, 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = deadLetterKeyPrefix + id
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, keys...)
+	pipe.ZRem(ctx, deadLetterIndex, toMembers(ids)...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to purge dead letters: %w", err)
+	}
+
+	return len(ids), nil
+}
+
+func toMembers(ids []string) []interface{} {
+	members := make([]interface{}, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+	return members
+}
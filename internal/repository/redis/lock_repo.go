@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// key of a lock, its value is the owner and it expires with the lease
+const lockKeyPrefix = "lock:"
+
+var (
+	// takes every lock unless one is already held, then returns its key and owner
+	acquireLocksScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	local owner = redis.call('GET', key)
+	if owner then
+		return {key, owner}
+	end
+end
+for _, key in ipairs(KEYS) do
+	redis.call('SET', key, ARGV[1], 'PX', ARGV[2])
+end
+return {}
+`)
+
+	// extends the locks still held by the owner and returns how many there were
+	renewLocksScript = redis.NewScript(`
+local renewed = 0
+for _, key in ipairs(KEYS) do
+	if redis.call('GET', key) == ARGV[1] then
+		redis.call('PEXPIRE', key, ARGV[2])
+		renewed = renewed + 1
+	end
+end
+return renewed
+`)
+
+	releaseLocksScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if redis.call('GET', key) == ARGV[1] then
+		redis.call('DEL', key)
+	end
+end
+return 0
+`)
+)
+
+// Keeps the locks as keys with a TTL, checked and changed by lua scripts
+// so the locks of a task are taken all at once and only their owner changes them
+type LockRepository struct {
+	client *redis.Client
+}
+
+func NewLockRepository(client *redis.Client) *LockRepository {
+	return &LockRepository{
+		client: client,
+	}
+}
+
+func (r *LockRepository) AcquireLocks(ctx context.Context, names []string, owner string, ttl time.Duration) (string, string, error) {
+	held, err := acquireLocksScript.Run(ctx, r.client, getLockKeys(names), owner, ttl.Milliseconds()).StringSlice()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to acquire locks: %w", err)
+	}
+	if len(held) < 2 {
+		return "", "", nil
+	}
+	return strings.TrimPrefix(held[0], lockKeyPrefix), held[1], nil
+}
+
+func (r *LockRepository) RenewLocks(ctx context.Context, names []string, owner string, ttl time.Duration) error {
+	renewed, err := renewLocksScript.Run(ctx, r.client, getLockKeys(names), owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to renew locks: %w", err)
+	}
+	if renewed < len(names) {
+		return fmt.Errorf("lost %d of %d locks", len(names)-renewed, len(names))
+	}
+	return nil
+}
+
+func (r *LockRepository) ReleaseLocks(ctx context.Context, names []string, owner string) error {
+	if err := releaseLocksScript.Run(ctx, r.client, getLockKeys(names), owner).Err(); err != nil {
+		return fmt.Errorf("failed to release locks: %w", err)
+	}
+	return nil
+}
+
+func getLockKeys(names []string) []string {
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = lockKeyPrefix + name
+	}
+	return keys
+}
@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+const (
+	// hash of the counters of the children of a run of a matrix task
+	matrixKeyPrefix = "matrix:"
+	// the groups expire a week after their last change
+	matrixGroupTTL = 7 * 24 * time.Hour
+)
+
+// Keeps the progress of every matrix run in a redis hash updated with HINCRBY
+type MatrixRepository struct {
+	client *redis.Client
+}
+
+func NewMatrixRepository(client *redis.Client) *MatrixRepository {
+	return &MatrixRepository{
+		client: client,
+	}
+}
+
+func (r *MatrixRepository) CreateGroup(ctx context.Context, group *domain.MatrixGroup) error {
+	key := getMatrixKey(group.TaskID, group.RunID)
+
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, map[string]interface{}{
+		"total":     group.Total,
+		"started":   group.Started,
+		"completed": group.Completed,
+		"failed":    group.Failed,
+		"skipped":   group.Skipped,
+	})
+	pipe.Expire(ctx, key, matrixGroupTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to create matrix group: %w", err)
+	}
+	return nil
+}
+
+// FindGroup returns nil without an error if the group does not exist
+func (r *MatrixRepository) FindGroup(ctx context.Context, taskID, runID string) (*domain.MatrixGroup, error) {
+	fields, err := r.client.HGetAll(ctx, getMatrixKey(taskID, runID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matrix group from redis: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return parseMatrixGroup(taskID, runID, fields)
+}
+
+func (r *MatrixRepository) NextChild(ctx context.Context, taskID, runID string) (int, error) {
+	key := getMatrixKey(taskID, runID)
+
+	pipe := r.client.TxPipeline()
+	started := pipe.HIncrBy(ctx, key, "started", 1)
+	pipe.Expire(ctx, key, matrixGroupTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to claim matrix child: %w", err)
+	}
+	return int(started.Val()) - 1, nil
+}
+
+func (r *MatrixRepository) FinishChild(ctx context.Context, taskID, runID string, status domain.TaskStatus) (*domain.MatrixGroup, error) {
+	field := "completed"
+	if status == domain.TaskStatusFailed {
+		field = "failed"
+	}
+	return r.count(ctx, taskID, runID, field)
+}
+
+func (r *MatrixRepository) SkipChild(ctx context.Context, taskID, runID string) (*domain.MatrixGroup, error) {
+	return r.count(ctx, taskID, runID, "skipped")
+}
+
+// Increments the counter and reads the group in the same transaction,
+// so only the last child to finish sees every child finished
+func (r *MatrixRepository) count(ctx context.Context, taskID, runID, field string) (*domain.MatrixGroup, error) {
+	key := getMatrixKey(taskID, runID)
+
+	exists, err := r.client.Exists(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check matrix group: %w", err)
+	}
+	if exists == 0 {
+		return nil, errors.New("matrix group not found")
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.HIncrBy(ctx, key, field, 1)
+	fields := pipe.HGetAll(ctx, key)
+	pipe.Expire(ctx, key, matrixGroupTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to count matrix child: %w", err)
+	}
+	return parseMatrixGroup(taskID, runID, fields.Val())
+}
+
+func parseMatrixGroup(taskID, runID string, fields map[string]string) (*domain.MatrixGroup, error) {
+	group := &domain.MatrixGroup{TaskID: taskID, RunID: runID}
+	counters := map[string]*int{
+		"total":     &group.Total,
+		"started":   &group.Started,
+		"completed": &group.Completed,
+		"failed":    &group.Failed,
+		"skipped":   &group.Skipped,
+	}
+	for name, counter := range counters {
+		n, err := strconv.Atoi(fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse matrix group %s: %w", name, err)
+		}
+		*counter = n
+	}
+	// the claims past the last child count too
+	group.Started = min(group.Started, group.Total)
+	return group, nil
+}
+
+func getMatrixKey(taskID, runID string) string {
+	return matrixKeyPrefix + taskID + ":" + runID
+}
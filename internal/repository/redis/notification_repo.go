@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+const (
+	notificationRuleKeyPrefix = "notification:rule:"
+	notificationRuleIndex     = "notification:rules"
+	// list of the deliveries as JSON, newest first
+	notificationDeliveriesKey = "notification:deliveries"
+	// Deliveries kept in the log
+	maxNotificationDeliveries = 1000
+)
+
+// Stores the notification rules and the delivery log as JSON
+type NotificationRepository struct {
+	client *redis.Client
+}
+
+func NewNotificationRepository(client *redis.Client) *NotificationRepository {
+	return &NotificationRepository{
+		client: client,
+	}
+}
+
+func (r *NotificationRepository) SaveRule(ctx context.Context, rule *domain.NotificationRule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification rule: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, notificationRuleKeyPrefix+rule.ID, data, 0)
+	pipe.SAdd(ctx, notificationRuleIndex, rule.ID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// FindRule returns nil without an error if the rule does not exist
+func (r *NotificationRepository) FindRule(ctx context.Context, id string) (*domain.NotificationRule, error) {
+	data, err := r.client.Get(ctx, notificationRuleKeyPrefix+id).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get notification rule from redis: %w", err)
+	}
+
+	var rule domain.NotificationRule
+	if err := json.Unmarshal([]byte(data), &rule); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal notification rule data: %w", err)
+	}
+	return &rule, nil
+}
+
+func (r *NotificationRepository) ListRules(ctx context.Context) ([]*domain.NotificationRule, error) {
+	ids, err := r.client.SMembers(ctx, notificationRuleIndex).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification rules: %w", err)
+	}
+
+	var rules []*domain.NotificationRule
+
+	for _, id := range ids {
+		rule, err := r.FindRule(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if rule != nil {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+func (r *NotificationRepository) DeleteRule(ctx context.Context, id string) error {
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, notificationRuleKeyPrefix+id)
+	pipe.SRem(ctx, notificationRuleIndex, id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *NotificationRepository) SaveDelivery(ctx context.Context, delivery *domain.NotificationDelivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification delivery: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.LPush(ctx, notificationDeliveriesKey, data)
+	pipe.LTrim(ctx, notificationDeliveriesKey, 0, maxNotificationDeliveries-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *NotificationRepository) ListDeliveries(ctx context.Context, limit int) ([]*domain.NotificationDelivery, error) {
+	items, err := r.client.LRange(ctx, notificationDeliveriesKey, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification deliveries: %w", err)
+	}
+
+	deliveries := make([]*domain.NotificationDelivery, 0, len(items))
+	for _, item := range items {
+		var delivery domain.NotificationDelivery
+		if err := json.Unmarshal([]byte(item), &delivery); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal notification delivery data: %w", err)
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+const (
+	outboxKeyPrefix = "outbox:"
+	// sorted set of the outbox message IDs scored by when a relay can claim them,
+	// their creation time until a relay claims them
+	outboxIndex = "outbox"
+)
+
+// Relays the outbox written by TaskRepository.UpdateWithOutbox
+type OutboxRepository struct {
+	client *redis.Client
+}
+
+func NewOutboxRepository(client *redis.Client) *OutboxRepository {
+	return &OutboxRepository{
+		client: client,
+	}
+}
+
+// Queues in pipe the writes recording the message in the outbox
+func addOutbox(ctx context.Context, pipe redis.Pipeliner, msg *domain.OutboxMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox message: %w", err)
+	}
+
+	pipe.Set(ctx, outboxKeyPrefix+msg.ID, data, 0)
+	pipe.ZAdd(ctx, outboxIndex, redis.Z{
+		Score:  float64(msg.CreatedAt.UnixMilli()),
+		Member: msg.ID,
+	})
+	return nil
+}
+
+// WATCH makes sure each message is claimed by only one relay at a time
+func (r *OutboxRepository) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]*domain.OutboxMessage, error) {
+	var messages []*domain.OutboxMessage
+
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		now := time.Now()
+		ids, err := tx.ZRangeByScore(ctx, outboxIndex, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(now.UnixMilli(), 10),
+			Count: int64(limit),
+		}).Result()
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, id := range ids {
+				pipe.ZAddXX(ctx, outboxIndex, redis.Z{
+					Score:  float64(now.Add(lease).UnixMilli()),
+					Member: id,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			msg, err := r.findOutbox(ctx, id)
+			if err != nil {
+				return err
+			}
+			if msg != nil {
+				messages = append(messages, msg)
+			}
+		}
+		return nil
+	}, outboxIndex)
+
+	// another relay claimed them first
+	if errors.Is(err, redis.TxFailedErr) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+	return messages, nil
+}
+
+// Returns nil without an error if the message does not exist
+func (r *OutboxRepository) findOutbox(ctx context.Context, id string) (*domain.OutboxMessage, error) {
+	data, err := r.client.Get(ctx, outboxKeyPrefix+id).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			// the index entry outlived its message, drop it
+			r.client.ZRem(ctx, outboxIndex, id)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get outbox message from redis: %w", err)
+	}
+
+	var msg domain.OutboxMessage
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		log.Printf("Dropping invalid outbox message %s: %v", id, err)
+		return nil, r.DeleteOutbox(ctx, id)
+	}
+	return &msg, nil
+}
+
+func (r *OutboxRepository) DeleteOutbox(ctx context.Context, id string) error {
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, outboxKeyPrefix+id)
+	pipe.ZRem(ctx, outboxIndex, id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
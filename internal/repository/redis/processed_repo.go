@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const processedKeyPrefix = "processed:"
+
+// Keeps a key with a TTL for every processed task message
+type ProcessedRepository struct {
+	client *redis.Client
+}
+
+func NewProcessedRepository(client *redis.Client) *ProcessedRepository {
+	return &ProcessedRepository{
+		client: client,
+	}
+}
+
+func (r *ProcessedRepository) IsProcessed(ctx context.Context, messageID string) (bool, error) {
+	n, err := r.client.Exists(ctx, processedKeyPrefix+messageID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check processed message: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *ProcessedRepository) MarkProcessed(ctx context.Context, messageID string, ttl time.Duration) error {
+	if err := r.client.Set(ctx, processedKeyPrefix+messageID, time.Now().Unix(), ttl).Err(); err != nil {
+		return fmt.Errorf("failed to mark message as processed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+const (
+	rateLimitKeyPrefix = "rate_limit:"
+	rateLimitIndex     = "rate_limits"
+	// sorted set of the owners running under a limit scored by the end of their lease
+	rateLimitRunningPrefix = "rate_limit_running:"
+	// hash with the tokens left in the bucket of a limit and when they were counted
+	rateLimitBucketPrefix = "rate_limit_bucket:"
+)
+
+var (
+	// checks every limit before counting the start in any, the keys are the running set and the
+	// bucket of each limit and its arguments the cap and the starts per minute. A bucket refills
+	// in a minute, so it expires after one. Returns the position of the full limit and the wait.
+	acquireSlotsScript = redis.NewScript(`
+local owner, now, ttl = ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3])
+local tokens = {}
+for i = 1, #KEYS / 2 do
+	local running, bucket = KEYS[2 * i - 1], KEYS[2 * i]
+	local cap, rate = tonumber(ARGV[2 + 2 * i]), tonumber(ARGV[3 + 2 * i])
+	if cap > 0 then
+		redis.call('ZREMRANGEBYSCORE', running, '-inf', now)
+		if not redis.call('ZSCORE', running, owner) and redis.call('ZCARD', running) >= cap then
+			return {i, 0}
+		end
+	end
+	if rate > 0 then
+		local state = redis.call('HMGET', bucket, 'tokens', 'at')
+		local left = tonumber(state[1]) or rate
+		local at = tonumber(state[2]) or now
+		left = math.min(rate, left + math.max(now - at, 0) * rate / 60000)
+		if left < 1 then
+			return {i, math.ceil((1 - left) * 60000 / rate)}
+		end
+		tokens[i] = left
+	end
+end
+for i = 1, #KEYS / 2 do
+	local running, bucket = KEYS[2 * i - 1], KEYS[2 * i]
+	if tonumber(ARGV[2 + 2 * i]) > 0 then
+		redis.call('ZADD', running, now + ttl, owner)
+		redis.call('PEXPIRE', running, ttl)
+	end
+	if tokens[i] then
+		redis.call('HSET', bucket, 'tokens', tostring(tokens[i] - 1), 'at', now)
+		redis.call('PEXPIRE', bucket, 60000)
+	end
+end
+return {}
+`)
+
+	// extends the slots of the owner in the running sets
+	renewSlotsScript = redis.NewScript(`
+local owner, now, ttl = ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3])
+for _, key in ipairs(KEYS) do
+	if redis.call('ZADD', key, 'XX', 'CH', now + ttl, owner) == 1 then
+		redis.call('PEXPIRE', key, ttl)
+	end
+end
+return 0
+`)
+)
+
+// Stores the rate limits as JSON and enforces them with a sorted set of the running
+// owners and a token bucket per limit, changed by lua scripts so the check and the
+// count of a start happen at once
+type RateLimitRepository struct {
+	client *redis.Client
+}
+
+func NewRateLimitRepository(client *redis.Client) *RateLimitRepository {
+	return &RateLimitRepository{
+		client: client,
+	}
+}
+
+func (r *RateLimitRepository) SetLimit(ctx context.Context, limit *domain.RateLimit) error {
+	existing, err := r.FindLimit(ctx, limit.Name)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	limit.CreatedAt = now
+	if existing != nil {
+		limit.CreatedAt = existing.CreatedAt
+	}
+	limit.UpdatedAt = now
+
+	data, err := json.Marshal(limit)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rate limit: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, getRateLimitKey(limit.Name), data, 0)
+	pipe.SAdd(ctx, rateLimitIndex, limit.Name)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save rate limit: %w", err)
+	}
+	return nil
+}
+
+func (r *RateLimitRepository) FindLimit(ctx context.Context, name string) (*domain.RateLimit, error) {
+	data, err := r.client.Get(ctx, getRateLimitKey(name)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get rate limit from redis: %w", err)
+	}
+
+	var limit domain.RateLimit
+	if err := json.Unmarshal([]byte(data), &limit); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rate limit: %w", err)
+	}
+	return &limit, nil
+}
+
+func (r *RateLimitRepository) ListLimits(ctx context.Context) ([]*domain.RateLimit, error) {
+	names, err := r.client.SMembers(ctx, rateLimitIndex).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rate limits: %w", err)
+	}
+
+	var limits []*domain.RateLimit
+	for _, name := range names {
+		limit, err := r.FindLimit(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if limit != nil {
+			limits = append(limits, limit)
+		}
+	}
+	return limits, nil
+}
+
+// Deletes the limit with its counters
+func (r *RateLimitRepository) DeleteLimit(ctx context.Context, name string) error {
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, getRateLimitKey(name), rateLimitRunningPrefix+name, rateLimitBucketPrefix+name)
+	pipe.SRem(ctx, rateLimitIndex, name)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete rate limit: %w", err)
+	}
+	return nil
+}
+
+func (r *RateLimitRepository) AcquireSlots(ctx context.Context, limits []*domain.RateLimit, owner string,
+	ttl time.Duration) (string, time.Duration, error) {
+	keys := make([]string, 0, 2*len(limits))
+	args := []any{owner, time.Now().UnixMilli(), ttl.Milliseconds()}
+	for _, limit := range limits {
+		keys = append(keys, rateLimitRunningPrefix+limit.Name, rateLimitBucketPrefix+limit.Name)
+		args = append(args, limit.MaxConcurrent, limit.StartsPerMinute)
+	}
+
+	limited, err := acquireSlotsScript.Run(ctx, r.client, keys, args...).Int64Slice()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to acquire rate limit slots: %w", err)
+	}
+	if len(limited) < 2 || limited[0] < 1 || int(limited[0]) > len(limits) {
+		return "", 0, nil
+	}
+	return limits[limited[0]-1].Name, time.Duration(limited[1]) * time.Millisecond, nil
+}
+
+func (r *RateLimitRepository) RenewSlots(ctx context.Context, limits []*domain.RateLimit, owner string, ttl time.Duration) error {
+	keys := getRunningKeys(limits)
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := renewSlotsScript.Run(ctx, r.client, keys, owner, time.Now().UnixMilli(), ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to renew rate limit slots: %w", err)
+	}
+	return nil
+}
+
+func (r *RateLimitRepository) ReleaseSlots(ctx context.Context, limits []*domain.RateLimit, owner string) error {
+	keys := getRunningKeys(limits)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	pipe := r.client.TxPipeline()
+	for _, key := range keys {
+		pipe.ZRem(ctx, key, owner)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to release rate limit slots: %w", err)
+	}
+	return nil
+}
+
+func getRateLimitKey(name string) string {
+	return rateLimitKeyPrefix + name
+}
+
+// The running sets of the limits with a cap
+func getRunningKeys(limits []*domain.RateLimit) []string {
+	var keys []string
+	for _, limit := range limits {
+		if limit.MaxConcurrent > 0 {
+			keys = append(keys, rateLimitRunningPrefix+limit.Name)
+		}
+	}
+	return keys
+}
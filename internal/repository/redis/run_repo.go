@@ -0,0 +1,246 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+const (
+	runKeyPrefix       = "run:"
+	taskRunsPrefix     = "task_runs:"
+	runOutputKeyPrefix = "run_output:"
+	// set when a run is cancelled, the worker running it polls it
+	runCancelKeyPrefix = "run_cancel:"
+	// sorted set of every run as taskID:runID scored by start time
+	runIndex = "runs"
+
+	// value of the stream field of the entry that closes the output
+	outputEOF = "eof"
+	// how long the output of a run is kept after it was last written
+	runOutputTTL = 7 * 24 * time.Hour
+)
+
+// Stores the runs as JSON and their output as a redis stream,
+// so the output can be followed while the process is running
+type RunRepository struct {
+	client *redis.Client
+}
+
+func NewRunRepository(client *redis.Client) *RunRepository {
+	return &RunRepository{
+		client: client,
+	}
+}
+
+func (r *RunRepository) CreateRun(ctx context.Context, run *domain.TaskRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, getRunKey(run.TaskID, run.ID), data, 0)
+	// the runs of a task are indexed by their start time
+	pipe.ZAdd(ctx, taskRunsPrefix+run.TaskID, redis.Z{
+		Score:  float64(run.StartedAt.UnixMilli()),
+		Member: run.ID,
+	})
+	pipe.ZAdd(ctx, runIndex, redis.Z{
+		Score:  float64(run.StartedAt.UnixMilli()),
+		Member: run.TaskID + ":" + run.ID,
+	})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RunRepository) UpdateRun(ctx context.Context, run *domain.TaskRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	return r.client.Set(ctx, getRunKey(run.TaskID, run.ID), data, 0).Err()
+}
+
+// FindRun returns nil without an error if the run does not exist
+func (r *RunRepository) FindRun(ctx context.Context, taskID, runID string) (*domain.TaskRun, error) {
+	data, err := r.client.Get(ctx, getRunKey(taskID, runID)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get run from redis: %w", err)
+	}
+
+	var run domain.TaskRun
+	if err := json.Unmarshal([]byte(data), &run); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal run data: %w", err)
+	}
+	return &run, nil
+}
+
+func (r *RunRepository) ListRuns(ctx context.Context, taskID string) ([]*domain.TaskRun, error) {
+	ids, err := r.client.ZRevRange(ctx, taskRunsPrefix+taskID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	var runs []*domain.TaskRun
+
+	for _, id := range ids {
+		run, err := r.FindRun(ctx, taskID, id)
+		if err != nil {
+			return nil, err
+		}
+		if run != nil {
+			runs = append(runs, run)
+		}
+	}
+
+	return runs, nil
+}
+
+func (r *RunRepository) ListRunsBetween(ctx context.Context, from, to time.Time) ([]*domain.TaskRun, error) {
+	members, err := r.client.ZRangeByScore(ctx, runIndex, &redis.ZRangeBy{
+		Min: fmt.Sprintf("%d", from.UnixMilli()),
+		Max: fmt.Sprintf("%d", to.UnixMilli()),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	var runs []*domain.TaskRun
+
+	for _, member := range members {
+		taskID, runID, _ := strings.Cut(member, ":")
+		run, err := r.FindRun(ctx, taskID, runID)
+		if err != nil {
+			return nil, err
+		}
+		if run != nil {
+			runs = append(runs, run)
+		}
+	}
+
+	return runs, nil
+}
+
+func (r *RunRepository) CancelRun(ctx context.Context, taskID, runID string) error {
+	if err := r.client.Set(ctx, getRunCancelKey(taskID, runID), time.Now().Unix(), 24*time.Hour).Err(); err != nil {
+		return fmt.Errorf("failed to cancel run: %w", err)
+	}
+	return nil
+}
+
+func (r *RunRepository) IsCancelled(ctx context.Context, taskID, runID string) (bool, error) {
+	n, err := r.client.Exists(ctx, getRunCancelKey(taskID, runID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check cancelled run: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *RunRepository) AppendOutput(ctx context.Context, taskID, runID string, stream domain.OutputStream, data []byte) error {
+	return r.addOutput(ctx, taskID, runID, string(stream), data)
+}
+
+func (r *RunRepository) CloseOutput(ctx context.Context, taskID, runID string) error {
+	return r.addOutput(ctx, taskID, runID, outputEOF, nil)
+}
+
+// Adds an entry to the output stream and keeps the stream for runOutputTTL from now,
+// the output of a run whose worker died also expires
+func (r *RunRepository) addOutput(ctx context.Context, taskID, runID, stream string, data []byte) error {
+	key := getRunOutputKey(taskID, runID)
+	pipe := r.client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		Values: map[string]interface{}{"stream": stream, "data": data},
+	})
+	pipe.Expire(ctx, key, runOutputTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Joins all the chunks of the output by stream
+func (r *RunRepository) GetOutput(ctx context.Context, taskID, runID string) (*domain.RunOutput, error) {
+	entries, err := r.client.XRange(ctx, getRunOutputKey(taskID, runID), "-", "+").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run output: %w", err)
+	}
+
+	var stdout, stderr strings.Builder
+	for _, entry := range entries {
+		chunk := toOutputChunk(entry)
+		switch chunk.Stream {
+		case domain.OutputStdout:
+			stdout.WriteString(chunk.Data)
+		case domain.OutputStderr:
+			stderr.WriteString(chunk.Data)
+		}
+	}
+
+	return &domain.RunOutput{
+		Stdout: stdout.String(),
+		Stderr: stderr.String(),
+	}, nil
+}
+
+func (r *RunRepository) ReadOutput(ctx context.Context, taskID, runID, after string, block time.Duration) ([]domain.OutputChunk, bool, error) {
+	// a negative Block leaves the BLOCK option out of XREAD
+	if block <= 0 {
+		block = -1
+	}
+
+	streams, err := r.client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{getRunOutputKey(taskID, runID), after},
+		Block:   block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil // nothing new before the timeout
+		}
+		return nil, false, fmt.Errorf("failed to read run output: %w", err)
+	}
+
+	var chunks []domain.OutputChunk
+	for _, stream := range streams {
+		for _, entry := range stream.Messages {
+			chunk := toOutputChunk(entry)
+			if string(chunk.Stream) == outputEOF {
+				return chunks, true, nil
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	return chunks, false, nil
+}
+
+func toOutputChunk(entry redis.XMessage) domain.OutputChunk {
+	stream, _ := entry.Values["stream"].(string)
+	data, _ := entry.Values["data"].(string)
+	return domain.OutputChunk{
+		ID:     entry.ID,
+		Stream: domain.OutputStream(stream),
+		Data:   data,
+	}
+}
+
+func getRunKey(taskID, runID string) string {
+	return runKeyPrefix + taskID + ":" + runID
+}
+
+func getRunCancelKey(taskID, runID string) string {
+	return runCancelKeyPrefix + taskID + ":" + runID
+}
+
+func getRunOutputKey(taskID, runID string) string {
+	return runOutputKeyPrefix + taskID + ":" + runID
+}
@@ -0,0 +1,148 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/secrets"
+)
+
+const (
+	secretKeyPrefix = "secret:"
+	secretIndex     = "secrets"
+)
+
+// The secret as it is stored in redis, the value is encrypted with the master key
+type storedSecret struct {
+	Name      string    `json:"name"`
+	Value     []byte    `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Stores the secrets encrypted in redis
+type SecretRepository struct {
+	client *redis.Client
+	cipher *secrets.Cipher
+}
+
+func NewSecretRepository(client *redis.Client, cipher *secrets.Cipher) *SecretRepository {
+	return &SecretRepository{
+		client: client,
+		cipher: cipher,
+	}
+}
+
+// Creates or replaces a secret, keeping the original creation time
+func (r *SecretRepository) Set(ctx context.Context, secret *domain.Secret) error {
+	existing, err := r.find(ctx, secret.Name)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	secret.CreatedAt = now
+	if existing != nil {
+		secret.CreatedAt = existing.CreatedAt
+	}
+	secret.UpdatedAt = now
+
+	encrypted, err := r.cipher.Encrypt(secret.Name, []byte(secret.Value))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(storedSecret{
+		Name:      secret.Name,
+		Value:     encrypted,
+		CreatedAt: secret.CreatedAt,
+		UpdatedAt: secret.UpdatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, getSecretKey(secret.Name), data, 0)
+	pipe.SAdd(ctx, secretIndex, secret.Name)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Get returns the secret with its decrypted value or nil if it does not exist
+func (r *SecretRepository) Get(ctx context.Context, name string) (*domain.Secret, error) {
+	stored, err := r.find(ctx, name)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+
+	value, err := r.cipher.Decrypt(stored.Name, stored.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Secret{
+		Name:      stored.Name,
+		Value:     string(value),
+		CreatedAt: stored.CreatedAt,
+		UpdatedAt: stored.UpdatedAt,
+	}, nil
+}
+
+func (r *SecretRepository) List(ctx context.Context) ([]*domain.Secret, error) {
+	names, err := r.client.SMembers(ctx, secretIndex).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	var list []*domain.Secret
+
+	for _, name := range names {
+		stored, err := r.find(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if stored != nil {
+			list = append(list, &domain.Secret{
+				Name:      stored.Name,
+				CreatedAt: stored.CreatedAt,
+				UpdatedAt: stored.UpdatedAt,
+			})
+		}
+	}
+
+	return list, nil
+}
+
+func (r *SecretRepository) Delete(ctx context.Context, name string) error {
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, getSecretKey(name))
+	pipe.SRem(ctx, secretIndex, name)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *SecretRepository) find(ctx context.Context, name string) (*storedSecret, error) {
+	data, err := r.client.Get(ctx, getSecretKey(name)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get secret from redis: %w", err)
+	}
+
+	var stored storedSecret
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret data: %w", err)
+	}
+	return &stored, nil
+}
+
+func getSecretKey(name string) string {
+	return secretKeyPrefix + name
+}
@@ -104,7 +104,33 @@ func (r *TaskRepository) Update(ctx context.Context, task *domain.Task) error {
 		return fmt.Errorf("failed to marshal task: %w", err)
 	}
 	// Update the task in Redis	to no-expire
-	return r.client.Set(ctx, getTaskKey(task.ID), data, 0).Err()
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, getTaskKey(task.ID), data, 0)
+	indexScheduled(ctx, pipe, task)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *TaskRepository) UpdateWithOutbox(ctx context.Context, task *domain.Task, messages ...*domain.OutboxMessage) error {
+	task.UpdatedAt = time.Now()
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	// MULTI/EXEC: the task and its messages are written together or not at all
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, getTaskKey(task.ID), data, 0)
+	indexScheduled(ctx, pipe, task)
+	for _, msg := range messages {
+		if err := addOutbox(ctx, pipe, msg); err != nil {
+			return err
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to update task with outbox: %w", err)
+	}
+	return nil
 }
 
 func (r *TaskRepository) List(ctx context.Context, status domain.TaskStatus) ([]*domain.Task, error) {
@@ -168,6 +194,19 @@ func (r *TaskRepository) FindScheduled(ctx context.Context, from, to time.Time)
 	return tasks, nil
 }
 
+// Moves the task to its scheduled time in the scheduled tasks, e.g. the next occurrence
+// of a recurring task, or removes it when it is no longer scheduled
+func indexScheduled(ctx context.Context, pipe redis.Pipeliner, task *domain.Task) {
+	if task.ScheduledAt.IsZero() {
+		pipe.ZRem(ctx, "scheduled_tasks", task.ID)
+		return
+	}
+	pipe.ZAdd(ctx, "scheduled_tasks", redis.Z{
+		Score:  float64(task.ScheduledAt.Unix()),
+		Member: task.ID,
+	})
+}
+
 func getTaskKey(id string) string {
 	return taskKeyPrefix + id
 }
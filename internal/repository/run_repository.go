@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// The interface for storing the runs of the tasks and their output
+type RunHandler interface {
+	CreateRun(ctx context.Context, run *domain.TaskRun) error
+	UpdateRun(ctx context.Context, run *domain.TaskRun) error
+	FindRun(ctx context.Context, taskID, runID string) (*domain.TaskRun, error)
+	// Lists the runs of a task, newest first
+	ListRuns(ctx context.Context, taskID string) ([]*domain.TaskRun, error)
+	// Lists the runs of every task started in the time range, oldest first
+	ListRunsBetween(ctx context.Context, from, to time.Time) ([]*domain.TaskRun, error)
+	// Asks the worker running the run to kill it
+	CancelRun(ctx context.Context, taskID, runID string) error
+	IsCancelled(ctx context.Context, taskID, runID string) (bool, error)
+
+	AppendOutput(ctx context.Context, taskID, runID string, stream domain.OutputStream, data []byte) error
+	// Marks the output as complete so readers stop waiting for more
+	CloseOutput(ctx context.Context, taskID, runID string) error
+	GetOutput(ctx context.Context, taskID, runID string) (*domain.RunOutput, error)
+	// Returns the chunks written after the chunk with ID after ("0" for the beginning),
+	// waiting up to block for new ones. done is true once the output was closed.
+	ReadOutput(ctx context.Context, taskID, runID, after string, block time.Duration) (chunks []domain.OutputChunk, done bool, err error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// The interface for storing the secrets injected in the tasks
+type SecretHandler interface {
+	Set(ctx context.Context, secret *domain.Secret) error
+	Get(ctx context.Context, name string) (*domain.Secret, error)
+	// Lists the secrets without their values
+	List(ctx context.Context) ([]*domain.Secret, error)
+	Delete(ctx context.Context, name string) error
+}
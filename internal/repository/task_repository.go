@@ -12,6 +12,9 @@ type TaskHandler interface {
 	Create(ctx context.Context, task *domain.Task) error
 	FindById(ctx context.Context, id string) (*domain.Task, error)
 	Update(ctx context.Context, task *domain.Task) error
+	// Updates the task and records the messages in the outbox atomically,
+	// so the messages are published if and only if the update happened
+	UpdateWithOutbox(ctx context.Context, task *domain.Task, messages ...*domain.OutboxMessage) error
 	List(ctx context.Context, status domain.TaskStatus) ([]*domain.Task, error)
 	Delete(ctx context.Context, id string) error
 	FindScheduled(ctx context.Context, from, to time.Time) ([]*domain.Task, error)
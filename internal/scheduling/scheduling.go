@@ -0,0 +1,138 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/repository"
+	"github.com/siluk00/task_scheduler/pkg/config"
+)
+
+// How the scheduled tasks reach the task queue
+const (
+	// The worker publishes the tasks it finds due every 30 seconds
+	ModePoll = "poll"
+	// The worker publishes the tasks due within the horizon ahead of time
+	// and the broker delays their delivery until they are due
+	ModeDelayed = "delayed"
+)
+
+// How far ahead the delayed scheduler queues the tasks, at least 4 seconds
+func Horizon(cfg *config.AppConfig) time.Duration {
+	if cfg.SchedulerHorizonSeconds < 4 {
+		return 4 * time.Second
+	}
+	return time.Duration(cfg.SchedulerHorizonSeconds) * time.Second
+}
+
+// Whether the scheduler queues the task once it is due. A recurring task is queued at every
+// occurrence, also while a run of it is going on, the concurrency policy of the task decides
+// what happens to the new run. Any other task only while it is pending.
+func IsDispatchable(task *domain.Task) bool {
+	if task.Schedule != "" {
+		return !task.Status.IsFinished()
+	}
+	return task.Status == domain.TaskStatusPending
+}
+
+// Queues a task due within the horizon of the delayed scheduler when it is created or
+// updated, instead of waiting up to a quarter of the horizon for the next pass of the scheduler.
+// Returns whether the task was queued, on failure it is left to the scheduler.
+func QueueDueTask(ctx context.Context, cfg *config.AppConfig, repo repository.TaskHandler, task *domain.Task) (bool, error) {
+	if cfg.SchedulerMode != ModeDelayed || !IsDispatchable(task) || task.ScheduledAt.IsZero() ||
+		task.ScheduledAt.After(time.Now().Add(Horizon(cfg))) {
+		return false, nil
+	}
+
+	if err := QueueTask(ctx, repo, nil, task); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Queues the task with the message delivered at its scheduled time, see Dispatch
+func QueueTask(ctx context.Context, repo repository.TaskHandler, outboxReady chan<- struct{}, task *domain.Task) error {
+	return Dispatch(ctx, repo, outboxReady, task, domain.TaskStatusQueued, task.ScheduledAt)
+}
+
+// Saves the task with the message of its run due at its scheduled time, delivered at deliverAt
+// or now if it is zero. The message carries the scheduled time, a task rescheduled since then
+// drops it when it arrives. The task is saved with status, except a recurring task which keeps
+// its status and is saved at its next occurrence instead, so the scheduler queues it again when
+// that one is due whether this run finished or not. The occurrences already missed are skipped.
+// A recurring task without a next occurrence is marked as failed and isn't queued.
+// The task is left unchanged when it can't be saved.
+func Dispatch(ctx context.Context, repo repository.TaskHandler, outboxReady chan<- struct{},
+	task *domain.Task, status domain.TaskStatus, deliverAt time.Time) error {
+	taskMsg := domain.NewTaskMessage(task.ID)
+	taskMsg.DueAt = task.ScheduledAt
+
+	saved := *task
+	if task.Schedule == "" {
+		task.Status = status
+	} else if err := scheduleNext(task); err != nil {
+		// it would otherwise be queued again and again at the same time
+		task.Status = domain.TaskStatusFailed
+		if saveErr := repo.Update(ctx, task); saveErr != nil {
+			*task = saved
+			return fmt.Errorf("failed to mark task as failed: %w", saveErr)
+		}
+		return fmt.Errorf("failed to schedule the next run, marked the task as failed: %w", err)
+	}
+
+	if err := EnqueueTaskMessage(ctx, repo, outboxReady, task, taskMsg, deliverAt); err != nil {
+		*task = saved
+		return err
+	}
+	return nil
+}
+
+// Moves the recurring task to the occurrence after its scheduled time, or after now
+// when it is overdue
+func scheduleNext(task *domain.Task) error {
+	after := time.Now()
+	if task.ScheduledAt.After(after) {
+		after = task.ScheduledAt
+	}
+
+	next, err := task.NextRun(after)
+	if err != nil {
+		return err
+	}
+	if next.IsZero() {
+		return fmt.Errorf("schedule %q has no next run", task.Schedule)
+	}
+	task.ScheduledAt = next
+	return nil
+}
+
+// Saves the task and records in the outbox, in the same transaction, the message taskMsg in the
+// tasks exchange with the routing key of the task queue, delivered at deliverAt or now if it is zero.
+// The outbox relay publishes it, so the message is sent if and only if the task was saved.
+// outboxReady, when not nil, wakes the relay up.
+func EnqueueTaskMessage(ctx context.Context, repo repository.TaskHandler, outboxReady chan<- struct{},
+	task *domain.Task, taskMsg *domain.TaskMessage, deliverAt time.Time) error {
+	taskData, err := json.Marshal(taskMsg)
+	if err != nil {
+		return fmt.Errorf("failed to maarshal task message: %v", err)
+	}
+
+	msg := domain.NewOutboxMessage(messaging.TasksExchange, messaging.TaskRoutingKey(task.Queue), taskData)
+	msg.Mandatory = true
+	msg.DeliverAt = deliverAt
+	msg.TaskID = task.ID
+
+	if err := repo.UpdateWithOutbox(ctx, task, msg); err != nil {
+		return err
+	}
+
+	select {
+	case outboxReady <- struct{}{}:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package secrets
+
+import (
+	"sort"
+	"strings"
+)
+
+// Placeholder written in place of secret values
+const Redacted = "[REDACTED]"
+
+// Replaces secret values in task output and log lines
+type Redactor struct {
+	replacer *strings.Replacer
+	// the secret values, longest first
+	values []string
+}
+
+// Creates a Redactor for the given values, empty values are ignored
+func NewRedactor(values []string) *Redactor {
+	sorted := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			sorted = append(sorted, v)
+		}
+	}
+
+	if len(sorted) == 0 {
+		return &Redactor{}
+	}
+
+	// Longer values first so a secret containing another one is fully replaced
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	oldnew := make([]string, 0, 2*len(sorted))
+	for _, v := range sorted {
+		oldnew = append(oldnew, v, Redacted)
+	}
+
+	return &Redactor{replacer: strings.NewReplacer(oldnew...), values: sorted}
+}
+
+// Returns s with every secret value replaced by Redacted
+func (r *Redactor) Redact(s string) string {
+	if r == nil || r.replacer == nil {
+		return s
+	}
+
+	return r.replacer.Replace(s)
+}
+
+// Splits output written so far into the part that can be released, with the secrets redacted,
+// and the end held back as a secret may start in it and end in the output that follows.
+// The held back end is shorter than the longest secret, unless a secret ends in it.
+func (r *Redactor) RedactPrefix(s string) (string, string) {
+	if r == nil || r.replacer == nil {
+		return s, ""
+	}
+
+	cut := max(len(s)-(len(r.values[0])-1), 0)
+	// a secret written in full across the cut is held back whole
+	for moved := true; moved; {
+		moved = false
+		for _, v := range r.values {
+			for from := max(cut-len(v)+1, 0); from < cut; {
+				i := strings.Index(s[from:], v)
+				if i < 0 || from+i >= cut {
+					break
+				}
+				if from+i+len(v) > cut {
+					cut = from + i
+					moved = true
+					break
+				}
+				from += i + 1
+			}
+		}
+	}
+
+	return r.replacer.Replace(s[:cut]), s[cut:]
+}
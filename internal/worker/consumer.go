@@ -6,18 +6,56 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"time"
 
 	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
 )
 
-// Consumes eveything in the task_queue queue
+// How long a consumer registration lasts, the worker renews it every third of it
+const consumerTTL = 30 * time.Second
+
+// Consumes eveything in the task queues of the worker. The task of each message is read from the
+// repository, so it runs as it is now and not as it was when it was published.
+// A message already processed, of a task that already finished, or published ahead for a scheduled time
+// the task no longer has, is acked without running the task.
+// A message of a task whose lock is held by another run, or that one of the rate limits of the task
+// has no room for, is deferred. One that comes while another run of its task is running follows
+// the concurrency policy of the task, the default lets them overlap.
+// A message that is not a task message, or whose processing fails in every attempt, is dead lettered.
+// If the consumer of a queue fails the others are stopped.
 func (w *TaskWorker) StartConsumer(ctx context.Context) error {
-	msgs, err := w.msgQueue.Consume("tasks_queue")
-	if err != nil {
-		return fmt.Errorf("failed to start consumer: %v", err)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	processor := NewTaskProcessor(w.config, w.taskRepo, w.runRepo, w.secretRepo, w.events)
+	processor.outboxReady = w.outboxReady
+	processor.matrices = w.matrices
+
+	queues := w.queues()
+	errs := make(chan error, len(queues))
+	for _, queue := range queues {
+		go func() {
+			errs <- w.consume(ctx, queue, processor)
+		}()
+	}
+
+	var firstErr error
+	for range queues {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
+		}
 	}
+	return firstErr
+}
 
-	processor := NewTaskProcessor(w.taskRepo)
+func (w *TaskWorker) consume(ctx context.Context, queue string, processor *TaskProcessor) error {
+	msgs, err := w.broker.Consume(ctx, messaging.TaskQueue(queue))
+	if err != nil {
+		return fmt.Errorf("failed to start consumer of queue %s: %v", queue, err)
+	}
 
 	for {
 		select {
@@ -25,26 +63,302 @@ func (w *TaskWorker) StartConsumer(ctx context.Context) error {
 			return nil
 		case msg, ok := <-msgs:
 			if !ok {
-				return errors.New("message channel closed")
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("message channel of queue %s closed", queue)
 			}
 
-			var task domain.Task
-			if err := json.Unmarshal(msg.Body, &task); err != nil {
-				log.Printf("Failed to unmarshall task: %v", err)
-				_ = msg.Nack(false, false)
+			taskMsg, err := domain.ParseTaskMessage(msg.Body())
+			if err != nil {
+				log.Printf("Failed to read task message: %v", err)
+				w.deadLetter(ctx, msg, queue, domain.DeadLetterMalformed, err, deliveryAttempt(msg, 1))
 				continue
 			}
+			attempt := deliveryAttempt(msg, taskMsg.Attempt)
 
-			log.Printf("Processing task %s", task.ID)
-			if err := processor.ProcessTask(ctx, &task); err != nil {
-				log.Printf("Failed to process task %s: %v", task.ID, err)
-				_ = msg.Nack(false, true)
+			task, err := w.taskRepo.FindById(ctx, taskMsg.TaskID)
+			if err == nil && task == nil {
+				log.Printf("Task %s no longer exists, dropping its message", taskMsg.TaskID)
+				_ = msg.Ack()
+				continue
+			}
+			if err == nil && isStale(taskMsg, task) {
+				log.Printf("Task %s was rescheduled to %s, dropping run %s due at %s", task.ID,
+					task.ScheduledAt.Format(time.RFC3339), taskMsg.RunID, taskMsg.DueAt.Format(time.RFC3339))
+				_ = msg.Ack()
+				continue
+			}
+			if err == nil && w.isDuplicate(ctx, taskMsg, task) {
+				_ = msg.Ack()
+				continue
+			}
+			if err == nil {
+				var held, holder string
+				held, holder, err = w.runLocked(ctx, task, taskMsg, func() error {
+					return w.runLimited(ctx, task, taskMsg, func() error {
+						log.Printf("Processing task %s in run %s (attempt %d, correlation %s)",
+							task.ID, taskMsg.RunID, attempt, taskMsg.CorrelationID)
+						return processor.ProcessTask(ctx, task, taskMsg)
+					})
+				})
+				var limited *rateLimitedError
+				if errors.As(err, &limited) {
+					delay := w.rateLimitDelay(limited)
+					log.Printf("Rate limit %s of task %s is reached, deferring run %s for %s", limited.limit, task.ID, taskMsg.RunID, delay)
+					w.deferTask(ctx, msg, queue, taskMsg, delay)
+					continue
+				}
+				if err == nil && held == taskLock(task.ID) {
+					w.handleOverlap(ctx, msg, queue, task, taskMsg, holder)
+					continue
+				}
+				if err == nil && held != "" {
+					log.Printf("Lock %s of task %s is held by %s, deferring run %s", held, task.ID, holder, taskMsg.RunID)
+					w.deferTask(ctx, msg, queue, taskMsg, w.lockRetryDelay())
+					continue
+				}
+			}
+			if err != nil {
+				log.Printf("Failed to process task %s in attempt %d: %v", taskMsg.TaskID, attempt, err)
+				w.retry(ctx, msg, queue, taskMsg, err, attempt)
 				continue
 			}
 
-			if err := msg.Ack(false); err != nil {
+			w.markProcessed(ctx, taskMsg)
+			if err := msg.Ack(); err != nil {
 				log.Printf("failed to ack message %v", err)
 			}
 		}
 	}
 }
+
+// A message is a duplicate if its run already finished or was processed, or its task already finished,
+// the redeliveries after a nack or a lost connection and the outbox publishing twice end here.
+// When the runs or the processed messages can't be read the message is processed, delivering it at
+// least once. A run deferred by the queue and replace policies is recorded as queued, it still runs
+// once the run it waited for finished the task.
+func (w *TaskWorker) isDuplicate(ctx context.Context, taskMsg *domain.TaskMessage, task *domain.Task) bool {
+	// messages from before the envelope have no run ID
+	var run *domain.TaskRun
+	if taskMsg.RunID != "" {
+		var err error
+		if run, err = w.runRepo.FindRun(ctx, task.ID, taskMsg.RunID); err != nil {
+			log.Printf("Failed to read run %s of task %s: %v", taskMsg.RunID, task.ID, err)
+		}
+	}
+	if run != nil && run.Status.IsFinished() {
+		log.Printf("Run %s of task %s already %s, skipping it", run.ID, task.ID, run.Status)
+		return true
+	}
+
+	deferred := run != nil && run.Status == domain.TaskStatusQueued
+	if task.Status.IsFinished() && !deferred {
+		log.Printf("Task %s already %s, skipping run %s", task.ID, task.Status, taskMsg.RunID)
+		return true
+	}
+
+	if w.processed == nil || taskMsg.RunID == "" {
+		return false
+	}
+
+	processed, err := w.processed.IsProcessed(ctx, taskMsg.RunID)
+	if err != nil {
+		log.Printf("Failed to check if run %s was processed: %v", taskMsg.RunID, err)
+		return false
+	}
+	if processed {
+		log.Printf("Run %s of task %s already processed, skipping it", taskMsg.RunID, task.ID)
+	}
+	return processed
+}
+
+// A message published by the scheduler is stale once the task was rescheduled or updated to another
+// time, the message of the new time is the one that runs it. A recurring task moves to its next
+// occurrence as soon as one is queued, its messages are stale once it was rescheduled after them.
+func isStale(taskMsg *domain.TaskMessage, task *domain.Task) bool {
+	if taskMsg.DueAt.IsZero() {
+		return false
+	}
+	if task.Schedule != "" {
+		return task.RescheduledAt.After(taskMsg.EnqueuedAt)
+	}
+	return !taskMsg.DueAt.Equal(task.ScheduledAt)
+}
+
+func (w *TaskWorker) markProcessed(ctx context.Context, taskMsg *domain.TaskMessage) {
+	if w.processed == nil || taskMsg.RunID == "" {
+		return
+	}
+
+	ttl := time.Duration(w.config.DedupTTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	if err := w.processed.MarkProcessed(ctx, taskMsg.RunID, ttl); err != nil {
+		log.Printf("Failed to mark run %s as processed: %v", taskMsg.RunID, err)
+	}
+}
+
+// Returns the number of the current delivery given the attempt of the message. A redelivered
+// message was taken by a consumer that stopped before settling it, which counts as an attempt.
+func deliveryAttempt(msg messaging.Message, attempt int) int {
+	if msg.Redelivered() {
+		attempt++
+	}
+	return attempt
+}
+
+// Publishes the message again in its queue as the next attempt,
+// or dead letters it once the maximum number of attempts is reached
+func (w *TaskWorker) retry(ctx context.Context, msg messaging.Message, queue string, taskMsg *domain.TaskMessage, cause error, attempt int) {
+	if attempt >= w.maxDeliveryAttempts() {
+		w.deadLetter(ctx, msg, queue, domain.DeadLetterMaxAttempts, cause, attempt)
+		return
+	}
+
+	body, err := json.Marshal(taskMsg.Redeliver(attempt + 1))
+	if err != nil {
+		log.Printf("Failed to marshal retry, requeueing: %v", err)
+		_ = msg.Nack(true)
+		return
+	}
+
+	err = w.broker.Publish(ctx, messaging.Publishing{
+		Exchange:   messaging.TasksExchange,
+		RoutingKey: messaging.TaskRoutingKey(queue),
+		Body:       body,
+		Headers:    msg.Headers(),
+		Mandatory:  true,
+	})
+	if err != nil {
+		log.Printf("Failed to publish retry, requeueing: %v", err)
+		_ = msg.Nack(true)
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		log.Printf("failed to ack message %v", err)
+	}
+}
+
+// Publishes the message in the dead letter exchange with the queue, the reason and the error.
+// If that fails the message is rejected, so the broker dead letters it without them.
+func (w *TaskWorker) deadLetter(ctx context.Context, msg messaging.Message, queue, reason string, cause error, attempt int) {
+	headers := msg.Headers()
+	headers[messaging.HeaderQueue] = messaging.TaskQueue(queue)
+	headers[messaging.HeaderAttempts] = strconv.Itoa(attempt)
+	headers[messaging.HeaderDeadLetterReason] = reason
+	headers[messaging.HeaderDeadLetterError] = cause.Error()
+
+	err := w.broker.Publish(ctx, messaging.Publishing{
+		Exchange:   messaging.DeadLetterExchange,
+		RoutingKey: messaging.TaskRoutingKey(queue),
+		Body:       msg.Body(),
+		Headers:    headers,
+		Mandatory:  true,
+	})
+	if err != nil {
+		log.Printf("Failed to dead letter message, rejecting it: %v", err)
+		_ = msg.Nack(false)
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		log.Printf("failed to ack message %v", err)
+	}
+}
+
+func (w *TaskWorker) maxDeliveryAttempts() int {
+	if w.config.MaxDeliveryAttempts < 1 {
+		return 1
+	}
+	return w.config.MaxDeliveryAttempts
+}
+
+// Moves the messages of the dead letter queue to the dead letter store,
+// where they can be inspected, replayed or purged
+func (w *TaskWorker) StartDeadLetterConsumer(ctx context.Context) error {
+	msgs, err := w.broker.Consume(ctx, messaging.DeadLetterQueue)
+	if err != nil {
+		return fmt.Errorf("failed to start dead letter consumer: %v", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return errors.New("message channel closed")
+			}
+
+			letter := toDeadLetter(msg)
+			if err := w.deadLetters.SaveDeadLetter(ctx, letter); err != nil {
+				log.Printf("Failed to store dead letter: %v", err)
+				// wait before the message comes back so a store outage doesn't spin
+				time.Sleep(time.Second)
+				_ = msg.Nack(true)
+				continue
+			}
+
+			log.Printf("Dead letter %s stored (%s)", letter.ID, letter.Reason)
+			if err := msg.Ack(); err != nil {
+				log.Printf("failed to ack message %v", err)
+			}
+		}
+	}
+}
+
+// Reads the reason of the dead letter from the headers set by the worker,
+// or by the broker when the message was rejected
+func toDeadLetter(msg messaging.Message) *domain.DeadLetter {
+	headers := msg.Headers()
+	letter := domain.NewDeadLetter(msg.Body(), headers)
+
+	letter.Queue = headers[messaging.HeaderQueue]
+	if letter.Queue == "" {
+		letter.Queue = messaging.TasksQueue
+	}
+	letter.Reason = headers[messaging.HeaderDeadLetterReason]
+	if letter.Reason == "" {
+		letter.Reason = domain.DeadLetterRejected
+		if queue := headers[messaging.HeaderFirstDeathQueue]; queue != "" {
+			letter.Queue = queue
+		}
+	}
+	letter.Error = headers[messaging.HeaderDeadLetterError]
+	letter.Attempts, _ = strconv.Atoi(headers[messaging.HeaderAttempts])
+
+	if taskMsg, err := domain.ParseTaskMessage(msg.Body()); err == nil {
+		letter.TaskID = taskMsg.TaskID
+	}
+
+	return letter
+}
+
+// Registers the worker as a consumer of its queues until the context is done,
+// the api only accepts tasks for the queues with a registered consumer
+func (w *TaskWorker) registerConsumer(ctx context.Context) {
+	if w.consumers == nil {
+		return
+	}
+
+	ticker := time.NewTicker(consumerTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := w.consumers.RegisterConsumer(ctx, w.id, w.queues(), consumerTTL); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to register consumer: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/scheduling"
+)
+
+// Bytes of the stdout of a run passed to its follow-up tasks
+const followUpOutputBytes = 4096
+
+// Parameters passed to the follow-up tasks as environment variables
+const (
+	ParamParentTask     = "TASK_PARENT_ID"
+	ParamParentRun      = "TASK_PARENT_RUN_ID"
+	ParamParentStatus   = "TASK_PARENT_STATUS"
+	ParamParentExitCode = "TASK_PARENT_EXIT_CODE"
+	// Only with pass_output, the JSON result and the end of the stdout of the run
+	ParamParentResult = "TASK_PARENT_RESULT"
+	ParamParentStdout = "TASK_PARENT_STDOUT"
+)
+
+// Queues the on_success or on_failure tasks of the finished run through the outbox.
+// They share the correlation ID of the run and get its IDs and status as parameters.
+// A follow-up task that no longer exists or is already running or queued is skipped.
+func (p *TaskProcessor) triggerFollowUps(ctx context.Context, task *domain.Task, run *domain.TaskRun) {
+	followUps := task.FollowUps(run.Status)
+	if len(followUps) == 0 {
+		return
+	}
+
+	params := p.followUpParams(ctx, task, run)
+	for _, id := range followUps {
+		followUp, err := p.taskRepo.FindById(ctx, id)
+		if err != nil {
+			log.Printf("Failed to read follow-up task %s of task %s: %v", id, task.ID, err)
+			continue
+		}
+		if followUp == nil {
+			log.Printf("Follow-up task %s of task %s no longer exists, skipping it", id, task.ID)
+			continue
+		}
+		if followUp.Status == domain.TaskStatusRunning || followUp.Status == domain.TaskStatusQueued {
+			log.Printf("Follow-up task %s of task %s is already %s, skipping it", id, task.ID, followUp.Status)
+			continue
+		}
+
+		taskMsg := domain.NewTaskMessage(followUp.ID)
+		if run.CorrelationID != "" {
+			taskMsg.CorrelationID = run.CorrelationID
+		}
+		taskMsg.TriggeredBy = task.ID + "/" + run.ID
+		taskMsg.Params = params
+
+		followUp.Status = domain.TaskStatusRunning
+		followUp.UpdatedAt = time.Now()
+		if err := scheduling.EnqueueTaskMessage(ctx, p.taskRepo, p.outboxReady, followUp, taskMsg, time.Time{}); err != nil {
+			log.Printf("Failed to trigger follow-up task %s of task %s: %v", id, task.ID, err)
+			continue
+		}
+		log.Printf("Task %s triggered follow-up task %s in run %s", task.ID, id, taskMsg.RunID)
+	}
+}
+
+func (p *TaskProcessor) followUpParams(ctx context.Context, task *domain.Task, run *domain.TaskRun) map[string]string {
+	params := map[string]string{
+		ParamParentTask:     task.ID,
+		ParamParentRun:      run.ID,
+		ParamParentStatus:   string(run.Status),
+		ParamParentExitCode: strconv.Itoa(run.ExitCode),
+	}
+	if !task.PassOutput {
+		return params
+	}
+
+	if len(run.Result) > 0 {
+		params[ParamParentResult] = string(run.Result)
+	}
+	output, err := p.runRepo.GetOutput(ctx, task.ID, run.ID)
+	if err != nil {
+		log.Printf("Failed to read output of run %s for its follow-up tasks: %v", run.ID, err)
+	} else if output != nil {
+		stdout := output.Stdout
+		if len(stdout) > followUpOutputBytes {
+			stdout = stdout[len(stdout)-followUpOutputBytes:]
+		}
+		params[ParamParentStdout] = stdout
+	}
+	return params
+}
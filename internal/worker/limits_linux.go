@@ -0,0 +1,129 @@
+//go:build linux
+
+package worker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"golang.org/x/sys/unix"
+)
+
+// The shell waits on fd 3 until the parent applied the limits with prlimit,
+// then execs the task command, which inherits them together with its children
+const limitGateScript = `read _ <&3; exec 3<&-; exec sh -c "$1"`
+
+// Starts the command as uid/gid (when they are not negative) with the limits applied
+func startCommand(cmd *exec.Cmd, limits domain.ResourceLimits, uid, gid int) error {
+	if uid >= 0 || gid >= 0 {
+		cred := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+		if uid >= 0 {
+			cred.Uid = uint32(uid)
+		}
+		if gid >= 0 {
+			cred.Gid = uint32(gid)
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+	}
+
+	if limits.IsZero() {
+		return cmd.Start()
+	}
+
+	gateReader, gateWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create pipe: %w", err)
+	}
+	defer gateWriter.Close()
+
+	// cmd was created as sh -c <command>
+	cmd.Args = []string{"sh", "-c", limitGateScript, "sh", cmd.Args[len(cmd.Args)-1]}
+	cmd.ExtraFiles = []*os.File{gateReader}
+
+	err = cmd.Start()
+	gateReader.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := setLimits(cmd.Process.Pid, limits); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("failed to apply resource limits: %w", err)
+	}
+
+	if _, err := gateWriter.Write([]byte("\n")); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("failed to release the process: %w", err)
+	}
+
+	return nil
+}
+
+func setLimits(pid int, limits domain.ResourceLimits) error {
+	set := func(resource int, soft, hard uint64) error {
+		if soft == 0 {
+			return nil
+		}
+		return unix.Prlimit(pid, resource, &unix.Rlimit{Cur: soft, Max: hard}, nil)
+	}
+
+	// the soft cpu limit sends SIGXCPU, the hard one a second later SIGKILL
+	if err := set(unix.RLIMIT_CPU, limits.CPUTimeSeconds, limits.CPUTimeSeconds+1); err != nil {
+		return fmt.Errorf("cpu time: %w", err)
+	}
+	if err := set(unix.RLIMIT_AS, limits.AddressSpaceBytes, limits.AddressSpaceBytes); err != nil {
+		return fmt.Errorf("address space: %w", err)
+	}
+	if err := set(unix.RLIMIT_NOFILE, limits.OpenFiles, limits.OpenFiles); err != nil {
+		return fmt.Errorf("open files: %w", err)
+	}
+	if err := set(unix.RLIMIT_NPROC, limits.Processes, limits.Processes); err != nil {
+		return fmt.Errorf("processes: %w", err)
+	}
+	if err := set(unix.RLIMIT_FSIZE, limits.FileSizeBytes, limits.FileSizeBytes); err != nil {
+		return fmt.Errorf("file size: %w", err)
+	}
+
+	return nil
+}
+
+// Tells which limit killed the process, or "" if none did. Only the cpu time and the file size
+// limits are enforced with signals, SIGXCPU then SIGKILL and SIGXFSZ, the others make system calls
+// fail inside the process, which exits as it would on any other failure.
+func exceededLimit(state *os.ProcessState, limits domain.ResourceLimits) string {
+	if state == nil || state.Success() {
+		return ""
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		return ""
+	}
+
+	var signal syscall.Signal
+	switch {
+	case status.Signaled():
+		signal = status.Signal()
+	case status.Exited() && status.ExitStatus() > 128:
+		// the shell running the command exits with 128 + the signal that killed it
+		signal = syscall.Signal(status.ExitStatus() - 128)
+	default:
+		return ""
+	}
+
+	// the usage of the process includes the children it waited for
+	cpu := state.UserTime() + state.SystemTime()
+	switch {
+	case limits.CPUTimeSeconds > 0 && (signal == syscall.SIGXCPU ||
+		(signal == syscall.SIGKILL && cpu >= time.Duration(limits.CPUTimeSeconds)*time.Second)):
+		return domain.LimitCPUTime
+	case limits.FileSizeBytes > 0 && signal == syscall.SIGXFSZ:
+		return domain.LimitFileSize
+	}
+	return ""
+}
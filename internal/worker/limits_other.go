@@ -0,0 +1,24 @@
+//go:build !linux
+
+package worker
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// Resource limits and credentials rely on prlimit, which only exists on linux
+func startCommand(cmd *exec.Cmd, limits domain.ResourceLimits, uid, gid int) error {
+	if !limits.IsZero() || uid >= 0 || gid >= 0 {
+		return errors.New("resource limits and run as user are only supported on linux")
+	}
+
+	return cmd.Start()
+}
+
+func exceededLimit(state *os.ProcessState, limits domain.ResourceLimits) string {
+	return ""
+}
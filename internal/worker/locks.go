@@ -0,0 +1,203 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+// Prefix of the lock a task whose runs may not overlap takes, user locks can't contain "/"
+const taskLockPrefix = "task/"
+
+// Runs process holding the locks of the task, renewing their lease until it returns, then releases them.
+// When another run holds one of the locks process doesn't run, the lock and its holder are returned instead.
+// A task whose concurrency policy doesn't allow overlapping runs also takes a lock of its own, see taskLock.
+// A matrix task runs no command, only its children take the locks.
+func (w *TaskWorker) runLocked(ctx context.Context, task *domain.Task, taskMsg *domain.TaskMessage,
+	process func() error) (string, string, error) {
+	names := lockNames(task)
+	if len(names) == 0 || task.Matrix != nil {
+		return "", "", process()
+	}
+	if w.locks == nil {
+		return "", "", errors.New("task declares locks but the lock store is not configured")
+	}
+
+	owner := runOwner(task, taskMsg, w.id)
+	ttl := w.lockTTL()
+	held, holder, err := w.locks.AcquireLocks(ctx, names, owner, ttl)
+	if err != nil || held != "" {
+		return held, holder, err
+	}
+
+	stop := renewLeases(ctx, ttl, "locks of task "+task.ID, func(ctx context.Context) error {
+		return w.locks.RenewLocks(ctx, names, owner, ttl)
+	})
+	err = process()
+	stop()
+
+	if err := w.locks.ReleaseLocks(context.WithoutCancel(ctx), names, owner); err != nil {
+		log.Printf("Failed to release the locks of task %s: %v", task.ID, err)
+	}
+	return "", "", err
+}
+
+// Calls renew every third of ttl until the returned function is called, which waits for it to stop.
+// The task keeps running when the worker stops, so do its leases, described by what in the logs.
+func renewLeases(ctx context.Context, ttl time.Duration, what string, renew func(ctx context.Context) error) func() {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := renew(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("Failed to renew the %s: %v", what, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// Identifies the run of the message in the locks and the rate limits, "<task>/<run>@<worker>"
+func runOwner(task *domain.Task, taskMsg *domain.TaskMessage, workerID string) string {
+	return task.ID + "/" + taskMsg.RunID + "@" + workerID
+}
+
+// Publishes the message again in its queue after the delay instead of waiting for a lock or
+// a rate limit, so the consumer moves on. The message keeps its run and attempt.
+func (w *TaskWorker) deferTask(ctx context.Context, msg messaging.Message, queue string, taskMsg *domain.TaskMessage,
+	delay time.Duration) {
+	err := w.broker.Publish(ctx, messaging.Publishing{
+		Exchange:   messaging.TasksExchange,
+		RoutingKey: messaging.TaskRoutingKey(queue),
+		Body:       msg.Body(),
+		Headers:    msg.Headers(),
+		Delay:      delay,
+	})
+	if err != nil {
+		log.Printf("Failed to defer task %s, requeueing: %v", taskMsg.TaskID, err)
+		_ = msg.Nack(true)
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		log.Printf("failed to ack message %v", err)
+	}
+}
+
+// The locks the task takes, its own lock first so it is the one reported when a run of the task holds it
+func lockNames(task *domain.Task) []string {
+	if task.ConcurrencyPolicy.AllowsOverlap() {
+		return task.Locks
+	}
+	return append([]string{taskLock(task.ID)}, task.Locks...)
+}
+
+// The lock held by the running run of a task whose runs may not overlap
+func taskLock(taskID string) string {
+	return taskLockPrefix + taskID
+}
+
+// Applies the concurrency policy of the task to the run of the message, which came while the
+// run holding the lock of the task is running: forbid skips the new run, replace cancels the
+// running one and defers the new one until it stopped, queue only defers it.
+func (w *TaskWorker) handleOverlap(ctx context.Context, msg messaging.Message, queue string, task *domain.Task,
+	taskMsg *domain.TaskMessage, holder string) {
+	// the holder is "<task>/<run>@<worker>"
+	runID, _, _ := strings.Cut(strings.TrimPrefix(holder, task.ID+"/"), "@")
+
+	switch task.ConcurrencyPolicy {
+	case domain.ConcurrencyForbid:
+		w.skipRun(ctx, msg, task, taskMsg, runID)
+		return
+	case domain.ConcurrencyReplace:
+		if runID != "" && runID != taskMsg.RunID {
+			log.Printf("Run %s of task %s replaces run %s, cancelling it", taskMsg.RunID, task.ID, runID)
+			if err := w.runRepo.CancelRun(ctx, task.ID, runID); err != nil {
+				log.Printf("Failed to cancel run %s of task %s: %v", runID, task.ID, err)
+			}
+		}
+	}
+	log.Printf("Task %s is still running in run %s, deferring run %s", task.ID, runID, taskMsg.RunID)
+	w.recordDeferredRun(ctx, task, taskMsg)
+	w.deferTask(ctx, msg, queue, taskMsg, w.lockRetryDelay())
+}
+
+// Records the deferred run as queued the first time it is deferred, so it shows in the run history
+// and isn't taken for a duplicate once the run it waits for finished the task
+func (w *TaskWorker) recordDeferredRun(ctx context.Context, task *domain.Task, taskMsg *domain.TaskMessage) {
+	if taskMsg.RunID == "" {
+		return
+	}
+	if run, err := w.runRepo.FindRun(ctx, task.ID, taskMsg.RunID); err != nil || run != nil {
+		return
+	}
+
+	run := domain.NewTaskRun(task)
+	run.ID = taskMsg.RunID
+	run.Status = domain.TaskStatusQueued
+	run.CorrelationID = taskMsg.CorrelationID
+	run.TriggeredBy = taskMsg.TriggeredBy
+	if err := w.runRepo.CreateRun(ctx, run); err != nil {
+		log.Printf("Failed to record deferred run %s of task %s: %v", run.ID, task.ID, err)
+	}
+}
+
+// Records the run of the message as skipped without running the task and acks the message
+func (w *TaskWorker) skipRun(ctx context.Context, msg messaging.Message, task *domain.Task,
+	taskMsg *domain.TaskMessage, runningID string) {
+	run := domain.NewTaskRun(task)
+	if taskMsg.RunID != "" {
+		run.ID = taskMsg.RunID
+	}
+	run.CorrelationID = taskMsg.CorrelationID
+	run.TriggeredBy = taskMsg.TriggeredBy
+	run.Finish(domain.TaskStatusSkipped, -1, fmt.Errorf("run %s of the task is still running", runningID))
+	log.Printf("Task %s is still running in run %s, skipping run %s", task.ID, runningID, run.ID)
+
+	if err := w.runRepo.CreateRun(ctx, run); err != nil {
+		log.Printf("Failed to record skipped run %s of task %s: %v", run.ID, task.ID, err)
+	}
+	if err := w.runRepo.CloseOutput(ctx, task.ID, run.ID); err != nil {
+		log.Printf("Failed to close output of run %s: %v", run.ID, err)
+	}
+
+	w.markProcessed(ctx, taskMsg)
+	if err := msg.Ack(); err != nil {
+		log.Printf("failed to ack message %v", err)
+	}
+}
+
+func (w *TaskWorker) lockTTL() time.Duration {
+	if w.config.LockTTLSeconds < 1 {
+		return 30 * time.Second
+	}
+	return time.Duration(w.config.LockTTLSeconds) * time.Second
+}
+
+func (w *TaskWorker) lockRetryDelay() time.Duration {
+	if w.config.LockRetrySeconds < 1 {
+		return time.Second
+	}
+	return time.Duration(w.config.LockRetrySeconds) * time.Second
+}
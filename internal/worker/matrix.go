@@ -0,0 +1,201 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/scheduling"
+)
+
+// Position of the parameter set of a matrix child, from 1, passed with the IDs of the parent run
+const ParamMatrixIndex = "TASK_MATRIX_INDEX"
+
+// Starts the children of the run of a matrix task, up to max_parallel of them.
+// Each child is a task "<task>-<n>" with the command of the task and the n-th
+// parameter set, saved and queued like a follow-up task.
+func (p *TaskProcessor) startMatrix(ctx context.Context, task *domain.Task, run *domain.TaskRun) error {
+	if p.matrices == nil {
+		return errors.New("task has a matrix but the matrix store is not configured")
+	}
+
+	for i := range task.Matrix.Params {
+		child, err := p.taskRepo.FindById(ctx, domain.MatrixChildID(task.ID, i))
+		if err != nil {
+			return fmt.Errorf("failed to read child task: %v", err)
+		}
+		if child != nil && child.Parent != task.ID {
+			return fmt.Errorf("task %s already exists and isn't a child of the matrix", child.ID)
+		}
+	}
+
+	group := &domain.MatrixGroup{TaskID: task.ID, RunID: run.ID, Total: len(task.Matrix.Params)}
+	if err := p.matrices.CreateGroup(ctx, group); err != nil {
+		return err
+	}
+
+	run.Matrix = group
+	if err := p.runRepo.UpdateRun(ctx, run); err != nil {
+		log.Printf("Failed to update run %s of task %s: %v", run.ID, task.ID, err)
+	}
+	p.matrixOutput(ctx, task.ID, run.ID, "Starting %d children, %d at once\n", group.Total, task.Matrix.Parallelism())
+
+	for range task.Matrix.Parallelism() {
+		p.continueMatrix(ctx, task, run.ID, run.CorrelationID, group)
+	}
+	return nil
+}
+
+// Counts the finished run of a matrix child in the group of the parent run that started it
+// and starts the next child. A child run by hand isn't part of any group.
+func (p *TaskProcessor) advanceMatrix(ctx context.Context, child *domain.Task, run *domain.TaskRun) {
+	if child.Parent == "" || p.matrices == nil {
+		return
+	}
+	parentID, runID, ok := strings.Cut(run.TriggeredBy, "/")
+	if !ok || parentID != child.Parent {
+		return
+	}
+
+	parent, err := p.taskRepo.FindById(ctx, parentID)
+	if err != nil {
+		log.Printf("Failed to read matrix task %s of child %s: %v", parentID, child.ID, err)
+		return
+	}
+	if parent == nil {
+		log.Printf("Matrix task %s of child %s no longer exists", parentID, child.ID)
+		return
+	}
+
+	group, err := p.matrices.FinishChild(ctx, parentID, runID, run.Status)
+	if err != nil {
+		log.Printf("Failed to count child %s of run %s: %v", child.ID, runID, err)
+		return
+	}
+	p.matrixOutput(ctx, parentID, runID, "Child %s %s in run %s\n", child.ID, run.Status, run.ID)
+
+	p.continueMatrix(ctx, parent, runID, run.CorrelationID, group)
+}
+
+// Starts the next child of the group unless every child was claimed. Once more children failed than
+// tolerated the next ones are skipped instead, as are the ones whose parameter set was removed.
+// Whoever counts the last child finishes the run of the parent.
+func (p *TaskProcessor) continueMatrix(ctx context.Context, parent *domain.Task, runID, correlationID string,
+	group *domain.MatrixGroup) {
+	for !group.Finished() {
+		i, err := p.matrices.NextChild(ctx, parent.ID, runID)
+		if err != nil {
+			log.Printf("Failed to claim the next child of run %s of task %s: %v", runID, parent.ID, err)
+			return
+		}
+		if i >= group.Total {
+			return
+		}
+
+		if parent.Matrix == nil || i >= len(parent.Matrix.Params) || group.ExceededFailures(parent.Matrix) {
+			group, err = p.matrices.SkipChild(ctx, parent.ID, runID)
+		} else if err = p.spawnChild(ctx, parent, runID, correlationID, i); err == nil {
+			return
+		} else {
+			log.Printf("Failed to start child %d of run %s of task %s: %v", i+1, runID, parent.ID, err)
+			p.matrixOutput(ctx, parent.ID, runID, "Child %s failed to start: %v\n", domain.MatrixChildID(parent.ID, i), err)
+			group, err = p.matrices.FinishChild(ctx, parent.ID, runID, domain.TaskStatusFailed)
+		}
+		if err != nil {
+			log.Printf("Failed to count child %d of run %s of task %s: %v", i+1, runID, parent.ID, err)
+			return
+		}
+	}
+
+	p.finishMatrix(ctx, parent, runID, group)
+}
+
+// Saves the i-th child task of the matrix with the current definition of the parent
+// and queues it, sharing the correlation ID of the parent run
+func (p *TaskProcessor) spawnChild(ctx context.Context, parent *domain.Task, runID, correlationID string, i int) error {
+	now := time.Now()
+	child := &domain.Task{
+		ID:          domain.MatrixChildID(parent.ID, i),
+		Name:        fmt.Sprintf("%s [%d]", parent.Name, i+1),
+		Description: parent.Description,
+		Command:     parent.Command,
+		Status:      domain.TaskStatusRunning,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Secrets:     parent.Secrets,
+		Success:     parent.Success,
+		Limits:      parent.Limits,
+		Labels:      parent.Labels,
+		Queue:       parent.Queue,
+		SLASeconds:  parent.SLASeconds,
+		Steps:       parent.Steps,
+		Locks:       parent.Locks,
+		Parent:      parent.ID,
+		Params:      parent.Matrix.Params[i],
+	}
+
+	existing, err := p.taskRepo.FindById(ctx, child.ID)
+	if err != nil {
+		return fmt.Errorf("failed to read child task: %v", err)
+	}
+	if existing != nil {
+		if existing.Parent != parent.ID {
+			return fmt.Errorf("task %s already exists and isn't a child of the matrix", child.ID)
+		}
+		child.CreatedAt = existing.CreatedAt
+	}
+
+	taskMsg := domain.NewTaskMessage(child.ID)
+	if correlationID != "" {
+		taskMsg.CorrelationID = correlationID
+	}
+	taskMsg.TriggeredBy = parent.ID + "/" + runID
+	taskMsg.Params = map[string]string{
+		ParamParentTask:  parent.ID,
+		ParamParentRun:   runID,
+		ParamMatrixIndex: strconv.Itoa(i + 1),
+	}
+
+	return scheduling.EnqueueTaskMessage(ctx, p.taskRepo, p.outboxReady, child, taskMsg, time.Time{})
+}
+
+// Finishes the run of the matrix task, failed if more children failed than tolerated
+func (p *TaskProcessor) finishMatrix(ctx context.Context, parent *domain.Task, runID string, group *domain.MatrixGroup) {
+	run, err := p.runRepo.FindRun(ctx, parent.ID, runID)
+	if err != nil || run == nil {
+		log.Printf("Failed to read run %s of matrix task %s: %v", runID, parent.ID, err)
+		return
+	}
+
+	run.Matrix = group
+	matrix := parent.Matrix
+	if matrix == nil {
+		matrix = &domain.Matrix{}
+	}
+	if group.ExceededFailures(matrix) {
+		run.Finish(domain.TaskStatusFailed, -1, fmt.Errorf("%d of %d children failed, %d skipped",
+			group.Failed, group.Total, group.Skipped))
+	} else {
+		run.Finish(domain.TaskStatusCompleted, 0, nil)
+	}
+	p.matrixOutput(ctx, parent.ID, runID, "%d children completed, %d failed, %d skipped\n",
+		group.Completed, group.Failed, group.Skipped)
+	log.Printf("Matrix task %s %s in run %s", parent.ID, run.Status, run.ID)
+
+	if err := p.finishRun(ctx, parent, run); err != nil {
+		log.Printf("Failed to finish run %s of matrix task %s: %v", runID, parent.ID, err)
+	}
+}
+
+// Writes the progress of the children to the stdout of the parent run
+func (p *TaskProcessor) matrixOutput(ctx context.Context, taskID, runID, format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+	if err := p.runRepo.AppendOutput(ctx, taskID, runID, domain.OutputStdout, []byte(line)); err != nil {
+		log.Printf("Failed to write output of run %s: %v", runID, err)
+	}
+}
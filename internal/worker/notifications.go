@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+// Sends the notifications of the lifecycle events in the tasks_notifications queue.
+// An event is acked once every matching rule was tried, the failures are in the delivery log.
+func (w *TaskWorker) StartNotificationConsumer(ctx context.Context) error {
+	msgs, err := w.broker.Consume(ctx, messaging.NotificationsQueue)
+	if err != nil {
+		return fmt.Errorf("failed to start notification consumer: %v", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return errors.New("message channel closed")
+			}
+
+			var event domain.Event
+			if err := json.Unmarshal(msg.Body(), &event); err != nil {
+				log.Printf("Dropping invalid event: %v", err)
+				_ = msg.Ack()
+				continue
+			}
+
+			if err := w.notifier.Notify(ctx, &event, w.runOutput(ctx, &event)); err != nil {
+				log.Printf("Failed to notify %s of task %s: %v", event.Type, event.TaskID, err)
+				// wait before the event comes back so a store outage doesn't spin
+				time.Sleep(time.Second)
+				_ = msg.Nack(true)
+				continue
+			}
+
+			if err := msg.Ack(); err != nil {
+				log.Printf("failed to ack message %v", err)
+			}
+		}
+	}
+}
+
+// Returns the output of the run of a finished run event, nil for the other events
+func (w *TaskWorker) runOutput(ctx context.Context, event *domain.Event) *domain.RunOutput {
+	if event.Run == nil || event.Type == domain.EventRunStarted {
+		return nil
+	}
+
+	output, err := w.runRepo.GetOutput(ctx, event.TaskID, event.Run.ID)
+	if err != nil {
+		log.Printf("Failed to read output of run %s: %v", event.Run.ID, err)
+		return nil
+	}
+	return output
+}
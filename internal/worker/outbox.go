@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+const (
+	// How often the relay looks for messages when it isn't woken up
+	outboxInterval = time.Second
+	// How long a claimed message waits before another relay can publish it
+	outboxLease = 10 * time.Second
+	// Messages claimed at once
+	outboxBatch = 100
+)
+
+// Publishes the messages of the outbox until the context is done
+func (w *TaskWorker) relayOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.RelayOutbox(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to relay the outbox: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.outboxReady:
+		}
+	}
+}
+
+// Publishes the messages of the outbox and deletes the confirmed ones. A message that
+// fails to be published stays in the outbox and is published again once its lease expires,
+// so it is delivered at least once. The task of an unroutable message goes back to pending.
+func (w *TaskWorker) RelayOutbox(ctx context.Context) error {
+	messages, err := w.outbox.ClaimOutbox(ctx, outboxBatch, outboxLease)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		err := w.broker.Publish(ctx, messaging.Publishing{
+			Exchange:   msg.Exchange,
+			RoutingKey: msg.RoutingKey,
+			Body:       msg.Body,
+			Headers:    msg.Headers,
+			Mandatory:  msg.Mandatory,
+			Delay:      time.Until(msg.DeliverAt),
+		})
+
+		if errors.Is(err, messaging.ErrUnroutable) && msg.TaskID != "" {
+			w.revertTask(ctx, msg.TaskID, err)
+		} else if err != nil {
+			log.Printf("Failed to publish outbox message %s, it will be retried: %v", msg.ID, err)
+			continue
+		}
+
+		if err := w.outbox.DeleteOutbox(ctx, msg.ID); err != nil {
+			log.Printf("Failed to delete outbox message %s: %v", msg.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Reverts the task to pending unless it already moved on
+func (w *TaskWorker) revertTask(ctx context.Context, taskID string, cause error) {
+	task, err := w.taskRepo.FindById(ctx, taskID)
+	if err != nil {
+		log.Printf("Failed to revert task %s to pending: %v", taskID, err)
+		return
+	}
+	if task != nil && (task.Status == domain.TaskStatusRunning || task.Status == domain.TaskStatusQueued) {
+		w.revertToPending(ctx, task, cause)
+	}
+}
@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/repository"
+	"github.com/siluk00/task_scheduler/internal/secrets"
+)
+
+// Captures one output stream of a run: keeps up to limit bytes in memory
+// and forwards them to the run repository as they are written.
+// Output over the limit is dropped, it never fails the process.
+// The end of what was written is held back until Flush when it could be the
+// start of a secret, so a secret split between two writes is still redacted.
+// The last limit bytes are kept apart too, for the success criteria to see the end of the output.
+type outputWriter struct {
+	ctx       context.Context
+	runRepo   repository.RunHandler
+	run       *domain.TaskRun
+	stream    domain.OutputStream
+	redactor  *secrets.Redactor
+	limit     int
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	truncated bool
+	// written but not forwarded yet
+	pending string
+	tail    *tailWriter
+	written int
+}
+
+func newOutputWriter(ctx context.Context, runRepo repository.RunHandler, run *domain.TaskRun,
+	stream domain.OutputStream, redactor *secrets.Redactor, limit int) *outputWriter {
+	return &outputWriter{
+		ctx:      ctx,
+		runRepo:  runRepo,
+		run:      run,
+		stream:   stream,
+		redactor: redactor,
+		limit:    limit,
+		tail:     newTailWriter(limit),
+	}
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.tail.Write(p)
+	w.written += len(p)
+
+	chunk := p
+	if remaining := w.limit - w.buf.Len(); len(chunk) > remaining {
+		chunk = chunk[:max(remaining, 0)]
+		w.truncated = true
+	}
+
+	if len(chunk) > 0 {
+		w.buf.Write(chunk)
+		var redacted string
+		redacted, w.pending = w.redactor.RedactPrefix(w.pending + string(chunk))
+		w.store(redacted)
+	}
+
+	return len(p), nil
+}
+
+// Forwards the output held back, once the process exited
+func (w *outputWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.store(w.redactor.Redact(w.pending))
+	w.pending = ""
+}
+
+func (w *outputWriter) store(redacted string) {
+	if redacted == "" {
+		return
+	}
+	if err := w.runRepo.AppendOutput(w.ctx, w.run.TaskID, w.run.ID, w.stream, []byte(redacted)); err != nil {
+		log.Printf("Failed to store %s of run %s: %v", w.stream, w.run.ID, err)
+	}
+}
+
+// Returns the output the success criteria are checked against with the secrets redacted,
+// all of it or, once it was truncated, its start followed by its last limit bytes
+func (w *outputWriter) Checked() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.truncated {
+		return w.redactor.Redact(w.buf.String())
+	}
+	tail := w.tail.String()
+	if skipped := w.written - w.buf.Len() - len(tail); skipped > 0 {
+		// the middle of the output was never kept
+		return w.redactor.Redact(w.buf.String()) + "\n" + w.redactor.Redact(tail)
+	}
+	return w.redactor.Redact(w.buf.String() + tail[w.buf.Len()+len(tail)-w.written:])
+}
+
+func (w *outputWriter) Truncated() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.truncated
+}
@@ -2,28 +2,67 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"os/exec"
 	"time"
 
 	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/events"
 	"github.com/siluk00/task_scheduler/internal/repository"
+	"github.com/siluk00/task_scheduler/internal/secrets"
+	"github.com/siluk00/task_scheduler/pkg/config"
 )
 
-// Contains the interface for performing CRUD operations on Task
+// How often a running task checks if its run was cancelled
+const cancelCheckInterval = time.Second
+
+// How many times a finished task is saved before giving up, and the first wait between the attempts
+const (
+	taskSaveAttempts   = 4
+	taskSaveRetryDelay = 100 * time.Millisecond
+)
+
+var errRunCancelled = errors.New("run was cancelled")
+
+// Contains the interface for performing CRUD operations on Task, the runs
+// and the secrets store, which is nil when it is not configured,
+// and the publisher of the run events
 type TaskProcessor struct {
-	taskRepo repository.TaskHandler
+	config     *config.AppConfig
+	taskRepo   repository.TaskHandler
+	runRepo    repository.RunHandler
+	secretRepo repository.SecretHandler
+	events     *events.Publisher
+	// tracks the children of the matrix tasks, may be nil
+	matrices repository.MatrixHandler
+	// wakes the outbox relay up when follow-up tasks are queued, may be nil
+	outboxReady chan struct{}
 }
 
-func NewTaskProcessor(repo repository.TaskHandler) *TaskProcessor {
+func NewTaskProcessor(cfg *config.AppConfig, repo repository.TaskHandler, runRepo repository.RunHandler,
+	secretRepo repository.SecretHandler, publisher *events.Publisher) *TaskProcessor {
 	return &TaskProcessor{
-		taskRepo: repo,
+		config:     cfg,
+		taskRepo:   repo,
+		runRepo:    runRepo,
+		secretRepo: secretRepo,
+		events:     publisher,
 	}
 }
 
 // Processes the task, executes it, returns any errors and updates the task state
-func (p *TaskProcessor) ProcessTask(ctx context.Context, task *domain.Task) error {
+// Each execution is recorded as a run with its captured output, the run takes
+// its ID and correlation ID from the message when there is one.
+// run.started is published once the run is recorded, run.succeeded or run.failed when it finishes,
+// followed by run.sla_missed if it took longer than the SLA of the task.
+// Once the task is saved its follow-up tasks are triggered. When it can't be saved the run is
+// failed with the error instead, the command already ran so the message isn't retried.
+// A matrix task only starts its children, the last one to finish finishes its run.
+func (p *TaskProcessor) ProcessTask(ctx context.Context, task *domain.Task, msg *domain.TaskMessage) error {
 	if task.Status != domain.TaskStatusRunning {
 		task.Status = domain.TaskStatusRunning
 		task.UpdatedAt = time.Now()
@@ -32,26 +71,293 @@ func (p *TaskProcessor) ProcessTask(ctx context.Context, task *domain.Task) erro
 		}
 	}
 
-	output, err := p.executeCommand(task.Command)
-	if err != nil {
-		task.Status = domain.TaskStatusFailed
-		log.Printf("Task %s failed: %v, Output: %s", task.ID, err, output)
+	run := domain.NewTaskRun(task)
+	if msg != nil {
+		if msg.RunID != "" {
+			run.ID = msg.RunID
+		}
+		run.CorrelationID = msg.CorrelationID
+		run.TriggeredBy = msg.TriggeredBy
+	}
+	if err := p.runRepo.CreateRun(ctx, run); err != nil {
+		return fmt.Errorf("failed to create run: %v", err)
+	}
+	p.events.Publish(ctx, domain.NewRunEvent(task, run))
+
+	if task.Matrix == nil {
+		p.execute(ctx, task, run, msg)
+	} else if err := p.startMatrix(ctx, task, run); err != nil {
+		run.Finish(domain.TaskStatusFailed, -1, err)
+		log.Printf("Task %s failed in run %s: %v", task.ID, run.ID, err)
 	} else {
-		task.Status = domain.TaskStatusCompleted
-		log.Printf("Task %s completed succesfully, output: %s", task.ID, output)
+		return nil
+	}
+
+	if err := p.finishRun(ctx, task, run); err != nil {
+		log.Printf("Failed to finish run %s of task %s: %v", run.ID, task.ID, err)
+		return nil
 	}
+	p.advanceMatrix(ctx, task, run)
+	return nil
+}
 
+// Saves the task with the status of the finished run, or pending if it is recurring, then saves
+// the run, publishes the run events and triggers the follow-up tasks. When the task can't be saved,
+// even after retrying, the run is failed with the error and the error is returned.
+func (p *TaskProcessor) finishRun(ctx context.Context, task *domain.Task, run *domain.TaskRun) error {
+	task.Status = run.Status
+	if task.Schedule != "" {
+		p.keepSchedule(ctx, task)
+	}
 	task.UpdatedAt = time.Now()
-	if err := p.taskRepo.Update(ctx, task); err != nil {
-		return fmt.Errorf("failed to update task status: %v", err)
+
+	saveErr := p.saveTask(ctx, task)
+	if saveErr != nil {
+		saveErr = fmt.Errorf("failed to update task status: %v", saveErr)
+		run.Finish(domain.TaskStatusFailed, run.ExitCode, saveErr)
+		task.Status = domain.TaskStatusFailed
+	}
+
+	if err := p.runRepo.UpdateRun(ctx, run); err != nil {
+		log.Printf("Failed to update run %s of task %s: %v", run.ID, task.ID, err)
+	}
+	if err := p.runRepo.CloseOutput(ctx, task.ID, run.ID); err != nil {
+		log.Printf("Failed to close output of run %s: %v", run.ID, err)
+	}
+	p.events.Publish(ctx, domain.NewRunEvent(task, run))
+	if run.MissedSLA(task) {
+		event := domain.NewRunEvent(task, run)
+		event.Type = domain.EventRunSLAMissed
+		p.events.Publish(ctx, event)
+	}
+	if saveErr != nil {
+		return saveErr
 	}
 
+	p.triggerFollowUps(ctx, task, run)
 	return nil
 }
 
-// Executes the task
-func (p *TaskProcessor) executeCommand(cmdString string) (string, error) {
-	cmd := exec.Command("sh", "-c", cmdString)
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+// Updates the task, trying again with backoff when the repository fails
+func (p *TaskProcessor) saveTask(ctx context.Context, task *domain.Task) error {
+	delay := taskSaveRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := p.taskRepo.Update(ctx, task)
+		if err == nil || attempt == taskSaveAttempts {
+			return err
+		}
+		log.Printf("Failed to save task %s, retrying in %s: %v", task.ID, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// Once a run of a recurring task finished the task goes back to pending. The scheduler moved it
+// to its next occurrence when it queued this one, and may have queued more since, so the
+// scheduled time is taken from the stored task. A task the scheduler failed stays failed.
+func (p *TaskProcessor) keepSchedule(ctx context.Context, task *domain.Task) {
+	task.Status = domain.TaskStatusPending
+
+	stored, err := p.taskRepo.FindById(ctx, task.ID)
+	if err != nil || stored == nil {
+		log.Printf("Failed to read the schedule of task %s, keeping %s: %v", task.ID, task.ScheduledAt.Format(time.RFC3339), err)
+		return
+	}
+	task.ScheduledAt = stored.ScheduledAt
+	task.RescheduledAt = stored.RescheduledAt
+	if stored.Status == domain.TaskStatusFailed {
+		task.Status = domain.TaskStatusFailed
+	}
+}
+
+// Runs the command of the task and finishes the run with the result.
+// The params of the task and of the message are passed as environment variables,
+// the ones of the message take precedence and the secrets over both.
+func (p *TaskProcessor) execute(ctx context.Context, task *domain.Task, run *domain.TaskRun, msg *domain.TaskMessage) {
+	env, redactor, err := p.resolveSecrets(ctx, task)
+	if err != nil {
+		run.Finish(domain.TaskStatusFailed, -1, err)
+		log.Printf("Task %s failed: %v", task.ID, err)
+		return
+	}
+	var msgParams map[string]string
+	if msg != nil {
+		msgParams = msg.Params
+	}
+	if len(task.Params) > 0 || len(msgParams) > 0 {
+		params := make([]string, 0, len(task.Params)+len(msgParams)+len(env))
+		for name, value := range task.Params {
+			params = append(params, name+"="+value)
+		}
+		for name, value := range msgParams {
+			params = append(params, name+"="+value)
+		}
+		env = append(params, env...)
+	}
+
+	stdout := newOutputWriter(ctx, p.runRepo, run, domain.OutputStdout, redactor, p.config.OutputMaxBytes)
+	stderr := newOutputWriter(ctx, p.runRepo, run, domain.OutputStderr, redactor, p.config.OutputMaxBytes)
+	defer stdout.Flush()
+	defer stderr.Flush()
+
+	runCtx, stop := p.watchCancel(ctx, run)
+	defer stop()
+
+	limits := task.Limits.WithDefaults(p.defaultLimits())
+	if len(task.Steps) > 0 {
+		p.executeSteps(ctx, runCtx, task, run, env, redactor, limits, stdout, stderr)
+		return
+	}
+
+	started := time.Now()
+	state, err := p.executeCommand(runCtx, task.Command, env, limits, stdout, stderr, 0)
+	run.Usage = resourceUsage(state, time.Since(started))
+	run.OutputTruncated = stdout.Truncated() || stderr.Truncated()
+	run.LimitExceeded = exceededLimit(state, limits)
+
+	exitCode := -1
+	if state != nil {
+		exitCode = state.ExitCode()
+	}
+
+	// a non zero exit code is judged by the success criteria, any other error
+	// means the process didn't run or didn't exit normally
+	var exitErr *exec.ExitError
+	if err != nil && (!errors.As(err, &exitErr) || exitCode < 0) {
+		run.Finish(domain.TaskStatusFailed, exitCode, err)
+		log.Printf("Task %s failed in run %s: %v", task.ID, run.ID, err)
+		return
+	}
+
+	result, err := task.Success.Evaluate(exitCode, stdout.Checked(), stderr.Checked())
+	run.Result = result
+	if err != nil {
+		run.Finish(domain.TaskStatusFailed, exitCode, err)
+		log.Printf("Task %s failed in run %s: %v", task.ID, run.ID, err)
+		return
+	}
+
+	run.Finish(domain.TaskStatusCompleted, exitCode, nil)
+	log.Printf("Task %s completed succesfully in run %s", task.ID, run.ID)
+}
+
+// Loads the secrets referenced by the task and returns them as environment
+// variables together with a redactor for their values
+func (p *TaskProcessor) resolveSecrets(ctx context.Context, task *domain.Task) ([]string, *secrets.Redactor, error) {
+	if len(task.Secrets) == 0 {
+		return nil, nil, nil
+	}
+
+	if p.secretRepo == nil {
+		return nil, nil, errors.New("task references secrets but the secrets store is not configured")
+	}
+
+	env := make([]string, 0, len(task.Secrets))
+	values := make([]string, 0, len(task.Secrets))
+
+	for _, name := range task.Secrets {
+		secret, err := p.secretRepo.Get(ctx, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load secret %s: %v", name, err)
+		}
+		if secret == nil {
+			return nil, nil, fmt.Errorf("secret %s not found", name)
+		}
+		env = append(env, name+"="+secret.Value)
+		values = append(values, secret.Value)
+	}
+
+	return env, secrets.NewRedactor(values), nil
+}
+
+// Executes the command with the extra environment variables and the resource limits,
+// writing its output to stdout and stderr. The process is killed when the run is cancelled
+// through ctx and after the timeout unless it is 0. The state is nil if the process didn't start
+func (p *TaskProcessor) executeCommand(ctx context.Context, cmdString string, env []string, limits domain.ResourceLimits,
+	stdout, stderr io.Writer, timeout time.Duration) (*os.ProcessState, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", cmdString)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// children left behind by a killed shell can't hold its output open for long
+	cmd.WaitDelay = time.Second
+
+	if err := startCommand(cmd, limits, p.config.RunAsUID, p.config.RunAsGID); err != nil {
+		return nil, err
+	}
+
+	err := cmd.Wait()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return cmd.ProcessState, fmt.Errorf("timed out after %s", timeout)
+	}
+	if ctx.Err() != nil {
+		return cmd.ProcessState, errRunCancelled
+	}
+	return cmd.ProcessState, err
+}
+
+// Returns a context cancelled once the run is cancelled, which is checked every second until stop
+// is called. It isn't cancelled with ctx, a stopping worker lets the run finish.
+func (p *TaskProcessor) watchCancel(ctx context.Context, run *domain.TaskRun) (context.Context, context.CancelFunc) {
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	go func() {
+		ticker := time.NewTicker(cancelCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				cancelled, err := p.runRepo.IsCancelled(runCtx, run.TaskID, run.ID)
+				if err != nil {
+					log.Printf("Failed to check if run %s was cancelled: %v", run.ID, err)
+					continue
+				}
+				if cancelled {
+					log.Printf("Run %s of task %s was cancelled, killing it", run.ID, run.TaskID)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return runCtx, cancel
+}
+
+// Builds the usage of the run from the state of the finished process
+func resourceUsage(state *os.ProcessState, wallTime time.Duration) *domain.ResourceUsage {
+	usage := &domain.ResourceUsage{WallTimeMs: wallTime.Milliseconds()}
+	if state != nil {
+		usage.UserCPUMs = state.UserTime().Milliseconds()
+		usage.SystemCPUMs = state.SystemTime().Milliseconds()
+		usage.MaxRSSKB = maxRSSKB(state)
+	}
+	return usage
+}
+
+// The limits of the worker configuration, used when a task doesn't set them
+func (p *TaskProcessor) defaultLimits() domain.ResourceLimits {
+	return domain.ResourceLimits{
+		CPUTimeSeconds:    uint64(max(p.config.LimitCPUSeconds, 0)),
+		AddressSpaceBytes: uint64(max(p.config.LimitAddressSpaceBytes, 0)),
+		OpenFiles:         uint64(max(p.config.LimitOpenFiles, 0)),
+		Processes:         uint64(max(p.config.LimitProcesses, 0)),
+		FileSizeBytes:     uint64(max(p.config.LimitFileSizeBytes, 0)),
+	}
 }
@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+)
+
+// A run not started because one of the rate limits of its task had no room for it
+type rateLimitedError struct {
+	limit string
+	// until the limit allows the next start, 0 when it waits for a run to finish
+	wait time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limit %s reached", e.limit)
+}
+
+// Runs process once every rate limit matching the task has room for it, holding a running slot in
+// the capped ones until it returns. Otherwise process doesn't run and a *rateLimitedError is returned.
+// A matrix task runs no command, only its children count.
+func (w *TaskWorker) runLimited(ctx context.Context, task *domain.Task, taskMsg *domain.TaskMessage,
+	process func() error) error {
+	if w.rateLimits == nil || task.Matrix != nil {
+		return process()
+	}
+
+	all, err := w.rateLimits.ListLimits(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read rate limits: %v", err)
+	}
+	limits := matchingLimits(task, all)
+	if len(limits) == 0 {
+		return process()
+	}
+
+	owner := runOwner(task, taskMsg, w.id)
+	ttl := w.lockTTL()
+	limited, wait, err := w.rateLimits.AcquireSlots(ctx, limits, owner, ttl)
+	if err != nil {
+		return err
+	}
+	if limited != "" {
+		return &rateLimitedError{limit: limited, wait: wait}
+	}
+
+	stop := renewLeases(ctx, ttl, "rate limit slots of task "+task.ID, func(ctx context.Context) error {
+		return w.rateLimits.RenewSlots(ctx, limits, owner, ttl)
+	})
+	err = process()
+	stop()
+
+	if err := w.rateLimits.ReleaseSlots(context.WithoutCancel(ctx), limits, owner); err != nil {
+		log.Printf("Failed to release the rate limit slots of task %s: %v", task.ID, err)
+	}
+	return err
+}
+
+// The limits of the queue of the task and of its labels
+func matchingLimits(task *domain.Task, limits []*domain.RateLimit) []*domain.RateLimit {
+	queue := task.Queue
+	if queue == "" {
+		queue = messaging.DefaultTaskQueue
+	}
+
+	var matching []*domain.RateLimit
+	for _, limit := range limits {
+		if limit.Matches(task, queue) {
+			matching = append(matching, limit)
+		}
+	}
+	return matching
+}
+
+// The delay of a run deferred by the rate limit, waiting for the next start it allows
+// or, when it waits for a run to finish, as long as for a lock
+func (w *TaskWorker) rateLimitDelay(limited *rateLimitedError) time.Duration {
+	if limited.wait > 0 {
+		return limited.wait
+	}
+	return w.lockRetryDelay()
+}
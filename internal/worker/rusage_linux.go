@@ -0,0 +1,16 @@
+//go:build linux
+
+package worker
+
+import (
+	"os"
+	"syscall"
+)
+
+// Peak resident set size of the process and its waited children, linux reports it in KB
+func maxRSSKB(state *os.ProcessState) int64 {
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return rusage.Maxrss
+	}
+	return 0
+}
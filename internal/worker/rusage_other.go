@@ -0,0 +1,10 @@
+//go:build !linux
+
+package worker
+
+import "os"
+
+// The unit of ru_maxrss changes between systems, so it is only reported on linux
+func maxRSSKB(state *os.ProcessState) int64 {
+	return 0
+}
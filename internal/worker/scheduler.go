@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/scheduling"
+)
+
+// Queues the tasks due within the horizon to be delivered when they are due,
+// marking them as queued or, for the recurring ones, moving them to their next occurrence. It waits a quarter of the horizon before finishing.
+func (w *TaskWorker) queueDelayedTasks(ctx context.Context) error {
+	now := time.Now()
+	horizon := scheduling.Horizon(w.config)
+
+	// starting a horizon back also catches the tasks created after the previous pass
+	// that were due before this one
+	tasks, err := w.taskRepo.FindScheduled(ctx, now.Add(-horizon), now.Add(horizon))
+	if err != nil {
+		return fmt.Errorf("error finding scheduled tasks: %v", err)
+	}
+
+	for _, task := range tasks {
+		// a recurring task is queued at each of its occurrences within the horizon
+		for scheduling.IsDispatchable(task) && !task.ScheduledAt.After(now.Add(horizon)) {
+			dueAt := task.ScheduledAt
+			if err := scheduling.QueueTask(ctx, w.taskRepo, w.outboxReady, task); err != nil {
+				log.Printf("Failed to queue task %s: %v", task.ID, err)
+				break
+			}
+			log.Printf("Task %s queued to run at %s", task.ID, dueAt.Format(time.RFC3339))
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(horizon / 4):
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/secrets"
+)
+
+// Bytes of stdout and of stderr kept in the result of each step
+const stepOutputBytes = 4096
+
+// Runs the steps of the task in order and finishes the run. A failed step fails the run and the
+// steps after it are skipped, unless it continues on error. Once every step ran the output of the
+// run is judged by the success criteria, as the output of a command that exited with 0.
+// The run is saved before every step so its progress can be followed. A cancelled run stops at once.
+func (p *TaskProcessor) executeSteps(ctx, runCtx context.Context, task *domain.Task, run *domain.TaskRun, env []string,
+	redactor *secrets.Redactor, limits domain.ResourceLimits, stdout, stderr *outputWriter) {
+	run.Steps = make([]domain.StepResult, len(task.Steps))
+	for i := range task.Steps {
+		run.Steps[i] = domain.StepResult{Name: task.Steps[i].DisplayName(i), Status: domain.StepStatusPending}
+	}
+	run.Usage = &domain.ResourceUsage{}
+	started := time.Now()
+
+	for i, step := range task.Steps {
+		result := &run.Steps[i]
+		result.Status = domain.StepStatusRunning
+		result.StartedAt = time.Now()
+		if err := p.runRepo.UpdateRun(ctx, run); err != nil {
+			log.Printf("Failed to update run %s of task %s: %v", run.ID, task.ID, err)
+		}
+
+		stepStdout, stepStderr := newTailWriter(stepOutputBytes), newTailWriter(stepOutputBytes)
+		state, err := p.executeCommand(runCtx, step.Command, env, limits,
+			io.MultiWriter(stdout, stepStdout), io.MultiWriter(stderr, stepStderr), step.Timeout())
+
+		result.FinishedAt = time.Now()
+		result.Usage = resourceUsage(state, result.FinishedAt.Sub(result.StartedAt))
+		addUsage(run.Usage, result.Usage)
+		result.Output = &domain.RunOutput{
+			Stdout: redactor.Redact(stepStdout.String()),
+			Stderr: redactor.Redact(stepStderr.String()),
+		}
+		result.ExitCode = -1
+		if state != nil {
+			result.ExitCode = state.ExitCode()
+		}
+
+		if err == nil {
+			result.Status = domain.StepStatusCompleted
+			continue
+		}
+
+		result.Status = domain.StepStatusFailed
+		result.Error = err.Error()
+		if step.ContinueOnError && runCtx.Err() == nil {
+			log.Printf("Step %s of task %s failed in run %s, continuing: %v", result.Name, task.ID, run.ID, err)
+			continue
+		}
+
+		for j := i + 1; j < len(run.Steps); j++ {
+			run.Steps[j].Status = domain.StepStatusSkipped
+		}
+		run.Usage.WallTimeMs = time.Since(started).Milliseconds()
+		run.OutputTruncated = stdout.Truncated() || stderr.Truncated()
+		run.LimitExceeded = exceededLimit(state, limits)
+		run.Finish(domain.TaskStatusFailed, result.ExitCode, fmt.Errorf("step %s failed: %w", result.Name, err))
+		log.Printf("Task %s failed in step %s of run %s: %v", task.ID, result.Name, run.ID, err)
+		return
+	}
+
+	run.Usage.WallTimeMs = time.Since(started).Milliseconds()
+	run.OutputTruncated = stdout.Truncated() || stderr.Truncated()
+
+	result, err := task.Success.Evaluate(0, stdout.Checked(), stderr.Checked())
+	run.Result = result
+	if err != nil {
+		run.Finish(domain.TaskStatusFailed, 0, err)
+		log.Printf("Task %s failed in run %s: %v", task.ID, run.ID, err)
+		return
+	}
+
+	run.Finish(domain.TaskStatusCompleted, 0, nil)
+	log.Printf("Task %s completed succesfully in run %s", task.ID, run.ID)
+}
+
+// Adds the CPU time of the step to the usage of the run and keeps the highest RSS
+func addUsage(total, step *domain.ResourceUsage) {
+	total.UserCPUMs += step.UserCPUMs
+	total.SystemCPUMs += step.SystemCPUMs
+	total.MaxRSSKB = max(total.MaxRSSKB, step.MaxRSSKB)
+}
+
+// Keeps the last limit bytes written to it
+type tailWriter struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func newTailWriter(limit int) *tailWriter {
+	return &tailWriter{limit: limit}
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.limit {
+		w.buf = append(w.buf[:0], w.buf[len(w.buf)-w.limit:]...)
+	}
+	return len(p), nil
+}
+
+func (w *tailWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return string(w.buf)
+}
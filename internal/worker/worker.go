@@ -2,16 +2,21 @@ package worker
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/siluk00/task_scheduler/internal/domain"
-	"github.com/siluk00/task_scheduler/internal/messaging/rabbitmq"
+	"github.com/siluk00/task_scheduler/internal/events"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/messaging/factory"
+	"github.com/siluk00/task_scheduler/internal/notify"
 	"github.com/siluk00/task_scheduler/internal/repository"
 	redisL "github.com/siluk00/task_scheduler/internal/repository/redis"
+	"github.com/siluk00/task_scheduler/internal/scheduling"
+	"github.com/siluk00/task_scheduler/internal/secrets"
 	"github.com/siluk00/task_scheduler/pkg/config"
 )
 
@@ -21,8 +26,41 @@ type TaskWorker struct {
 	config      *config.AppConfig
 	redisClient *redis.Client
 	taskRepo    repository.TaskHandler //CRUD interface of the server
-	msgQueue    rabbitmq.MesssageQueue
-	running     bool
+	runRepo     repository.RunHandler
+	secretRepo  repository.SecretHandler
+	deadLetters repository.DeadLetterHandler
+	outbox      repository.OutboxHandler
+	processed   repository.ProcessedHandler
+	consumers   repository.ConsumerHandler
+	matrices    repository.MatrixHandler
+	locks       repository.LockHandler
+	rateLimits  repository.RateLimitHandler
+	broker      messaging.Broker
+	events      *events.Publisher
+	// sends the notifications of the events, nil when there is no notification store
+	notifier *notify.Notifier
+	// wakes the outbox relay up when tasks are queued
+	outboxReady chan struct{}
+	// identifies the worker in the consumer registrations
+	id      string
+	running bool
+}
+
+// The stores and the message broker a worker depends on, SecretRepo, ProcessedRepo,
+// ConsumerRepo, NotificationRepo, MatrixRepo, LockRepo and RateLimitRepo may be nil
+type Dependencies struct {
+	TaskRepo         repository.TaskHandler
+	RunRepo          repository.RunHandler
+	SecretRepo       repository.SecretHandler
+	DeadLetterRepo   repository.DeadLetterHandler
+	OutboxRepo       repository.OutboxHandler
+	ProcessedRepo    repository.ProcessedHandler
+	ConsumerRepo     repository.ConsumerHandler
+	NotificationRepo repository.NotificationHandler
+	MatrixRepo       repository.MatrixHandler
+	LockRepo         repository.LockHandler
+	RateLimitRepo    repository.RateLimitHandler
+	Broker           messaging.Broker
 }
 
 // Creates a task Worker without running the worker yet, create the redis client and tests it
@@ -41,28 +79,79 @@ func NewTaskWorker(cfg *config.AppConfig) (*TaskWorker, error) {
 
 	taskRepo := redisL.NewTaskRepository(rdb)
 
-	//gets a connection and a channel in rabbitmq
-	msgQueue, err := rabbitmq.NewRabbitMQ(cfg.RedisMQURL)
+	// the secrets store stays nil if no master key is configured
+	var secretRepo repository.SecretHandler
+	if cfg.SecretsMasterKey != "" {
+		cipher, err := secrets.NewCipher(cfg.SecretsMasterKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create secrets cipher: %v", err)
+		}
+		secretRepo = redisL.NewSecretRepository(rdb, cipher)
+	}
+
+	broker, err := factory.NewBroker(cfg, rdb)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to rabbitmq: %v", err.Error())
+		return nil, err
+	}
+
+	w := NewTaskWorkerWithDependencies(cfg, Dependencies{
+		TaskRepo:         taskRepo,
+		RunRepo:          redisL.NewRunRepository(rdb),
+		SecretRepo:       secretRepo,
+		DeadLetterRepo:   redisL.NewDeadLetterRepository(rdb),
+		OutboxRepo:       redisL.NewOutboxRepository(rdb),
+		ProcessedRepo:    redisL.NewProcessedRepository(rdb),
+		ConsumerRepo:     redisL.NewConsumerRepository(rdb),
+		NotificationRepo: redisL.NewNotificationRepository(rdb),
+		MatrixRepo:       redisL.NewMatrixRepository(rdb),
+		LockRepo:         redisL.NewLockRepository(rdb),
+		RateLimitRepo:    redisL.NewRateLimitRepository(rdb),
+		Broker:           broker,
+	})
+	w.redisClient = rdb
+	return w, nil
+}
+
+// Creates a task Worker using the given stores and broker, e.g. in-memory ones in tests
+func NewTaskWorkerWithDependencies(cfg *config.AppConfig, deps Dependencies) *TaskWorker {
+	host, _ := os.Hostname()
+
+	var notifier *notify.Notifier
+	if deps.NotificationRepo != nil {
+		notifier = notify.NewNotifier(cfg, deps.NotificationRepo)
 	}
 
 	return &TaskWorker{
 		config:      cfg,
-		redisClient: rdb,
-		taskRepo:    taskRepo,
-		msgQueue:    msgQueue,
-	}, nil
+		taskRepo:    deps.TaskRepo,
+		runRepo:     deps.RunRepo,
+		secretRepo:  deps.SecretRepo,
+		deadLetters: deps.DeadLetterRepo,
+		outbox:      deps.OutboxRepo,
+		processed:   deps.ProcessedRepo,
+		consumers:   deps.ConsumerRepo,
+		matrices:    deps.MatrixRepo,
+		locks:       deps.LockRepo,
+		rateLimits:  deps.RateLimitRepo,
+		broker:      deps.Broker,
+		events:      events.NewPublisher(deps.Broker),
+		notifier:    notifier,
+		outboxReady: make(chan struct{}, 1),
+		id:          fmt.Sprintf("%s-%d", host, os.Getpid()),
+	}
 }
 
 func (w *TaskWorker) Start(ctx context.Context) error {
 	w.running = true
-	log.Println("Worker started")
+	log.Printf("Worker started consuming the queues %v", w.queues())
 
-	if err := w.SetupRabbitMQ(); err != nil {
-		return fmt.Errorf("failed to setup rabbitmq: %w", err)
+	if err := w.SetupTopology(ctx); err != nil {
+		return fmt.Errorf("failed to setup message broker: %w", err)
 	}
 
+	go w.registerConsumer(ctx)
+	go w.relayOutbox(ctx)
+
 	go func() {
 		if err := w.StartConsumer(ctx); err != nil {
 			log.Printf("Consumer stopped with error: %v", err)
@@ -70,6 +159,20 @@ func (w *TaskWorker) Start(ctx context.Context) error {
 		}
 	}()
 
+	go func() {
+		if err := w.StartDeadLetterConsumer(ctx); err != nil {
+			log.Printf("Dead letter consumer stopped with error: %v", err)
+		}
+	}()
+
+	if w.notifier != nil {
+		go func() {
+			if err := w.StartNotificationConsumer(ctx); err != nil {
+				log.Printf("Notification consumer stopped with error: %v", err)
+			}
+		}()
+	}
+
 	for w.running {
 		select {
 		case <-ctx.Done():
@@ -85,75 +188,128 @@ func (w *TaskWorker) Start(ctx context.Context) error {
 	return nil
 }
 
-// Creates a direct exchange "tasks" and  a queue "task_queue" and binds them
-// with the routing key "tasks.routing.key"
-func (w *TaskWorker) SetupRabbitMQ() error {
-	// declare two exchanges, tasks and direct
-	err := w.msgQueue.DeclareExchange("tasks", "direct")
-	if err != nil {
+// Declares a direct exchange "tasks" and a queue for every task queue the worker consumes,
+// bound with the routing key of the task queue: "tasks_queue" with "tasks.routing.key" for
+// the default one, "tasks_queue.<name>" with "tasks.routing.key.<name>" for the others.
+// The messages rejected from the queues go to the fanout exchange "tasks.dlx" bound to the queue "tasks_dead".
+// The run events are published in the topic exchange "tasks.events", where the queue
+// "tasks_notifications" receives all of them for the notifications.
+func (w *TaskWorker) SetupTopology(ctx context.Context) error {
+	queues := w.queues()
+	for _, queue := range queues {
+		if queue != messaging.DefaultTaskQueue && !domain.IsValidQueueName(queue) {
+			return fmt.Errorf("%w: %q", domain.ErrInvalidQueue, queue)
+		}
+	}
+
+	topology := messaging.Topology{
+		Exchanges: []messaging.Exchange{
+			{Name: messaging.TasksExchange, Kind: messaging.ExchangeDirect},
+			{Name: messaging.DeadLetterExchange, Kind: messaging.ExchangeFanout},
+		},
+		Queues: []messaging.Queue{
+			{Name: messaging.DeadLetterQueue},
+		},
+		Bindings: []messaging.Binding{
+			{Queue: messaging.DeadLetterQueue, Exchange: messaging.DeadLetterExchange},
+		},
+	}
+
+	for _, queue := range queues {
+		topology.Queues = append(topology.Queues, messaging.Queue{
+			Name:               messaging.TaskQueue(queue),
+			DeadLetterExchange: messaging.DeadLetterExchange,
+		})
+		topology.Bindings = append(topology.Bindings, messaging.Binding{
+			Queue:      messaging.TaskQueue(queue),
+			Exchange:   messaging.TasksExchange,
+			RoutingKey: messaging.TaskRoutingKey(queue),
+		})
+	}
+
+	if err := w.broker.Declare(ctx, topology); err != nil {
+		return err
+	}
+	if err := w.events.Declare(ctx); err != nil {
 		return err
 	}
 
-	_, err = w.msgQueue.DeclareQueue("tasks_queue")
-	if err != nil {
+	if w.notifier == nil {
 		return nil
 	}
+	return w.broker.Declare(ctx, messaging.Topology{
+		Queues: []messaging.Queue{
+			{Name: messaging.NotificationsQueue},
+		},
+		Bindings: []messaging.Binding{
+			{Queue: messaging.NotificationsQueue, Exchange: messaging.EventsExchange, RoutingKey: "#"},
+		},
+	})
+}
 
-	//binds the tasks_queue to the tasks exchange
-	return w.msgQueue.BindQueue("tasks_queue", "tasks", "tasks.routing.key")
+// The task queues the worker consumes, the default one if none is configured
+func (w *TaskWorker) queues() []string {
+	if len(w.config.WorkerQueues) == 0 {
+		return []string{messaging.DefaultTaskQueue}
+	}
+	return w.config.WorkerQueues
 }
 
-// Processes the tasks in the windows frame from now to 5 minutes
-// then publishes the pending task for execution.
-// It waits for 30 seconds before finishing.
+// Queues the tasks that are due, including the ones overdue since a previous pass,
+// for execution through the outbox. It waits for 30 seconds before finishing.
+// In the delayed scheduler mode the tasks are queued ahead instead.
 func (w *TaskWorker) proccessTasks(ctx context.Context) error {
-	now := time.Now()
-	windowEnd := now.Add(5 * time.Minute)
+	if w.config.SchedulerMode == scheduling.ModeDelayed {
+		return w.queueDelayedTasks(ctx)
+	}
 
-	tasks, err := w.taskRepo.FindScheduled(ctx, now, windowEnd)
+	tasks, err := w.taskRepo.FindScheduled(ctx, time.Time{}, time.Now())
 	if err != nil {
 		return fmt.Errorf("error finding scheduled tasks: %v", err)
 	}
 
 	for _, task := range tasks {
-		if task.ScheduledAt.After(now) {
-			continue
-		}
-
-		task.Status = domain.TaskStatusRunning
-		if err := w.taskRepo.Update(ctx, task); err != nil {
-			log.Printf("Failed to update task %s to running: %v", task.ID, err)
+		if !scheduling.IsDispatchable(task) {
 			continue
 		}
 
-		if err := w.publishTask(task); err != nil {
-			log.Printf("Failed to publish task %s: %v", task.ID, err)
-			task.Status = domain.TaskStatusPending
-			_ = w.taskRepo.Update(ctx, task)
+		if err := scheduling.Dispatch(ctx, w.taskRepo, w.outboxReady, task, domain.TaskStatusRunning, time.Time{}); err != nil {
+			log.Printf("Failed to queue task %s for execution: %v", task.ID, err)
 			continue
 		}
 
-		log.Printf("Task %s published for execution", task.ID)
+		log.Printf("Task %s queued for execution", task.ID)
 	}
 
-	time.Sleep(30 * time.Second)
+	select {
+	case <-ctx.Done():
+	case <-time.After(30 * time.Second):
+	}
 	return nil
 }
 
-// Publishes the task in the tasks exchange wuth task.routing.key as the routing key
-func (w *TaskWorker) publishTask(task *domain.Task) error {
-	taskData, err := json.Marshal(task)
-	if err != nil {
-		return fmt.Errorf("failed to maarshal task: %v", err)
+// A task whose message can't reach a queue, e.g. because no worker declared it,
+// is not lost, it goes back to pending for the next pass
+func (w *TaskWorker) revertToPending(ctx context.Context, task *domain.Task, cause error) {
+	log.Printf("Failed to publish task %s, reverting it to pending: %v", task.ID, cause)
+	task.Status = domain.TaskStatusPending
+	if err := w.taskRepo.Update(ctx, task); err != nil {
+		log.Printf("Failed to revert task %s to pending: %v", task.ID, err)
 	}
-
-	return w.msgQueue.Publish("tasks", "task.routing.key", taskData)
 }
 
 // Stops the worker
 func (w *TaskWorker) Stop(ctx context.Context) {
 	w.running = false
-	if err := w.msgQueue.CLose(); err != nil {
+	if w.consumers != nil {
+		if err := w.consumers.UnregisterConsumer(ctx, w.id, w.queues()); err != nil {
+			log.Printf("Error unregistering consumer: %v", err)
+		}
+	}
+	if err := w.broker.Close(); err != nil {
 		log.Printf("Error closing message queue: %v", err)
 	}
+	if w.notifier != nil {
+		w.notifier.Close()
+	}
 }
@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/api/handlers"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/repository/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A server of the run routes reading a run repository on miniredis
+func newRunServer(t *testing.T) (*httptest.Server, *redis.RunRepository) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	runRepo := redis.NewRunRepository(client)
+	runHandler := handlers.NewRunHandler(redis.NewTaskRepository(client), runRepo)
+	router := gin.New()
+	router.GET("/tasks/:id/runs/:run/logs", runHandler.GetRunLogs)
+	router.GET("/tasks/:id/runs/:run/logs/stream", runHandler.StreamRunLogs)
+	// streaming needs a connection the recorder of httptest doesn't have
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, runRepo
+}
+
+// Gets the path with the headers and returns the response with its body
+func get(t *testing.T, server *httptest.Server, path string, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	require.NoError(t, err)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+// Records a finished run of the report task with its output
+func createFinishedRun(t *testing.T, runRepo *redis.RunRepository, output ...string) *domain.TaskRun {
+	ctx := context.Background()
+	run := domain.NewTaskRun(&domain.Task{ID: "report", Name: "Report"})
+	require.NoError(t, runRepo.CreateRun(ctx, run))
+	for _, data := range output {
+		require.NoError(t, runRepo.AppendOutput(ctx, "report", run.ID, domain.OutputStdout, []byte(data)))
+	}
+	run.Finish(domain.TaskStatusCompleted, 0, nil)
+	require.NoError(t, runRepo.UpdateRun(ctx, run))
+	require.NoError(t, runRepo.CloseOutput(ctx, "report", run.ID))
+	return run
+}
+
+func TestStreamRunLogsSendsOutputThenEnd(t *testing.T) {
+	server, runRepo := newRunServer(t)
+	run := createFinishedRun(t, runRepo, "first\n", "second\n")
+
+	resp, body := get(t, server, "/tasks/report/runs/"+run.ID+"/logs/stream", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/event-stream")
+	assert.Equal(t, 2, strings.Count(body, "event:output"))
+	assert.Less(t, strings.Index(body, "first"), strings.Index(body, "second"))
+	assert.Greater(t, strings.Index(body, "event:end"), strings.Index(body, "second"))
+	assert.Contains(t, body, `"status":"completed"`)
+}
+
+func TestStreamRunLogsResumesAfterLastEventID(t *testing.T) {
+	server, runRepo := newRunServer(t)
+	run := createFinishedRun(t, runRepo, "first\n", "second\n")
+
+	chunks, _, err := runRepo.ReadOutput(context.Background(), "report", run.ID, "0", 0)
+	require.NoError(t, err)
+
+	_, body := get(t, server, "/tasks/report/runs/"+run.ID+"/logs/stream", http.Header{"Last-Event-ID": {chunks[0].ID}})
+	assert.NotContains(t, body, "first")
+	assert.Contains(t, body, "second")
+	assert.Contains(t, body, "event:end")
+}
+
+func TestRunLogsOfUnknownRunIsNotFound(t *testing.T) {
+	server, _ := newRunServer(t)
+
+	for _, path := range []string{"/tasks/report/runs/nope/logs", "/tasks/report/runs/nope/logs/stream"} {
+		resp, _ := get(t, server, path, nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
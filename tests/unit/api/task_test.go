@@ -0,0 +1,157 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/api/handlers"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/repository/redis"
+	"github.com/siluk00/task_scheduler/internal/scheduling"
+	"github.com/siluk00/task_scheduler/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A server of the task routes on miniredis, with the delayed scheduler and a five minute horizon
+func newTaskServer(t *testing.T) (*httptest.Server, *redis.TaskRepository, *redis.OutboxRepository) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg := &config.AppConfig{SchedulerMode: scheduling.ModeDelayed, SchedulerHorizonSeconds: 300}
+	taskRepo := redis.NewTaskRepository(client)
+	taskHandler := handlers.NewTaskHandler(cfg, taskRepo, nil, nil)
+	router := gin.New()
+	router.POST("/tasks", taskHandler.CreateTask)
+	router.PUT("/tasks/:id", taskHandler.UpdateTask)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, taskRepo, redis.NewOutboxRepository(client)
+}
+
+// Sends the task as JSON and returns the status code
+func send(t *testing.T, server *httptest.Server, method, path string, task domain.Task) int {
+	body, err := json.Marshal(task)
+	require.NoError(t, err)
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// Returns the task messages waiting in the outbox
+func outboxTaskMessages(t *testing.T, outbox *redis.OutboxRepository) []*domain.TaskMessage {
+	msgs, err := outbox.ClaimOutbox(context.Background(), 10, time.Minute)
+	require.NoError(t, err)
+
+	var taskMsgs []*domain.TaskMessage
+	for _, msg := range msgs {
+		taskMsg, err := domain.ParseTaskMessage(msg.Body)
+		require.NoError(t, err)
+		assert.WithinDuration(t, taskMsg.DueAt, msg.DeliverAt, 0)
+		taskMsgs = append(taskMsgs, taskMsg)
+	}
+	return taskMsgs
+}
+
+func TestCreateTaskQueuesTaskDueWithinHorizon(t *testing.T) {
+	server, taskRepo, outbox := newTaskServer(t)
+	scheduledAt := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	status := send(t, server, http.MethodPost, "/tasks", domain.Task{ID: "soon", Name: "Soon", Command: "true",
+		Status: domain.TaskStatusPending, ScheduledAt: scheduledAt})
+	require.Equal(t, http.StatusCreated, status)
+
+	stored, err := taskRepo.FindById(context.Background(), "soon")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusQueued, stored.Status)
+
+	taskMsgs := outboxTaskMessages(t, outbox)
+	require.Len(t, taskMsgs, 1)
+	assert.Equal(t, "soon", taskMsgs[0].TaskID)
+	assert.True(t, taskMsgs[0].DueAt.Equal(scheduledAt))
+}
+
+func TestCreateTaskLeavesTaskBeyondHorizonToScheduler(t *testing.T) {
+	server, taskRepo, outbox := newTaskServer(t)
+
+	status := send(t, server, http.MethodPost, "/tasks", domain.Task{ID: "later", Name: "Later", Command: "true", Status: domain.TaskStatusPending,
+		ScheduledAt: time.Now().Add(time.Hour)})
+	require.Equal(t, http.StatusCreated, status)
+
+	stored, err := taskRepo.FindById(context.Background(), "later")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusPending, stored.Status)
+	assert.Empty(t, outboxTaskMessages(t, outbox))
+}
+
+func TestUpdateTaskQueuesRescheduledTaskAgain(t *testing.T) {
+	server, taskRepo, outbox := newTaskServer(t)
+	first := time.Now().Add(time.Minute).Truncate(time.Second)
+	task := domain.Task{ID: "moved", Name: "Moved", Command: "true", Status: domain.TaskStatusPending, ScheduledAt: first}
+	require.Equal(t, http.StatusCreated, send(t, server, http.MethodPost, "/tasks", task))
+	require.Len(t, outboxTaskMessages(t, outbox), 1)
+
+	// the queued task is moved two minutes later, its first message is now stale
+	stored, err := taskRepo.FindById(context.Background(), "moved")
+	require.NoError(t, err)
+	second := first.Add(2 * time.Minute)
+	stored.ScheduledAt = second
+	require.Equal(t, http.StatusOK, send(t, server, http.MethodPut, "/tasks/moved", *stored))
+
+	stored, err = taskRepo.FindById(context.Background(), "moved")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusQueued, stored.Status)
+	assert.False(t, stored.RescheduledAt.IsZero())
+
+	taskMsgs := outboxTaskMessages(t, outbox)
+	require.Len(t, taskMsgs, 1)
+	assert.True(t, taskMsgs[0].DueAt.Equal(second))
+}
+
+func TestCreateTaskRejectsFollowUpCycle(t *testing.T) {
+	server, taskRepo, _ := newTaskServer(t)
+	first := domain.Task{ID: "first", Name: "First", Command: "true", Status: domain.TaskStatusPending, OnSuccess: []string{"second"}}
+	require.Equal(t, http.StatusCreated, send(t, server, http.MethodPost, "/tasks", first))
+
+	second := domain.Task{ID: "second", Name: "Second", Command: "true", Status: domain.TaskStatusPending, OnFailure: []string{"first"}}
+	assert.Equal(t, http.StatusBadRequest, send(t, server, http.MethodPost, "/tasks", second))
+
+	stored, err := taskRepo.FindById(context.Background(), "second")
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
+
+func TestUpdateTaskRejectsFollowUpCycle(t *testing.T) {
+	server, taskRepo, _ := newTaskServer(t)
+	first := domain.Task{ID: "first", Name: "First", Command: "true", Status: domain.TaskStatusPending}
+	require.Equal(t, http.StatusCreated, send(t, server, http.MethodPost, "/tasks", first))
+	second := domain.Task{ID: "second", Name: "Second", Command: "true", Status: domain.TaskStatusPending, OnSuccess: []string{"first"}}
+	require.Equal(t, http.StatusCreated, send(t, server, http.MethodPost, "/tasks", second))
+
+	first.OnSuccess = []string{"second"}
+	assert.Equal(t, http.StatusBadRequest, send(t, server, http.MethodPut, "/tasks/first", first))
+
+	stored, err := taskRepo.FindById(context.Background(), "first")
+	require.NoError(t, err)
+	assert.Empty(t, stored.OnSuccess)
+
+	// a chain without a way back is fine
+	second.OnSuccess = nil
+	require.Equal(t, http.StatusOK, send(t, server, http.MethodPut, "/tasks/second", second))
+	assert.Equal(t, http.StatusOK, send(t, server, http.MethodPut, "/tasks/first", first))
+}
@@ -0,0 +1,60 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTaskMessage(t *testing.T) {
+	original := domain.NewTaskMessage("backup")
+	body, err := json.Marshal(original)
+	require.NoError(t, err)
+
+	parsed, err := domain.ParseTaskMessage(body)
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskMessageVersion, parsed.Version)
+	assert.Equal(t, "backup", parsed.TaskID)
+	assert.Equal(t, original.RunID, parsed.RunID)
+	assert.Equal(t, original.CorrelationID, parsed.CorrelationID)
+	assert.Equal(t, 1, parsed.Attempt)
+}
+
+func TestParseLegacyTaskMessage(t *testing.T) {
+	body, err := json.Marshal(domain.Task{ID: "backup", Name: "Backup", Command: "true"})
+	require.NoError(t, err)
+
+	parsed, err := domain.ParseTaskMessage(body)
+	require.NoError(t, err)
+	assert.Equal(t, 0, parsed.Version)
+	assert.Equal(t, "backup", parsed.TaskID)
+	assert.Equal(t, 1, parsed.Attempt)
+}
+
+func TestParseInvalidTaskMessage(t *testing.T) {
+	tests := map[string]string{
+		"not json":        "not json",
+		"missing task ID": `{"version": 1}`,
+		"future version":  `{"version": 99, "task_id": "backup"}`,
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := domain.ParseTaskMessage([]byte(body))
+			assert.ErrorIs(t, err, domain.ErrInvalidTaskMessage)
+		})
+	}
+}
+
+func TestTaskMessageRedeliver(t *testing.T) {
+	original := domain.NewTaskMessage("backup")
+
+	next := original.Redeliver(2)
+	assert.Equal(t, 2, next.Attempt)
+	assert.Equal(t, original.CorrelationID, next.CorrelationID)
+	assert.NotEqual(t, original.RunID, next.RunID)
+	assert.Equal(t, 1, original.Attempt)
+}
@@ -0,0 +1,40 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitValidates(t *testing.T) {
+	valid := []domain.RateLimit{
+		{Name: "reports-api", Label: "team=reports", MaxConcurrent: 3},
+		{Name: "default", Queue: "default", StartsPerMinute: 20},
+		{Name: "both", Queue: "gpu", MaxConcurrent: 1, StartsPerMinute: 5},
+	}
+	for _, limit := range valid {
+		assert.NoError(t, limit.Validate(), limit.Name)
+	}
+
+	invalid := []domain.RateLimit{
+		{Name: "no-tasks", MaxConcurrent: 3},
+		{Name: "both-selectors", Queue: "default", Label: "team=reports", MaxConcurrent: 3},
+		{Name: "no-caps", Queue: "default"},
+		{Name: "negative", Queue: "default", MaxConcurrent: -1, StartsPerMinute: 5},
+		{Name: "bad-label", Label: "team", MaxConcurrent: 3},
+		{Name: "bad name", Queue: "default", MaxConcurrent: 3},
+	}
+	for _, limit := range invalid {
+		assert.ErrorIs(t, limit.Validate(), domain.ErrInvalidRateLimit, limit.Name)
+	}
+}
+
+func TestRateLimitMatchesQueueOrLabel(t *testing.T) {
+	task := &domain.Task{ID: "daily", Labels: map[string]string{"team": "reports"}}
+
+	assert.True(t, (&domain.RateLimit{Label: "team=reports"}).Matches(task, "default"))
+	assert.False(t, (&domain.RateLimit{Label: "team=billing"}).Matches(task, "default"))
+	assert.True(t, (&domain.RateLimit{Queue: "default"}).Matches(task, "default"))
+	assert.False(t, (&domain.RateLimit{Queue: "gpu"}).Matches(task, "default"))
+}
@@ -0,0 +1,134 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadZone(t *testing.T, name string) *time.Location {
+	loc, err := domain.LoadTimezone(name)
+	require.NoError(t, err)
+	return loc
+}
+
+// The next occurrences of the expression after the time
+func nextRuns(t *testing.T, expr string, after time.Time, loc *time.Location, n int) []time.Time {
+	schedule, err := domain.ParseSchedule(expr)
+	require.NoError(t, err)
+
+	var runs []time.Time
+	for range n {
+		after = schedule.Next(after, loc)
+		require.False(t, after.IsZero(), expr)
+		runs = append(runs, after)
+	}
+	return runs
+}
+
+func TestParseScheduleAcceptsValidExpressions(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "*/15 8-18 * * 1-5", "0 2 1,15 * *", "30 4 * 1-12/3 7", "5/10 * * * *",
+		"@hourly", "@daily", "@weekly", "@monthly", "@yearly", "0 0 29 2 *"} {
+		_, err := domain.ParseSchedule(expr)
+		assert.NoError(t, err, expr)
+	}
+}
+
+func TestParseScheduleRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@often", "0 0 30 2 *"} {
+		_, err := domain.ParseSchedule(expr)
+		assert.ErrorIs(t, err, domain.ErrInvalidSchedule, expr)
+	}
+}
+
+func TestScheduleNextRunsInTheTimezone(t *testing.T) {
+	loc := loadZone(t, "America/Sao_Paulo")
+	after := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	runs := nextRuns(t, "0 2 * * *", after, loc, 2)
+	assert.Equal(t, time.Date(2026, 10, 20, 5, 0, 0, 0, time.UTC), runs[0].UTC())
+	assert.Equal(t, time.Date(2026, 10, 21, 5, 0, 0, 0, time.UTC), runs[1].UTC())
+
+	// on Mondays and on the 1st, either matches
+	runs = nextRuns(t, "0 9 1 * 1", after, time.UTC, 3)
+	assert.Equal(t, time.Date(2026, 10, 26, 9, 0, 0, 0, time.UTC), runs[0])
+	assert.Equal(t, time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC), runs[1])
+	assert.Equal(t, time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC), runs[2])
+
+	runs = nextRuns(t, "0 0 29 2 *", after, time.UTC, 1)
+	assert.Equal(t, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC), runs[0])
+}
+
+func TestScheduleShiftsTimesSkippedByTheClock(t *testing.T) {
+	loc := loadZone(t, "America/New_York")
+	// the clocks go from 02:00 to 03:00 on 2026-03-08
+	after := time.Date(2026, 3, 7, 12, 0, 0, 0, loc)
+
+	runs := nextRuns(t, "30 2 * * *", after, loc, 2)
+	assert.Equal(t, time.Date(2026, 3, 8, 3, 30, 0, 0, loc), runs[0])
+	assert.Equal(t, time.Date(2026, 3, 9, 2, 30, 0, 0, loc), runs[1])
+
+	runs = nextRuns(t, "*/30 * * * *", time.Date(2026, 3, 8, 1, 15, 0, 0, loc), loc, 4)
+	assert.Equal(t, []time.Time{
+		time.Date(2026, 3, 8, 1, 30, 0, 0, loc),
+		time.Date(2026, 3, 8, 3, 0, 0, 0, loc),
+		time.Date(2026, 3, 8, 3, 30, 0, 0, loc),
+		time.Date(2026, 3, 8, 4, 0, 0, 0, loc),
+	}, runs)
+
+	// midnight doesn't exist in Sao Paulo on 2018-11-04
+	sp := loadZone(t, "America/Sao_Paulo")
+	runs = nextRuns(t, "0 0 * * *", time.Date(2018, 11, 3, 12, 0, 0, 0, sp), sp, 2)
+	assert.Equal(t, time.Date(2018, 11, 4, 3, 0, 0, 0, time.UTC), runs[0].UTC())
+	assert.Equal(t, "01:00 -02", runs[0].Format("15:04 -07"))
+	assert.Equal(t, time.Date(2018, 11, 5, 0, 0, 0, 0, sp), runs[1])
+}
+
+func TestScheduleRunsRepeatedFixedTimesOnce(t *testing.T) {
+	loc := loadZone(t, "America/New_York")
+	// the clocks go back from 02:00 to 01:00 on 2026-11-01
+	runs := nextRuns(t, "30 1 * * *", time.Date(2026, 10, 31, 12, 0, 0, 0, loc), loc, 2)
+	assert.Equal(t, time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), runs[0].UTC())
+	assert.Equal(t, time.Date(2026, 11, 2, 1, 30, 0, 0, loc), runs[1])
+
+	// past the first 01:30 the second one doesn't run
+	runs = nextRuns(t, "30 1 * * *", time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), loc, 1)
+	assert.Equal(t, time.Date(2026, 11, 2, 1, 30, 0, 0, loc), runs[0])
+}
+
+func TestScheduleRunsRepeatedHourOfRecurringTimes(t *testing.T) {
+	loc := loadZone(t, "America/New_York")
+	// the clocks go back from 02:00 EDT to 01:00 EST on 2026-11-01, 06:00 UTC
+	runs := nextRuns(t, "0 * * * *", time.Date(2026, 11, 1, 0, 30, 0, 0, loc), loc, 3)
+	assert.Equal(t, []time.Time{
+		time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC),
+		time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC),
+		time.Date(2026, 11, 1, 7, 0, 0, 0, time.UTC),
+	}, []time.Time{runs[0].UTC(), runs[1].UTC(), runs[2].UTC()})
+
+	runs = nextRuns(t, "*/15 * * * *", time.Date(2026, 11, 1, 0, 50, 0, 0, loc), loc, 9)
+	var got []string
+	for _, run := range runs {
+		got = append(got, run.Format("15:04 MST"))
+	}
+	assert.Equal(t, []string{"01:00 EDT", "01:15 EDT", "01:30 EDT", "01:45 EDT",
+		"01:00 EST", "01:15 EST", "01:30 EST", "01:45 EST", "02:00 EST"}, got)
+
+	// from within the second 01:xx
+	runs = nextRuns(t, "*/15 * * * *", time.Date(2026, 11, 1, 6, 20, 0, 0, time.UTC), loc, 2)
+	assert.Equal(t, time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC), runs[0].UTC())
+	assert.Equal(t, time.Date(2026, 11, 1, 6, 45, 0, 0, time.UTC), runs[1].UTC())
+}
+
+func TestScheduleFollowsTheOffsetOfTheTimezone(t *testing.T) {
+	loc := loadZone(t, "America/Sao_Paulo")
+	// Sao Paulo went from -03 to -02 on 2018-11-04
+	runs := nextRuns(t, "0 2 * * *", time.Date(2018, 11, 2, 12, 0, 0, 0, loc), loc, 3)
+	assert.Equal(t, time.Date(2018, 11, 3, 5, 0, 0, 0, time.UTC), runs[0].UTC())
+	assert.Equal(t, time.Date(2018, 11, 4, 4, 0, 0, 0, time.UTC), runs[1].UTC())
+	assert.Equal(t, time.Date(2018, 11, 5, 4, 0, 0, 0, time.UTC), runs[2].UTC())
+}
@@ -0,0 +1,52 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuccessCriteriaEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		criteria *domain.SuccessCriteria
+		exitCode int
+		stdout   string
+		stderr   string
+		wantErr  error
+	}{
+		{"Default accepts zero", nil, 0, "", "", nil},
+		{"Default rejects one", nil, 1, "", "", domain.ErrUnacceptedExitCode},
+		{"Accepted nothing to do", &domain.SuccessCriteria{AcceptedExitCodes: []int{0, 1}}, 1, "", "", nil},
+		{"Accepted codes replace zero", &domain.SuccessCriteria{AcceptedExitCodes: []int{2}}, 0, "", "", domain.ErrUnacceptedExitCode},
+		{"Required found in stderr", &domain.SuccessCriteria{RequiredOutput: []string{`^done$`}}, 0, "", "done", nil},
+		{"Required missing", &domain.SuccessCriteria{RequiredOutput: []string{`rows: \d+`}}, 0, "nothing", "", domain.ErrRequiredOutputMissing},
+		{"Forbidden found", &domain.SuccessCriteria{ForbiddenOutput: []string{`ERROR`}}, 0, "ERROR: disk full", "", domain.ErrForbiddenOutput},
+		{"Invalid JSON result", &domain.SuccessCriteria{JSONResult: true}, 0, "working\nnot json\n", "", domain.ErrInvalidJSONResult},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.criteria.Evaluate(tt.exitCode, tt.stdout, tt.stderr)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSuccessCriteriaJSONResult(t *testing.T) {
+	criteria := &domain.SuccessCriteria{JSONResult: true}
+
+	result, err := criteria.Evaluate(0, "processing\n{\"rows\": 42}\n\n", "")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"rows": 42}`, string(result))
+}
+
+func TestSuccessCriteriaValidate(t *testing.T) {
+	criteria := &domain.SuccessCriteria{ForbiddenOutput: []string{`(unclosed`}}
+	assert.ErrorIs(t, criteria.Validate(), domain.ErrInvalidSuccessCriteria)
+}
@@ -0,0 +1,103 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskValidatesFollowUps(t *testing.T) {
+	task := domain.Task{ID: "self", Name: "Self", Command: "true", Status: domain.TaskStatusPending}
+
+	task.OnSuccess = []string{"next"}
+	assert.NoError(t, task.Validate())
+
+	task.OnFailure = []string{"self"}
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidFollowUp)
+
+	task.OnFailure = []string{"not valid"}
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidFollowUp)
+}
+
+func TestTaskValidatesSteps(t *testing.T) {
+	task := domain.Task{ID: "steps", Name: "Steps", Status: domain.TaskStatusPending,
+		Steps: []domain.Step{{Command: "true"}, {Name: "second", Command: "true", TimeoutSeconds: 5}}}
+	assert.NoError(t, task.Validate())
+	assert.Equal(t, "step-1", task.Steps[0].DisplayName(0))
+	assert.Equal(t, "second", task.Steps[1].DisplayName(1))
+
+	task.Command = "true"
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidSteps)
+
+	task.Command = ""
+	task.Steps[1].Command = ""
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidSteps)
+
+	task.Steps = nil
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidCommand)
+}
+
+func TestTaskValidatesMatrix(t *testing.T) {
+	task := domain.Task{ID: "report", Name: "Report", Command: "./report.sh", Status: domain.TaskStatusPending,
+		Matrix: &domain.Matrix{MaxParallel: 5, Params: []map[string]string{{"CUSTOMER": "acme"}, {"CUSTOMER": "globex"}}}}
+	assert.NoError(t, task.Validate())
+	assert.Equal(t, 2, task.Matrix.Parallelism())
+	assert.Equal(t, "report-2", domain.MatrixChildID(task.ID, 1))
+
+	task.Matrix.Params[1] = map[string]string{"NOT-A-NAME": "x"}
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidMatrix)
+
+	task.Matrix.Params = nil
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidMatrix)
+
+	task.Matrix = &domain.Matrix{Params: []map[string]string{{"A": "1"}}, FailureThreshold: -1}
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidMatrix)
+}
+
+func TestTaskValidatesParams(t *testing.T) {
+	task := domain.Task{ID: "report-1", Name: "Report", Command: "./report.sh", Status: domain.TaskStatusPending,
+		Params: map[string]string{"CUSTOMER": "acme"}}
+	assert.NoError(t, task.Validate())
+
+	// a task without a matrix has no matrix to blame
+	task.Params = map[string]string{"NOT-A-NAME": "x"}
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidParam)
+	assert.NotErrorIs(t, task.Validate(), domain.ErrInvalidMatrix)
+}
+
+func TestTaskValidatesLocks(t *testing.T) {
+	task := domain.Task{ID: "migrate", Name: "Migrate", Command: "./migrate.sh", Status: domain.TaskStatusPending,
+		Locks: []string{"db-main", "cache_1"}}
+	assert.NoError(t, task.Validate())
+
+	task.Locks = []string{"db main"}
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidLock)
+}
+
+func TestTaskValidatesConcurrencyPolicy(t *testing.T) {
+	task := domain.Task{ID: "sync", Name: "Sync", Command: "./sync.sh", Status: domain.TaskStatusPending}
+	for _, policy := range []domain.ConcurrencyPolicy{"", domain.ConcurrencyAllow, domain.ConcurrencyForbid,
+		domain.ConcurrencyReplace, domain.ConcurrencyQueue} {
+		task.ConcurrencyPolicy = policy
+		assert.NoError(t, task.Validate())
+	}
+
+	task.ConcurrencyPolicy = "skip"
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidConcurrency)
+}
+
+func TestTaskValidatesScheduleAndTimezone(t *testing.T) {
+	task := domain.Task{ID: "backup", Name: "Backup", Command: "./backup.sh", Status: domain.TaskStatusPending,
+		Schedule: "0 2 * * *", Timezone: "America/Sao_Paulo"}
+	assert.NoError(t, task.Validate())
+
+	task.Schedule = "0 2 * *"
+	assert.ErrorIs(t, task.Validate(), domain.ErrInvalidSchedule)
+
+	task.Schedule = "@daily"
+	for _, timezone := range []string{"Mars/Olympus_Mons", "Local"} {
+		task.Timezone = timezone
+		assert.ErrorIs(t, task.Validate(), domain.ErrInvalidTimezone, timezone)
+	}
+}
@@ -0,0 +1,34 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeUsage(t *testing.T) {
+	runs := []*domain.TaskRun{
+		{TaskID: "report", Status: domain.TaskStatusCompleted, Labels: map[string]string{"team": "reports"},
+			Usage: &domain.ResourceUsage{WallTimeMs: 100, UserCPUMs: 80, SystemCPUMs: 10, MaxRSSKB: 2048}},
+		{TaskID: "report", Status: domain.TaskStatusFailed, Labels: map[string]string{"team": "reports"},
+			Usage: &domain.ResourceUsage{WallTimeMs: 50, UserCPUMs: 20, SystemCPUMs: 5, MaxRSSKB: 4096}},
+		{TaskID: "backup", Status: domain.TaskStatusCompleted, Labels: map[string]string{"team": "ops", "env": "prod"},
+			Usage: &domain.ResourceUsage{WallTimeMs: 900, UserCPUMs: 500, SystemCPUMs: 200, MaxRSSKB: 1024}},
+		{TaskID: "backup", Status: domain.TaskStatusRunning},
+	}
+
+	byTask := domain.SummarizeUsage(runs, domain.UsageByTask, "")
+	assert.Equal(t, []domain.UsageSummary{
+		{Key: "backup", Runs: 2, WallTimeMs: 900, UserCPUMs: 500, SystemCPUMs: 200, MaxRSSKB: 1024},
+		{Key: "report", Runs: 2, Failed: 1, WallTimeMs: 150, UserCPUMs: 100, SystemCPUMs: 15, MaxRSSKB: 4096},
+	}, byTask)
+
+	byTeam := domain.SummarizeUsage(runs, domain.UsageByLabel, "team")
+	assert.Len(t, byTeam, 2)
+	assert.Equal(t, "team=ops", byTeam[0].Key)
+	assert.Equal(t, "team=reports", byTeam[1].Key)
+
+	byLabel := domain.SummarizeUsage(runs, domain.UsageByLabel, "")
+	assert.Len(t, byLabel, 3)
+}
@@ -0,0 +1,210 @@
+package messaging_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/messaging/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		kind    string
+		pattern string
+		key     string
+		want    bool
+	}{
+		{messaging.ExchangeDirect, "tasks.routing.key", "tasks.routing.key", true},
+		{messaging.ExchangeDirect, "tasks.routing.key", "task.routing.key", false},
+		{messaging.ExchangeFanout, "", "anything", true},
+		{messaging.ExchangeTopic, "run.*", "run.failed", true},
+		{messaging.ExchangeTopic, "run.*", "run.failed.again", false},
+		{messaging.ExchangeTopic, "#", "task.created", true},
+		{messaging.ExchangeTopic, "task.#.done", "task.done", true},
+		{messaging.ExchangeTopic, "task.#.done", "task.a.b.done", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind+" "+tt.pattern+" "+tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, messaging.Matches(tt.kind, tt.pattern, tt.key))
+		})
+	}
+}
+
+func newTestBroker(t *testing.T) *memory.Broker {
+	broker := memory.NewBroker()
+	t.Cleanup(func() { broker.Close() })
+
+	err := broker.Declare(context.Background(), messaging.Topology{
+		Exchanges: []messaging.Exchange{{Name: "tasks", Kind: messaging.ExchangeDirect}},
+		Queues:    []messaging.Queue{{Name: "tasks_queue"}},
+		Bindings:  []messaging.Binding{{Queue: "tasks_queue", Exchange: "tasks", RoutingKey: "tasks.routing.key"}},
+	})
+	require.NoError(t, err)
+	return broker
+}
+
+func receive(t *testing.T, msgs <-chan messaging.Message) messaging.Message {
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func TestMemoryBrokerAckNack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := newTestBroker(t)
+	msgs, err := broker.Consume(ctx, "tasks_queue")
+	require.NoError(t, err)
+
+	require.NoError(t, broker.Publish(ctx, messaging.Publishing{
+		Exchange:   "tasks",
+		RoutingKey: "tasks.routing.key",
+		Body:       []byte("hello"),
+		Headers:    map[string]string{"id": "1"},
+	}))
+
+	msg := receive(t, msgs)
+	assert.Equal(t, "hello", string(msg.Body()))
+	assert.Equal(t, "1", msg.Headers()["id"])
+	assert.False(t, msg.Redelivered())
+
+	// a requeued message comes back flagged as redelivered
+	require.NoError(t, msg.Nack(true))
+	msg = receive(t, msgs)
+	assert.True(t, msg.Redelivered())
+
+	require.NoError(t, msg.Ack())
+	assert.Error(t, msg.Ack())
+
+	ready, unacked := broker.Stats("tasks_queue")
+	assert.Equal(t, 0, ready)
+	assert.Equal(t, 0, unacked)
+}
+
+func TestMemoryBrokerUnroutedMessageIsDropped(t *testing.T) {
+	broker := newTestBroker(t)
+
+	require.NoError(t, broker.Publish(context.Background(), messaging.Publishing{
+		Exchange:   "tasks",
+		RoutingKey: "unknown.key",
+		Body:       []byte("lost"),
+	}))
+
+	ready, _ := broker.Stats("tasks_queue")
+	assert.Equal(t, 0, ready)
+}
+
+func TestMemoryBrokerDeadLettersRejectedMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := memory.NewBroker()
+	t.Cleanup(func() { broker.Close() })
+	require.NoError(t, broker.Declare(ctx, messaging.Topology{
+		Exchanges: []messaging.Exchange{
+			{Name: "tasks", Kind: messaging.ExchangeDirect},
+			{Name: "tasks.dlx", Kind: messaging.ExchangeFanout},
+		},
+		Queues: []messaging.Queue{
+			{Name: "tasks_queue", DeadLetterExchange: "tasks.dlx"},
+			{Name: "tasks_dead"},
+		},
+		Bindings: []messaging.Binding{
+			{Queue: "tasks_queue", Exchange: "tasks", RoutingKey: "tasks.routing.key"},
+			{Queue: "tasks_dead", Exchange: "tasks.dlx"},
+		},
+	}))
+
+	msgs, err := broker.Consume(ctx, "tasks_queue")
+	require.NoError(t, err)
+	dead, err := broker.Consume(ctx, "tasks_dead")
+	require.NoError(t, err)
+
+	require.NoError(t, broker.Publish(ctx, messaging.Publishing{
+		Exchange:   "tasks",
+		RoutingKey: "tasks.routing.key",
+		Body:       []byte("poison"),
+		Headers:    map[string]string{"id": "1"},
+	}))
+
+	require.NoError(t, receive(t, msgs).Nack(false))
+
+	msg := receive(t, dead)
+	assert.Equal(t, "poison", string(msg.Body()))
+	assert.Equal(t, "1", msg.Headers()["id"])
+	assert.Equal(t, "tasks_queue", msg.Headers()[messaging.HeaderFirstDeathQueue])
+	assert.Equal(t, "rejected", msg.Headers()[messaging.HeaderFirstDeathReason])
+	require.NoError(t, msg.Ack())
+}
+
+func TestMemoryBrokerMandatoryUnroutableMessageFails(t *testing.T) {
+	broker := newTestBroker(t)
+
+	// the routing key the worker used to publish with, which no queue is bound to
+	err := broker.Publish(context.Background(), messaging.Publishing{
+		Exchange:   "tasks",
+		RoutingKey: "task.routing.key",
+		Body:       []byte("lost"),
+		Mandatory:  true,
+	})
+	assert.ErrorIs(t, err, messaging.ErrUnroutable)
+
+	require.NoError(t, broker.Publish(context.Background(), messaging.Publishing{
+		Exchange:   "tasks",
+		RoutingKey: "tasks.routing.key",
+		Body:       []byte("routed"),
+		Mandatory:  true,
+	}))
+
+	ready, _ := broker.Stats("tasks_queue")
+	assert.Equal(t, 1, ready)
+}
+
+func TestMemoryBrokerState(t *testing.T) {
+	broker := memory.NewBroker()
+	assert.Equal(t, messaging.StateConnected, broker.State())
+
+	require.NoError(t, broker.Close())
+	assert.Equal(t, messaging.StateClosed, broker.State())
+	assert.ErrorIs(t, broker.Publish(context.Background(), messaging.Publishing{Exchange: "tasks"}), messaging.ErrClosed)
+}
+
+func TestMemoryBrokerDelayedMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := newTestBroker(t)
+	msgs, err := broker.Consume(ctx, "tasks_queue")
+	require.NoError(t, err)
+
+	published := time.Now()
+	require.NoError(t, broker.Publish(ctx, messaging.Publishing{
+		Exchange:   "tasks",
+		RoutingKey: "tasks.routing.key",
+		Body:       []byte("later"),
+		Delay:      500 * time.Millisecond,
+	}))
+
+	ready, _ := broker.Stats("tasks_queue")
+	assert.Equal(t, 0, ready)
+
+	select {
+	case msg := <-msgs:
+		assert.Equal(t, "later", string(msg.Body()))
+		// delays are rounded up to whole seconds
+		assert.GreaterOrEqual(t, time.Since(published), time.Second)
+		require.NoError(t, msg.Ack())
+	case <-time.After(3 * time.Second):
+		t.Fatal("delayed message not delivered")
+	}
+}
@@ -0,0 +1,36 @@
+package messaging_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/messaging/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// An address nothing listens on
+func unreachableAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	return addr
+}
+
+func TestConnectRabbitMQReportsReconnectingWhileUnreachable(t *testing.T) {
+	broker := rabbitmq.ConnectRabbitMQ("amqp://guest:guest@" + unreachableAddress(t) + "/")
+
+	assert.Equal(t, messaging.StateReconnecting, broker.State())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := broker.Publish(ctx, messaging.Publishing{Exchange: "tasks", RoutingKey: "tasks.routing.key"})
+	assert.Error(t, err)
+
+	require.NoError(t, broker.Close())
+	assert.Equal(t, messaging.StateClosed, broker.State())
+}
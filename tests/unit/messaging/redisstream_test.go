@@ -0,0 +1,278 @@
+package messaging_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/messaging/redisstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The dead letter topology of the worker: rejected messages of tasks_queue end up in tasks_dead
+var redisTestTopology = messaging.Topology{
+	Exchanges: []messaging.Exchange{
+		{Name: "tasks", Kind: messaging.ExchangeDirect},
+		{Name: "events", Kind: messaging.ExchangeTopic},
+		{Name: "tasks.dlx", Kind: messaging.ExchangeFanout},
+	},
+	Queues: []messaging.Queue{
+		{Name: "tasks_queue", DeadLetterExchange: "tasks.dlx"},
+		{Name: "reports_queue"},
+		{Name: "run_events"},
+		{Name: "tasks_dead"},
+	},
+	Bindings: []messaging.Binding{
+		{Queue: "tasks_queue", Exchange: "tasks", RoutingKey: "tasks.routing.key"},
+		{Queue: "reports_queue", Exchange: "tasks", RoutingKey: "tasks.reports"},
+		{Queue: "run_events", Exchange: "events", RoutingKey: "run.*"},
+		{Queue: "tasks_dead", Exchange: "tasks.dlx"},
+	},
+}
+
+// Each broker is a consumer of its own, like a worker process
+func newRedisTestBroker(t *testing.T, client *redis.Client, claimIdle time.Duration) *redisstream.Broker {
+	broker := redisstream.NewBroker(client, claimIdle)
+	t.Cleanup(func() { broker.Close() })
+	require.NoError(t, broker.Declare(context.Background(), redisTestTopology))
+	return broker
+}
+
+func newRedisTestClient(t *testing.T) *redis.Client {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func consume(t *testing.T, ctx context.Context, broker *redisstream.Broker, queue string) <-chan messaging.Message {
+	msgs, err := broker.Consume(ctx, queue)
+	require.NoError(t, err)
+	return msgs
+}
+
+// The entries of the stream of the queue and how many of them are delivered but not settled
+func streamStats(t *testing.T, client *redis.Client, queue string) (int64, int64) {
+	length, err := client.XLen(context.Background(), "mq:queue:"+queue).Result()
+	require.NoError(t, err)
+	pending, err := client.XPending(context.Background(), "mq:queue:"+queue, "workers").Result()
+	require.NoError(t, err)
+	return length, pending.Count
+}
+
+func assertNoMessage(t *testing.T, msgs <-chan messaging.Message, wait time.Duration) {
+	select {
+	case msg := <-msgs:
+		t.Fatalf("unexpected message %q", msg.Body())
+	case <-time.After(wait):
+	}
+}
+
+func TestRedisStreamBrokerRoutesByQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newRedisTestClient(t)
+	broker := newRedisTestBroker(t, client, 0)
+	tasks := consume(t, ctx, broker, "tasks_queue")
+	reports := consume(t, ctx, broker, "reports_queue")
+	events := consume(t, ctx, broker, "run_events")
+
+	for _, publishing := range []messaging.Publishing{
+		{Exchange: "tasks", RoutingKey: "tasks.reports", Body: []byte("report")},
+		{Exchange: "tasks", RoutingKey: "tasks.routing.key", Body: []byte("task"), Headers: map[string]string{"id": "1"}},
+		{Exchange: "events", RoutingKey: "run.failed", Body: []byte("event")},
+		{Exchange: "events", RoutingKey: "task.created", Body: []byte("unbound")},
+	} {
+		require.NoError(t, broker.Publish(ctx, publishing))
+	}
+
+	msg := receive(t, tasks)
+	assert.Equal(t, "task", string(msg.Body()))
+	assert.Equal(t, "1", msg.Headers()["id"])
+	assert.False(t, msg.Redelivered())
+	require.NoError(t, msg.Ack())
+
+	msg = receive(t, reports)
+	assert.Equal(t, "report", string(msg.Body()))
+	require.NoError(t, msg.Ack())
+
+	msg = receive(t, events)
+	assert.Equal(t, "event", string(msg.Body()))
+	require.NoError(t, msg.Ack())
+
+	assertNoMessage(t, events, 100*time.Millisecond)
+	length, _ := streamStats(t, client, "run_events")
+	assert.Zero(t, length)
+
+	err := broker.Publish(ctx, messaging.Publishing{Exchange: "tasks", RoutingKey: "unknown", Mandatory: true})
+	assert.ErrorIs(t, err, messaging.ErrUnroutable)
+}
+
+func TestRedisStreamBrokerAckRemovesMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newRedisTestClient(t)
+	broker := newRedisTestBroker(t, client, 0)
+	msgs := consume(t, ctx, broker, "tasks_queue")
+
+	require.NoError(t, broker.Publish(ctx, messaging.Publishing{Exchange: "tasks", RoutingKey: "tasks.routing.key", Body: []byte("hello")}))
+	msg := receive(t, msgs)
+
+	length, pending := streamStats(t, client, "tasks_queue")
+	assert.Equal(t, int64(1), length)
+	assert.Equal(t, int64(1), pending)
+
+	require.NoError(t, msg.Ack())
+	assert.Error(t, msg.Ack())
+	assert.Error(t, msg.Nack(true))
+
+	length, pending = streamStats(t, client, "tasks_queue")
+	assert.Zero(t, length)
+	assert.Zero(t, pending)
+}
+
+func TestRedisStreamBrokerRequeuesNackedMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newRedisTestClient(t)
+	broker := newRedisTestBroker(t, client, 0)
+	msgs := consume(t, ctx, broker, "tasks_queue")
+
+	require.NoError(t, broker.Publish(ctx, messaging.Publishing{Exchange: "tasks", RoutingKey: "tasks.routing.key",
+		Body: []byte("again"), Headers: map[string]string{"id": "1"}}))
+
+	require.NoError(t, receive(t, msgs).Nack(true))
+
+	msg := receive(t, msgs)
+	assert.Equal(t, "again", string(msg.Body()))
+	assert.Equal(t, "1", msg.Headers()["id"])
+	assert.True(t, msg.Redelivered())
+	require.NoError(t, msg.Ack())
+
+	length, pending := streamStats(t, client, "tasks_queue")
+	assert.Zero(t, length)
+	assert.Zero(t, pending)
+}
+
+func TestRedisStreamBrokerDeadLettersRejectedMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newRedisTestClient(t)
+	broker := newRedisTestBroker(t, client, 0)
+	msgs := consume(t, ctx, broker, "tasks_queue")
+	dead := consume(t, ctx, broker, "tasks_dead")
+
+	require.NoError(t, broker.Publish(ctx, messaging.Publishing{Exchange: "tasks", RoutingKey: "tasks.routing.key",
+		Body: []byte("poison"), Headers: map[string]string{"id": "1"}}))
+
+	require.NoError(t, receive(t, msgs).Nack(false))
+
+	msg := receive(t, dead)
+	assert.Equal(t, "poison", string(msg.Body()))
+	assert.Equal(t, "1", msg.Headers()["id"])
+	assert.Equal(t, "tasks_queue", msg.Headers()[messaging.HeaderFirstDeathQueue])
+	assert.Equal(t, "rejected", msg.Headers()[messaging.HeaderFirstDeathReason])
+	require.NoError(t, msg.Ack())
+
+	length, pending := streamStats(t, client, "tasks_queue")
+	assert.Zero(t, length)
+	assert.Zero(t, pending)
+}
+
+func TestRedisStreamBrokerClaimsMessageOfStoppedConsumer(t *testing.T) {
+	client := newRedisTestClient(t)
+
+	// the first worker takes the message and stops without settling it
+	stoppedCtx, stop := context.WithCancel(context.Background())
+	stopped := newRedisTestBroker(t, client, time.Second)
+	require.NoError(t, stopped.Publish(stoppedCtx, messaging.Publishing{Exchange: "tasks", RoutingKey: "tasks.routing.key",
+		Body: []byte("orphan")}))
+	receive(t, consume(t, stoppedCtx, stopped, "tasks_queue"))
+	stop()
+	require.NoError(t, stopped.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := newRedisTestBroker(t, client, time.Second)
+	msgs := consume(t, ctx, broker, "tasks_queue")
+
+	select {
+	case msg := <-msgs:
+		assert.Equal(t, "orphan", string(msg.Body()))
+		assert.True(t, msg.Redelivered())
+		require.NoError(t, msg.Ack())
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message of the stopped consumer was not claimed")
+	}
+
+	_, pending := streamStats(t, client, "tasks_queue")
+	assert.Zero(t, pending)
+}
+
+func TestRedisStreamBrokerKeepsLongRunningMessageOwned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newRedisTestClient(t)
+	running := newRedisTestBroker(t, client, time.Second)
+	other := newRedisTestBroker(t, client, time.Second)
+
+	require.NoError(t, running.Publish(ctx, messaging.Publishing{Exchange: "tasks", RoutingKey: "tasks.routing.key",
+		Body: []byte("long run")}))
+	msg := receive(t, consume(t, ctx, running, "tasks_queue"))
+
+	// the heartbeat claims the message again every third of the idle time,
+	// so the other consumer doesn't take it while it runs for longer than that
+	assertNoMessage(t, consume(t, ctx, other, "tasks_queue"), 3*time.Second)
+
+	require.NoError(t, msg.Ack())
+	_, pending := streamStats(t, client, "tasks_queue")
+	assert.Zero(t, pending)
+}
+
+func TestRedisStreamBrokerReleasesDelayedMessageWhenDue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newRedisTestClient(t)
+	broker := newRedisTestBroker(t, client, 0)
+	msgs := consume(t, ctx, broker, "tasks_queue")
+
+	published := time.Now()
+	require.NoError(t, broker.Publish(ctx, messaging.Publishing{Exchange: "tasks", RoutingKey: "tasks.routing.key",
+		Body: []byte("later"), Delay: 1500 * time.Millisecond}))
+
+	length, _ := streamStats(t, client, "tasks_queue")
+	assert.Zero(t, length, "routed before it was due")
+
+	select {
+	case msg := <-msgs:
+		assert.Equal(t, "later", string(msg.Body()))
+		// delays are rounded up to whole seconds
+		assert.GreaterOrEqual(t, time.Since(published), 2*time.Second)
+		require.NoError(t, msg.Ack())
+	case <-time.After(5 * time.Second):
+		t.Fatal("delayed message not delivered")
+	}
+
+	delayed, err := client.ZCard(ctx, "mq:delayed").Result()
+	require.NoError(t, err)
+	assert.Zero(t, delayed)
+}
+
+func TestRedisStreamBrokerState(t *testing.T) {
+	broker := newRedisTestBroker(t, newRedisTestClient(t), 0)
+	assert.Equal(t, messaging.StateConnected, broker.State())
+
+	require.NoError(t, broker.Close())
+	assert.Equal(t, messaging.StateClosed, broker.State())
+	assert.ErrorIs(t, broker.Publish(context.Background(), messaging.Publishing{Exchange: "tasks"}), messaging.ErrClosed)
+}
@@ -0,0 +1,279 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/notify"
+	"github.com/siluk00/task_scheduler/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type email struct {
+	from string
+	to   []string
+	data string
+}
+
+// A local SMTP server keeping the emails it receives. It answers RCPT with rcptCode
+// when it is set and never offers STARTTLS.
+type smtpServer struct {
+	listener net.Listener
+	rcptCode int
+	mu       sync.Mutex
+	emails   []email
+	// the PLAIN credentials, "user:password"
+	auths []string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	srv := &smtpServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (srv *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	var current email
+
+	_ = tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-localhost\r\n250-8BITMIME\r\n250 AUTH PLAIN")
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			parts := strings.Split(string(decoded), "\x00")
+			srv.mu.Lock()
+			srv.auths = append(srv.auths, parts[len(parts)-2]+":"+parts[len(parts)-1])
+			srv.mu.Unlock()
+			_ = tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			current = email{from: address(arg)}
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			if srv.rcptCode != 0 {
+				_ = tp.PrintfLine("%d rejected", srv.rcptCode)
+				continue
+			}
+			current.to = append(current.to, address(arg))
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			current.data = string(data)
+			srv.mu.Lock()
+			srv.emails = append(srv.emails, current)
+			srv.mu.Unlock()
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+// The address between the angle brackets of a MAIL or RCPT argument
+func address(arg string) string {
+	_, rest, _ := strings.Cut(arg, "<")
+	addr, _, _ := strings.Cut(rest, ">")
+	return addr
+}
+
+func (srv *smtpServer) received() []email {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]email(nil), srv.emails...)
+}
+
+// The options change the configuration of a notifier sending through srv without STARTTLS
+func newEmailNotifier(srv *smtpServer, repo *fakeNotificationRepo, options ...func(cfg *config.AppConfig)) *notify.Notifier {
+	cfg := &config.AppConfig{NotifyMaxAttempts: 3, NotifyBackoffMs: 1, NotifyTimeoutSeconds: 5, NotifyDigestMin: 3,
+		SMTPHost: "127.0.0.1", SMTPPort: srv.listener.Addr().(*net.TCPAddr).Port, SMTPFrom: "scheduler@example.com"}
+	for _, option := range options {
+		option(cfg)
+	}
+	return notify.NewNotifier(cfg, repo)
+}
+
+func emailRule(t *testing.T, repo *fakeNotificationRepo, events ...domain.EventType) *domain.NotificationRule {
+	rule := &domain.NotificationRule{ID: "mail", Email: []string{"ops@example.com", "dev@example.com"}, Events: events}
+	require.NoError(t, rule.Validate())
+	require.NoError(t, repo.SaveRule(context.Background(), rule))
+	return rule
+}
+
+// Reads the headers and the body of a received email, its line breaks are already LF
+func parseEmail(t *testing.T, data string) (textproto.MIMEHeader, string) {
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(data)))
+	header, err := reader.ReadMIMEHeader()
+	require.NoError(t, err)
+	_, body, _ := strings.Cut(data, "\n\n")
+	return header, body
+}
+
+func TestEmailNotifierSendsTemplatedEmail(t *testing.T) {
+	srv := newSMTPServer(t)
+	repo := &fakeNotificationRepo{}
+	emailRule(t, repo, domain.EventRunFailed)
+	notifier := newEmailNotifier(srv, repo, func(cfg *config.AppConfig) {
+		cfg.SMTPUsername, cfg.SMTPPassword = "scheduler", "p4ss"
+	})
+
+	output := &domain.RunOutput{Stderr: "disk full\n"}
+	require.NoError(t, notifier.Notify(context.Background(), failedRunEvent(), output))
+
+	emails := srv.received()
+	require.Len(t, emails, 1)
+	assert.Equal(t, "scheduler@example.com", emails[0].from)
+	assert.Equal(t, []string{"ops@example.com", "dev@example.com"}, emails[0].to)
+
+	header, body := parseEmail(t, emails[0].data)
+	assert.Equal(t, "[task-scheduler] Task Backup failed", header.Get("Subject"))
+	assert.Equal(t, "ops@example.com, dev@example.com", header.Get("To"))
+	assert.Contains(t, body, "Run:       run-1")
+	assert.Contains(t, body, "Exit code: 1")
+	assert.Contains(t, body, "End of stderr:\ndisk full")
+	srv.mu.Lock()
+	assert.Equal(t, []string{"scheduler:p4ss"}, srv.auths)
+	srv.mu.Unlock()
+
+	require.Len(t, repo.deliveries, 1)
+	assert.True(t, repo.deliveries[0].Delivered)
+	assert.Equal(t, "mailto:ops@example.com,dev@example.com", repo.deliveries[0].URL)
+	assert.Equal(t, repo.deliveries[0].ID, header.Get(notify.HeaderEmailDelivery))
+}
+
+func TestEmailNotifierBatchesDigest(t *testing.T) {
+	srv := newSMTPServer(t)
+	repo := &fakeNotificationRepo{}
+	emailRule(t, repo, domain.EventRunFailed, domain.EventRunSLAMissed)
+	notifier := newEmailNotifier(srv, repo, func(cfg *config.AppConfig) { cfg.NotifyDigestWindowMs = 100 })
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, notifier.Notify(context.Background(), failedRunEvent(), nil))
+	}
+	missed := failedRunEvent()
+	missed.Type = domain.EventRunSLAMissed
+	missed.Task.SLASeconds = 60
+	require.NoError(t, notifier.Notify(context.Background(), missed, nil))
+	assert.Empty(t, srv.received())
+
+	require.Eventually(t, func() bool { return len(srv.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	header, body := parseEmail(t, srv.received()[0].data)
+	assert.Equal(t, "[task-scheduler] 4 task notifications: 3 failed, 1 missed its SLA of 1m0s", header.Get("Subject"))
+	assert.Equal(t, 3, strings.Count(body, "task Backup failed, run run-1"))
+	assert.Contains(t, body, "task Backup missed its SLA of 1m0s")
+
+	var deliveries []*domain.NotificationDelivery
+	require.Eventually(t, func() bool {
+		deliveries, _ = repo.ListDeliveries(context.Background(), 10)
+		return len(deliveries) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, domain.EventNotificationDigest, deliveries[0].Event)
+	assert.True(t, deliveries[0].Delivered)
+}
+
+func TestEmailNotifierSendsFewEmailsSeparately(t *testing.T) {
+	srv := newSMTPServer(t)
+	repo := &fakeNotificationRepo{}
+	emailRule(t, repo, domain.EventRunFailed)
+	notifier := newEmailNotifier(srv, repo, func(cfg *config.AppConfig) { cfg.NotifyDigestWindowMs = 50 })
+
+	require.NoError(t, notifier.Notify(context.Background(), failedRunEvent(), nil))
+	require.NoError(t, notifier.Notify(context.Background(), failedRunEvent(), nil))
+
+	require.Eventually(t, func() bool { return len(srv.received()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	for _, received := range srv.received() {
+		header, _ := parseEmail(t, received.data)
+		assert.Equal(t, "[task-scheduler] Task Backup failed", header.Get("Subject"))
+	}
+}
+
+func TestEmailNotifierCloseSendsPendingDigests(t *testing.T) {
+	srv := newSMTPServer(t)
+	repo := &fakeNotificationRepo{}
+	emailRule(t, repo, domain.EventRunFailed)
+	notifier := newEmailNotifier(srv, repo, func(cfg *config.AppConfig) { cfg.NotifyDigestWindowMs = int(time.Hour.Milliseconds()) })
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, notifier.Notify(context.Background(), failedRunEvent(), nil))
+	}
+	notifier.Close()
+
+	emails := srv.received()
+	require.Len(t, emails, 1)
+	header, _ := parseEmail(t, emails[0].data)
+	assert.Equal(t, "[task-scheduler] 3 task notifications: 3 failed", header.Get("Subject"))
+}
+
+func TestEmailNotifierRequiresStartTLS(t *testing.T) {
+	srv := newSMTPServer(t)
+	repo := &fakeNotificationRepo{}
+	rule := emailRule(t, repo, domain.EventRunFailed)
+	notifier := newEmailNotifier(srv, repo, func(cfg *config.AppConfig) { cfg.SMTPStartTLS = true })
+
+	delivery := notifier.Deliver(context.Background(), rule, notify.NewPayload(failedRunEvent(), nil))
+	assert.False(t, delivery.Delivered)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Contains(t, delivery.Error, "STARTTLS")
+	assert.Empty(t, srv.received())
+}
+
+func TestEmailNotifierDoesNotRetryPermanentRejection(t *testing.T) {
+	srv := newSMTPServer(t)
+	srv.rcptCode = 550
+	repo := &fakeNotificationRepo{}
+	rule := emailRule(t, repo, domain.EventRunFailed)
+	notifier := newEmailNotifier(srv, repo)
+
+	delivery := notifier.Deliver(context.Background(), rule, notify.NewPayload(failedRunEvent(), nil))
+	assert.False(t, delivery.Delivered)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, 550, delivery.StatusCode)
+}
+
+func TestNotificationRuleTargets(t *testing.T) {
+	events := []domain.EventType{domain.EventRunFailed}
+
+	assert.NoError(t, (&domain.NotificationRule{Email: []string{"ops@example.com"}, Events: events}).Validate())
+	assert.ErrorIs(t, (&domain.NotificationRule{Email: []string{"Ops <ops@example.com>"}, Events: events}).Validate(),
+		domain.ErrInvalidNotificationEmail)
+	assert.ErrorIs(t, (&domain.NotificationRule{URL: "https://example.com", Email: []string{"ops@example.com"},
+		Events: events}).Validate(), domain.ErrInvalidNotificationTarget)
+	assert.ErrorIs(t, (&domain.NotificationRule{Events: events}).Validate(), domain.ErrInvalidNotificationURL)
+}
@@ -0,0 +1,211 @@
+package notify_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/notify"
+	"github.com/siluk00/task_scheduler/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNotificationRepo struct {
+	mu         sync.Mutex
+	rules      []*domain.NotificationRule
+	deliveries []*domain.NotificationDelivery
+}
+
+func (r *fakeNotificationRepo) SaveRule(ctx context.Context, rule *domain.NotificationRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, rule)
+	return nil
+}
+
+func (r *fakeNotificationRepo) FindRule(ctx context.Context, id string) (*domain.NotificationRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rule := range r.rules {
+		if rule.ID == id {
+			return rule, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeNotificationRepo) ListRules(ctx context.Context) ([]*domain.NotificationRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*domain.NotificationRule(nil), r.rules...), nil
+}
+
+func (r *fakeNotificationRepo) DeleteRule(ctx context.Context, id string) error {
+	return nil
+}
+
+func (r *fakeNotificationRepo) SaveDelivery(ctx context.Context, delivery *domain.NotificationDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, delivery)
+	return nil
+}
+
+func (r *fakeNotificationRepo) ListDeliveries(ctx context.Context, limit int) ([]*domain.NotificationDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*domain.NotificationDelivery(nil), r.deliveries...), nil
+}
+
+// A webhook receiver answering with the given status codes in turn, the last one repeated
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rcv := &receiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rcv.mu.Lock()
+		status := rcv.statuses[min(len(rcv.requests), len(rcv.statuses)-1)]
+		rcv.requests = append(rcv.requests, r)
+		rcv.bodies = append(rcv.bodies, body)
+		rcv.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *receiver) count() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return len(rcv.requests)
+}
+
+func newNotifier(repo *fakeNotificationRepo) *notify.Notifier {
+	return notify.NewNotifier(&config.AppConfig{NotifyMaxAttempts: 3, NotifyBackoffMs: 1, NotifyTimeoutSeconds: 5}, repo)
+}
+
+func failedRunEvent() *domain.Event {
+	task := &domain.Task{ID: "backup", Name: "Backup", Command: "exit 1", Status: domain.TaskStatusFailed}
+	run := &domain.TaskRun{ID: "run-1", TaskID: "backup", Status: domain.TaskStatusFailed, ExitCode: 1}
+	return domain.NewRunEvent(task, run)
+}
+
+func TestNotifierSignsPayload(t *testing.T) {
+	rcv := newReceiver(t, http.StatusOK)
+	repo := &fakeNotificationRepo{}
+	rule := &domain.NotificationRule{ID: "r1", URL: rcv.URL, Events: []domain.EventType{domain.EventRunFailed}, Secret: "s3cret"}
+	require.NoError(t, repo.SaveRule(context.Background(), rule))
+
+	output := &domain.RunOutput{Stdout: strings.Repeat("x", 5000) + "last line\n", Stderr: "boom\n"}
+	require.NoError(t, newNotifier(repo).Notify(context.Background(), failedRunEvent(), output))
+
+	require.Equal(t, 1, rcv.count())
+	req, body := rcv.requests[0], rcv.bodies[0]
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "run.failed", req.Header.Get(notify.HeaderEvent))
+	assert.True(t, hmac.Equal([]byte(notify.Sign("s3cret", body)), []byte(req.Header.Get(notify.HeaderSignature))))
+
+	var payload domain.NotificationPayload
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, domain.EventRunFailed, payload.Event)
+	assert.Equal(t, "backup", payload.TaskID)
+	assert.Equal(t, domain.TaskStatusFailed, payload.Status)
+	require.NotNil(t, payload.Run)
+	assert.Equal(t, "run-1", payload.Run.ID)
+	require.NotNil(t, payload.OutputTail)
+	assert.Len(t, payload.OutputTail.Stdout, 2048)
+	assert.True(t, strings.HasSuffix(payload.OutputTail.Stdout, "last line\n"))
+	assert.Equal(t, "boom\n", payload.OutputTail.Stderr)
+
+	require.Len(t, repo.deliveries, 1)
+	assert.True(t, repo.deliveries[0].Delivered)
+	assert.Equal(t, req.Header.Get(notify.HeaderDelivery), repo.deliveries[0].ID)
+}
+
+func TestNotifierRetriesFailedDeliveries(t *testing.T) {
+	rcv := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent)
+	repo := &fakeNotificationRepo{}
+	rule := &domain.NotificationRule{ID: "r1", URL: rcv.URL}
+
+	delivery := newNotifier(repo).Deliver(context.Background(), rule, notify.NewPayload(failedRunEvent(), nil))
+
+	assert.True(t, delivery.Delivered)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.StatusCode)
+	assert.Empty(t, delivery.Error)
+	assert.Equal(t, 3, rcv.count())
+
+	// every attempt is the same delivery
+	assert.Equal(t, rcv.requests[0].Header.Get(notify.HeaderDelivery), rcv.requests[2].Header.Get(notify.HeaderDelivery))
+	assert.Len(t, repo.deliveries, 1)
+}
+
+func TestNotifierGivesUp(t *testing.T) {
+	tests := map[string]struct {
+		status   int
+		attempts int
+	}{
+		"server error after every attempt": {http.StatusServiceUnavailable, 3},
+		"client error at once":             {http.StatusBadRequest, 1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rcv := newReceiver(t, tt.status)
+			repo := &fakeNotificationRepo{}
+			rule := &domain.NotificationRule{ID: "r1", URL: rcv.URL}
+
+			delivery := newNotifier(repo).Deliver(context.Background(), rule, notify.NewPayload(failedRunEvent(), nil))
+
+			assert.False(t, delivery.Delivered)
+			assert.Equal(t, tt.attempts, delivery.Attempts)
+			assert.Equal(t, tt.status, delivery.StatusCode)
+			assert.NotEmpty(t, delivery.Error)
+			require.Len(t, repo.deliveries, 1)
+			assert.False(t, repo.deliveries[0].Delivered)
+		})
+	}
+}
+
+func TestNotifierSendsOnlyToMatchingRules(t *testing.T) {
+	global := newReceiver(t, http.StatusOK)
+	sameTask := newReceiver(t, http.StatusOK)
+	otherTask := newReceiver(t, http.StatusOK)
+	otherEvent := newReceiver(t, http.StatusOK)
+
+	repo := &fakeNotificationRepo{}
+	failed := []domain.EventType{domain.EventRunFailed}
+	for _, rule := range []*domain.NotificationRule{
+		{ID: "global", URL: global.URL, Events: failed},
+		{ID: "same", URL: sameTask.URL, Events: failed, TaskID: "backup"},
+		{ID: "other", URL: otherTask.URL, Events: failed, TaskID: "reports"},
+		{ID: "succeeded", URL: otherEvent.URL, Events: []domain.EventType{domain.EventRunSucceeded}},
+	} {
+		require.NoError(t, repo.SaveRule(context.Background(), rule))
+	}
+
+	require.NoError(t, newNotifier(repo).Notify(context.Background(), failedRunEvent(), nil))
+
+	assert.Equal(t, 1, global.count())
+	assert.Equal(t, 1, sameTask.count())
+	assert.Zero(t, otherTask.count())
+	assert.Zero(t, otherEvent.count())
+}
@@ -0,0 +1,97 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/repository/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *goredis.Client) {
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestRunRepositoryStoresRuns(t *testing.T) {
+	_, client := newTestRedis(t)
+	repo := redis.NewRunRepository(client)
+	ctx := context.Background()
+
+	task := &domain.Task{ID: "report", Name: "Report"}
+	first, second := domain.NewTaskRun(task), domain.NewTaskRun(task)
+	second.StartedAt = first.StartedAt.Add(time.Second)
+	require.NoError(t, repo.CreateRun(ctx, first))
+	require.NoError(t, repo.CreateRun(ctx, second))
+
+	first.Finish(domain.TaskStatusCompleted, 0, nil)
+	require.NoError(t, repo.UpdateRun(ctx, first))
+
+	found, err := repo.FindRun(ctx, "report", first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusCompleted, found.Status)
+
+	missing, err := repo.FindRun(ctx, "report", "nope")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	runs, err := repo.ListRuns(ctx, "report")
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, second.ID, runs[0].ID, "newest first")
+}
+
+func TestRunRepositoryStreamsOutputUntilClosed(t *testing.T) {
+	mr, client := newTestRedis(t)
+	repo := redis.NewRunRepository(client)
+	ctx := context.Background()
+
+	require.NoError(t, repo.AppendOutput(ctx, "report", "r1", domain.OutputStdout, []byte("rows: ")))
+	require.NoError(t, repo.AppendOutput(ctx, "report", "r1", domain.OutputStderr, []byte("warning\n")))
+	require.NoError(t, repo.AppendOutput(ctx, "report", "r1", domain.OutputStdout, []byte("3\n")))
+
+	chunks, done, err := repo.ReadOutput(ctx, "report", "r1", "0", 0)
+	require.NoError(t, err)
+	assert.False(t, done)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, domain.OutputStderr, chunks[1].Stream)
+
+	// a client resuming after the last chunk only gets the end
+	require.NoError(t, repo.CloseOutput(ctx, "report", "r1"))
+	chunks, done, err = repo.ReadOutput(ctx, "report", "r1", chunks[2].ID, 0)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Empty(t, chunks)
+
+	output, err := repo.GetOutput(ctx, "report", "r1")
+	require.NoError(t, err)
+	assert.Equal(t, "rows: 3\n", output.Stdout)
+	assert.Equal(t, "warning\n", output.Stderr)
+
+	// the output expires instead of growing forever
+	assert.Greater(t, mr.TTL("run_output:report:r1"), time.Duration(0))
+	mr.FastForward(8 * 24 * time.Hour)
+	assert.False(t, mr.Exists("run_output:report:r1"))
+}
+
+func TestRunRepositoryCancelsRuns(t *testing.T) {
+	_, client := newTestRedis(t)
+	repo := redis.NewRunRepository(client)
+	ctx := context.Background()
+
+	cancelled, err := repo.IsCancelled(ctx, "report", "r1")
+	require.NoError(t, err)
+	assert.False(t, cancelled)
+
+	require.NoError(t, repo.CancelRun(ctx, "report", "r1"))
+	cancelled, err = repo.IsCancelled(ctx, "report", "r1")
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+}
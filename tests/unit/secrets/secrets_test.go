@@ -0,0 +1,100 @@
+package secrets_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/siluk00/task_scheduler/internal/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCipher(t *testing.T) *secrets.Cipher {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	c, err := secrets.NewCipher(base64.StdEncoding.EncodeToString(key))
+	require.NoError(t, err)
+	return c
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	c := newTestCipher(t)
+
+	encrypted, err := c.Encrypt("DB_PASSWORD", []byte("hunter2"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(encrypted), "hunter2")
+
+	plaintext, err := c.Decrypt("DB_PASSWORD", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", string(plaintext))
+
+	// the name is authenticated, so the ciphertext can't be reused for another secret
+	_, err = c.Decrypt("API_TOKEN", encrypted)
+	assert.Error(t, err)
+}
+
+func TestNewCipherInvalidKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"Not base64", "not a key!"},
+		{"Too short", base64.StdEncoding.EncodeToString([]byte("short"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := secrets.NewCipher(tt.key)
+			assert.ErrorIs(t, err, secrets.ErrInvalidMasterKey)
+		})
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	r := secrets.NewRedactor([]string{"abc", "abcdef", ""})
+
+	assert.Equal(t, "token=[REDACTED] short=[REDACTED]", r.Redact("token=abcdef short=abc"))
+
+	var empty *secrets.Redactor
+	assert.Equal(t, "unchanged", empty.Redact("unchanged"))
+}
+
+func TestRedactorHoldsBackPossibleStartOfSecret(t *testing.T) {
+	r := secrets.NewRedactor([]string{"hunter2", "abc"})
+
+	// "hunt" may be completed by the next write
+	released, rest := r.RedactPrefix("password=hunt")
+	assert.Equal(t, "passwor", released)
+	assert.Equal(t, "d=hunt", rest)
+
+	released, rest = r.RedactPrefix(rest + "er2 done, more output")
+	assert.Equal(t, "d=[REDACTED] done, more ", released)
+	assert.Equal(t, "output", rest)
+
+	// a secret across the cut is held back whole
+	released, rest = r.RedactPrefix("012345abc1234")
+	assert.Equal(t, "012345", released)
+	assert.Equal(t, "abc1234", rest)
+	assert.Equal(t, "[REDACTED]1234", r.Redact(rest))
+
+	var empty *secrets.Redactor
+	released, rest = empty.RedactPrefix("unchanged")
+	assert.Equal(t, "unchanged", released)
+	assert.Empty(t, rest)
+}
+
+func TestRedactorRedactsSecretSplitAcrossWrites(t *testing.T) {
+	r := secrets.NewRedactor([]string{"s3cr3t-token"})
+	output := "token: s3cr3t-token\nagain s3cr3t-token end"
+
+	// every way to split the output in two writes
+	for i := 0; i <= len(output); i++ {
+		first, rest := r.RedactPrefix(output[:i])
+		second, rest := r.RedactPrefix(rest + output[i:])
+		stored := first + second + r.Redact(rest)
+		assert.Equal(t, "token: [REDACTED]\nagain [REDACTED] end", stored, "split at %d", i)
+	}
+}
@@ -0,0 +1,160 @@
+package worker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts a run of the task through the first queue and, once it is running, sends
+// a second one through the other queue, whose consumer could run both at once
+func (tw *testWorker) overlapRuns(t *testing.T, task *domain.Task, first, second *domain.TaskMessage) {
+	task.Status = domain.TaskStatusRunning
+	require.NoError(t, tw.taskRepo.Create(context.Background(), task))
+
+	for i, queue := range []string{messaging.DefaultTaskQueue, "reports"} {
+		taskMsg := []*domain.TaskMessage{first, second}[i]
+		require.NoError(t, tw.broker.Publish(context.Background(), messaging.Publishing{
+			Exchange:   messaging.TasksExchange,
+			RoutingKey: messaging.TaskRoutingKey(queue),
+			Body:       marshalTaskMessage(t, taskMsg),
+		}))
+		tw.waitRun(t, task.ID, domain.TaskStatusRunning)
+	}
+}
+
+func newOverlapWorker(t *testing.T) *testWorker {
+	tw := newTestWorker(t, withLockRetry, func(cfg *config.AppConfig) {
+		cfg.WorkerQueues = []string{messaging.DefaultTaskQueue, "reports"}
+	})
+	tw.startConsumer(t)
+	return tw
+}
+
+func TestWorkerSkipsOverlappingRunWhenForbidden(t *testing.T) {
+	tw := newOverlapWorker(t)
+
+	first, second := domain.NewTaskMessage("sync"), domain.NewTaskMessage("sync")
+	tw.overlapRuns(t, &domain.Task{ID: "sync", Name: "Sync", Command: "sleep 1",
+		ConcurrencyPolicy: domain.ConcurrencyForbid}, first, second)
+
+	skipped := tw.waitRun(t, "sync", domain.TaskStatusSkipped)
+	assert.Equal(t, second.RunID, skipped.ID)
+	assert.Equal(t, second.CorrelationID, skipped.CorrelationID)
+	assert.Contains(t, skipped.Error, first.RunID)
+
+	completed := tw.waitRun(t, "sync", domain.TaskStatusCompleted)
+	assert.Equal(t, first.RunID, completed.ID)
+	runs, err := tw.runRepo.ListRuns(context.Background(), "sync")
+	require.NoError(t, err)
+	assert.Len(t, runs, 2)
+	assert.Empty(t, tw.locks.holder("task/sync"))
+}
+
+func TestWorkerQueuesOverlappingRun(t *testing.T) {
+	tw := newOverlapWorker(t)
+
+	first, second := domain.NewTaskMessage("sync"), domain.NewTaskMessage("sync")
+	tw.overlapRuns(t, &domain.Task{ID: "sync", Name: "Sync", Command: "sleep 0.5",
+		ConcurrencyPolicy: domain.ConcurrencyQueue}, first, second)
+
+	// the deferred run is recorded as queued, it still runs once the first one finished the task
+	require.Eventually(t, func() bool {
+		run, _ := tw.runRepo.FindRun(context.Background(), "sync", second.RunID)
+		return run != nil && run.Status == domain.TaskStatusQueued
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		run, _ := tw.runRepo.FindRun(context.Background(), "sync", second.RunID)
+		return run != nil && run.Status == domain.TaskStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	firstRun, err := tw.runRepo.FindRun(context.Background(), "sync", first.RunID)
+	require.NoError(t, err)
+	secondRun, err := tw.runRepo.FindRun(context.Background(), "sync", second.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusCompleted, firstRun.Status)
+	assert.False(t, secondRun.StartedAt.Before(firstRun.FinishedAt), "runs overlapped")
+}
+
+func TestWorkerCancelsRunReplacedByANewOne(t *testing.T) {
+	tw := newOverlapWorker(t)
+
+	first, second := domain.NewTaskMessage("sync"), domain.NewTaskMessage("sync")
+	first.Params = map[string]string{"DURATION": "30"}
+	tw.overlapRuns(t, &domain.Task{ID: "sync", Name: "Sync", Command: "sleep ${DURATION:-0}",
+		ConcurrencyPolicy: domain.ConcurrencyReplace}, first, second)
+
+	cancelled := tw.waitRun(t, "sync", domain.TaskStatusFailed)
+	assert.Equal(t, first.RunID, cancelled.ID)
+	assert.Equal(t, "run was cancelled", cancelled.Error)
+
+	completed := tw.waitRun(t, "sync", domain.TaskStatusCompleted)
+	assert.Equal(t, second.RunID, completed.ID)
+	assert.False(t, completed.StartedAt.Before(cancelled.FinishedAt), "runs overlapped")
+}
+
+func TestWorkerRunsOverlappingRunsByDefault(t *testing.T) {
+	tw := newOverlapWorker(t)
+
+	first, second := domain.NewTaskMessage("sync"), domain.NewTaskMessage("sync")
+	tw.overlapRuns(t, &domain.Task{ID: "sync", Name: "Sync", Command: "sleep 0.5"}, first, second)
+
+	require.Eventually(t, func() bool {
+		runs, _ := tw.runRepo.ListRuns(context.Background(), "sync")
+		running := 0
+		for _, run := range runs {
+			if run.Status == domain.TaskStatusRunning {
+				running++
+			}
+		}
+		return running == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWorkerSkipsRunOfFinishedTaskWithQueuePolicy(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "sync", Name: "Sync", Command: "true", Status: domain.TaskStatusCompleted,
+		ConcurrencyPolicy: domain.ConcurrencyQueue}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	tw.publishTask(t, domain.NewTaskMessage("sync"))
+
+	require.Eventually(t, func() bool {
+		ready, unacked := tw.broker.Stats("tasks_queue")
+		return ready == 0 && unacked == 0
+	}, time.Second, 10*time.Millisecond)
+	runs, err := tw.runRepo.ListRuns(context.Background(), "sync")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
+
+func TestWorkerSkipsRunThatAlreadyFinished(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "sync", Name: "Sync", Command: "echo again", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+
+	// the run finished but its message wasn't marked as processed
+	taskMsg := domain.NewTaskMessage("sync")
+	run := domain.NewTaskRun(&task)
+	run.ID = taskMsg.RunID
+	run.Finish(domain.TaskStatusCompleted, 0, nil)
+	require.NoError(t, tw.runRepo.CreateRun(context.Background(), run))
+	tw.publishTask(t, taskMsg)
+
+	require.Eventually(t, func() bool {
+		ready, unacked := tw.broker.Stats("tasks_queue")
+		return ready == 0 && unacked == 0
+	}, time.Second, 10*time.Millisecond)
+	stored, err := tw.runRepo.FindRun(context.Background(), "sync", taskMsg.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, run.FinishedAt, stored.FinishedAt, "the run ran again")
+}
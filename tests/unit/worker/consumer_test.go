@@ -0,0 +1,359 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/messaging/memory"
+	"github.com/siluk00/task_scheduler/internal/worker"
+	"github.com/siluk00/task_scheduler/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testWorker struct {
+	worker        *worker.TaskWorker
+	broker        *memory.Broker
+	taskRepo      *fakeTaskRepo
+	runRepo       *fakeRunRepo
+	deadLetters   *fakeDeadLetterRepo
+	consumers     *fakeConsumerRepo
+	processed     *fakeProcessedRepo
+	notifications *fakeNotificationRepo
+	matrices      *fakeMatrixRepo
+	locks         *fakeLockRepo
+	rateLimits    *fakeRateLimitRepo
+	secrets       *fakeSecretRepo
+}
+
+// The options change the default test configuration
+func newTestWorker(t *testing.T, options ...func(cfg *config.AppConfig)) *testWorker {
+	broker := memory.NewBroker()
+	tw := newTestWorkerOn(t, broker, options...)
+	tw.broker = broker
+	return tw
+}
+
+// A test worker whose messages go through the given broker
+func newTestWorkerOn(t *testing.T, broker messaging.Broker, options ...func(cfg *config.AppConfig)) *testWorker {
+	tw := &testWorker{
+		taskRepo:      newFakeTaskRepo(),
+		runRepo:       newFakeRunRepo(),
+		deadLetters:   newFakeDeadLetterRepo(),
+		consumers:     newFakeConsumerRepo(),
+		processed:     newFakeProcessedRepo(),
+		notifications: &fakeNotificationRepo{},
+		matrices:      newFakeMatrixRepo(),
+		locks:         newFakeLockRepo(),
+		rateLimits:    newFakeRateLimitRepo(),
+		secrets:       newFakeSecretRepo(),
+	}
+
+	cfg := &config.AppConfig{OutputMaxBytes: 1024, RunAsUID: -1, RunAsGID: -1, MaxDeliveryAttempts: 3,
+		NotifyMaxAttempts: 3, NotifyBackoffMs: 1, NotifyTimeoutSeconds: 5}
+	for _, option := range options {
+		option(cfg)
+	}
+	tw.worker = worker.NewTaskWorkerWithDependencies(cfg, worker.Dependencies{
+		TaskRepo:         tw.taskRepo,
+		RunRepo:          tw.runRepo,
+		SecretRepo:       tw.secrets,
+		DeadLetterRepo:   tw.deadLetters,
+		OutboxRepo:       tw.taskRepo,
+		ProcessedRepo:    tw.processed,
+		ConsumerRepo:     tw.consumers,
+		NotificationRepo: tw.notifications,
+		MatrixRepo:       tw.matrices,
+		LockRepo:         tw.locks,
+		RateLimitRepo:    tw.rateLimits,
+		Broker:           broker,
+	})
+	require.NoError(t, tw.worker.SetupTopology(context.Background()))
+
+	return tw
+}
+
+// Starts the consumers of the task queue and the dead letter queue until the test ends
+func (tw *testWorker) startConsumer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, tw.worker.StartConsumer(ctx))
+	}()
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, tw.worker.StartDeadLetterConsumer(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+}
+
+// Waits until the dead letter store holds n dead letters and returns them
+func (tw *testWorker) waitDeadLetters(t *testing.T, n int) []*domain.DeadLetter {
+	var letters []*domain.DeadLetter
+	require.Eventually(t, func() bool {
+		letters, _ = tw.deadLetters.ListDeadLetters(context.Background())
+		return len(letters) == n
+	}, 5*time.Second, 10*time.Millisecond)
+	return letters
+}
+
+func (tw *testWorker) publish(t *testing.T, body []byte) {
+	require.NoError(t, tw.broker.Publish(context.Background(), messaging.Publishing{
+		Exchange:   "tasks",
+		RoutingKey: "tasks.routing.key",
+		Body:       body,
+	}))
+}
+
+// Publishes a task message in the default queue
+func (tw *testWorker) publishTask(t *testing.T, taskMsg *domain.TaskMessage) {
+	tw.publish(t, marshalTaskMessage(t, taskMsg))
+}
+
+func marshalTaskMessage(t *testing.T, taskMsg *domain.TaskMessage) []byte {
+	body, err := json.Marshal(taskMsg)
+	require.NoError(t, err)
+	return body
+}
+
+func TestConsumerExecutesTask(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "hello", Name: "Hello", Command: "echo hello", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+
+	taskMsg := domain.NewTaskMessage("hello")
+	tw.publishTask(t, taskMsg)
+
+	require.Eventually(t, func() bool {
+		stored, _ := tw.taskRepo.FindById(context.Background(), "hello")
+		return stored.Status == domain.TaskStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	runs, err := tw.runRepo.ListRuns(context.Background(), "hello")
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, domain.TaskStatusCompleted, runs[0].Status)
+	assert.Equal(t, taskMsg.RunID, runs[0].ID)
+	assert.Equal(t, taskMsg.CorrelationID, runs[0].CorrelationID)
+
+	output, err := tw.runRepo.GetOutput(context.Background(), "hello", runs[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", output.Stdout)
+
+	require.Eventually(t, func() bool {
+		ready, unacked := tw.broker.Stats("tasks_queue")
+		return ready == 0 && unacked == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestConsumerDeadLettersMalformedMessage(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	tw.publish(t, []byte("not json"))
+
+	letters := tw.waitDeadLetters(t, 1)
+	assert.Equal(t, domain.DeadLetterMalformed, letters[0].Reason)
+	assert.Equal(t, "not json", letters[0].Body)
+	assert.Equal(t, "tasks_queue", letters[0].Queue)
+	assert.NotEmpty(t, letters[0].Error)
+
+	require.Eventually(t, func() bool {
+		ready, unacked := tw.broker.Stats("tasks_queue")
+		return ready == 0 && unacked == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestConsumerDeadLettersAfterMaxAttempts(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.runRepo.createErr = errors.New("store unavailable")
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "broken", Name: "Broken", Command: "true", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+
+	tw.publishTask(t, domain.NewTaskMessage("broken"))
+
+	letters := tw.waitDeadLetters(t, 1)
+	assert.Equal(t, domain.DeadLetterMaxAttempts, letters[0].Reason)
+	assert.Equal(t, "broken", letters[0].TaskID)
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Contains(t, letters[0].Error, "store unavailable")
+
+	require.Eventually(t, func() bool {
+		ready, unacked := tw.broker.Stats("tasks_queue")
+		return ready == 0 && unacked == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestConsumerFailsRunWhenTaskCantBeSaved(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.taskRepo.updateErr = func(task *domain.Task) error {
+		if task.Status.IsFinished() {
+			return errors.New("store unavailable")
+		}
+		return nil
+	}
+	events := tw.subscribeEvents(t, "run.*")
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "unsaved", Name: "Unsaved", Command: "true", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+
+	tw.publishTask(t, domain.NewTaskMessage("unsaved"))
+	assert.Equal(t, domain.EventRunStarted, nextEvent(t, events).Type)
+	failed := nextEvent(t, events)
+	assert.Equal(t, domain.EventRunFailed, failed.Type)
+	require.NotNil(t, failed.Run)
+	assert.Contains(t, failed.Run.Error, "store unavailable")
+	tw.waitQueueSettled(t)
+
+	// the command ran once, its run is failed and nothing is retried
+	runs, err := tw.runRepo.ListRuns(context.Background(), "unsaved")
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, domain.TaskStatusFailed, runs[0].Status)
+	assert.Contains(t, runs[0].Error, "store unavailable")
+	assert.False(t, runs[0].FinishedAt.IsZero())
+	assert.Empty(t, tw.waitDeadLetters(t, 0))
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected %s event", event.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestConsumerRetriesSavingTaskAfterItsRun(t *testing.T) {
+	tw := newTestWorker(t)
+	var failures atomic.Int32
+	tw.taskRepo.updateErr = func(task *domain.Task) error {
+		if task.Status.IsFinished() && failures.Add(1) <= 2 {
+			return errors.New("store unavailable")
+		}
+		return nil
+	}
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "flaky", Name: "Flaky", Command: "true", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+
+	tw.publishTask(t, domain.NewTaskMessage("flaky"))
+	tw.waitRun(t, "flaky", domain.TaskStatusCompleted)
+	require.Eventually(t, func() bool {
+		stored, _ := tw.taskRepo.FindById(context.Background(), "flaky")
+		return stored.Status == domain.TaskStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	runs, err := tw.runRepo.ListRuns(context.Background(), "flaky")
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+}
+
+func TestConsumerRunsTaskAsStoredInRepository(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "edited", Name: "Edited", Command: "echo before", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+
+	// a message published before the edit, carrying the old task as its body
+	stale, err := json.Marshal(task)
+	require.NoError(t, err)
+
+	task.Command = "echo after"
+	require.NoError(t, tw.taskRepo.Update(context.Background(), &task))
+	tw.publish(t, stale)
+
+	require.Eventually(t, func() bool {
+		stored, _ := tw.taskRepo.FindById(context.Background(), "edited")
+		return stored.Status == domain.TaskStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	runs, err := tw.runRepo.ListRuns(context.Background(), "edited")
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+
+	output, err := tw.runRepo.GetOutput(context.Background(), "edited", runs[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "after\n", output.Stdout)
+}
+
+func TestConsumerDropsMessageOfDeletedTask(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	tw.publishTask(t, domain.NewTaskMessage("gone"))
+
+	require.Eventually(t, func() bool {
+		ready, unacked := tw.broker.Stats("tasks_queue")
+		return ready == 0 && unacked == 0
+	}, time.Second, 10*time.Millisecond)
+
+	runs, err := tw.runRepo.ListRuns(context.Background(), "gone")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+	assert.Empty(t, tw.waitDeadLetters(t, 0))
+}
+
+// Waits until the task queue is empty and every message settled
+func (tw *testWorker) waitQueueSettled(t *testing.T) {
+	require.Eventually(t, func() bool {
+		ready, unacked := tw.broker.Stats("tasks_queue")
+		return ready == 0 && unacked == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestConsumerSkipsProcessedMessage(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "once", Name: "Once", Command: "true", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+
+	taskMsg := domain.NewTaskMessage("once")
+	tw.publishTask(t, taskMsg)
+	require.Eventually(t, func() bool {
+		processed, _ := tw.processed.IsProcessed(context.Background(), taskMsg.RunID)
+		return processed
+	}, 5*time.Second, 10*time.Millisecond)
+	tw.waitQueueSettled(t)
+
+	// the task runs again, but the redelivered message of the first run must not
+	require.NoError(t, tw.taskRepo.Update(context.Background(), &task))
+	tw.publishTask(t, taskMsg)
+	tw.waitQueueSettled(t)
+
+	runs, err := tw.runRepo.ListRuns(context.Background(), "once")
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+}
+
+func TestConsumerAcksMessageOfFinishedTask(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "done", Name: "Done", Command: "true", Status: domain.TaskStatusCompleted}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+
+	tw.publishTask(t, domain.NewTaskMessage("done"))
+	tw.waitQueueSettled(t)
+
+	runs, err := tw.runRepo.ListRuns(context.Background(), "done")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+	assert.Empty(t, tw.waitDeadLetters(t, 0))
+}
@@ -0,0 +1,109 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Binds a queue to the events exchange with the pattern and returns its events as they arrive
+func (tw *testWorker) subscribeEvents(t *testing.T, pattern string) <-chan domain.Event {
+	require.NoError(t, tw.broker.Declare(context.Background(), messaging.Topology{
+		Queues:   []messaging.Queue{{Name: "events"}},
+		Bindings: []messaging.Binding{{Queue: "events", Exchange: messaging.EventsExchange, RoutingKey: pattern}},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	msgs, err := tw.broker.Consume(ctx, "events")
+	require.NoError(t, err)
+
+	events := make(chan domain.Event, 10)
+	go func() {
+		for msg := range msgs {
+			var event domain.Event
+			assert.NoError(t, json.Unmarshal(msg.Body(), &event))
+			_ = msg.Ack()
+			events <- event
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan domain.Event) domain.Event {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+		return domain.Event{}
+	}
+}
+
+func TestWorkerPublishesRunEvents(t *testing.T) {
+	tw := newTestWorker(t)
+	events := tw.subscribeEvents(t, "run.*")
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "hello", Name: "Hello", Command: "echo hello", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	taskMsg := domain.NewTaskMessage("hello")
+	tw.publishTask(t, taskMsg)
+
+	started := nextEvent(t, events)
+	assert.Equal(t, domain.EventRunStarted, started.Type)
+	assert.Equal(t, domain.EventVersion, started.Version)
+	assert.Equal(t, "hello", started.TaskID)
+	assert.Equal(t, taskMsg.CorrelationID, started.CorrelationID)
+	require.NotNil(t, started.Run)
+	assert.Equal(t, taskMsg.RunID, started.Run.ID)
+
+	succeeded := nextEvent(t, events)
+	assert.Equal(t, domain.EventRunSucceeded, succeeded.Type)
+	require.NotNil(t, succeeded.Run)
+	assert.Equal(t, taskMsg.RunID, succeeded.Run.ID)
+	assert.Equal(t, 0, succeeded.Run.ExitCode)
+	require.NotNil(t, succeeded.Task)
+	assert.Equal(t, domain.TaskStatusCompleted, succeeded.Task.Status)
+}
+
+func TestWorkerPublishesRunFailedEvent(t *testing.T) {
+	tw := newTestWorker(t)
+	events := tw.subscribeEvents(t, "run.failed")
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "fails", Name: "Fails", Command: "exit 3", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	tw.publishTask(t, domain.NewTaskMessage("fails"))
+
+	failed := nextEvent(t, events)
+	assert.Equal(t, domain.EventRunFailed, failed.Type)
+	require.NotNil(t, failed.Run)
+	assert.Equal(t, 3, failed.Run.ExitCode)
+}
+
+func TestWorkerPublishesSLAMissedEvent(t *testing.T) {
+	tw := newTestWorker(t)
+	events := tw.subscribeEvents(t, "run.*")
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "slow", Name: "Slow", Command: "sleep 1.2", Status: domain.TaskStatusRunning, SLASeconds: 1}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	tw.publishTask(t, domain.NewTaskMessage("slow"))
+
+	assert.Equal(t, domain.EventRunStarted, nextEvent(t, events).Type)
+	assert.Equal(t, domain.EventRunSucceeded, nextEvent(t, events).Type)
+
+	missed := nextEvent(t, events)
+	assert.Equal(t, domain.EventRunSLAMissed, missed.Type)
+	require.NotNil(t, missed.Run)
+	assert.Equal(t, domain.TaskStatusCompleted, missed.Run.Status)
+	require.NotNil(t, missed.Task)
+	assert.Equal(t, 1, missed.Task.SLASeconds)
+}
@@ -0,0 +1,679 @@
+package worker_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+)
+
+// In-memory repositories so the worker can run without redis
+
+// Also the outbox, as the outbox is written with the tasks
+type fakeTaskRepo struct {
+	mu     sync.Mutex
+	tasks  map[string]domain.Task
+	outbox []*fakeOutboxEntry
+	// fails the updates it returns an error for
+	updateErr func(task *domain.Task) error
+}
+
+type fakeOutboxEntry struct {
+	msg          *domain.OutboxMessage
+	claimedUntil time.Time
+}
+
+func newFakeTaskRepo() *fakeTaskRepo {
+	return &fakeTaskRepo{tasks: make(map[string]domain.Task)}
+}
+
+func (r *fakeTaskRepo) Create(ctx context.Context, task *domain.Task) error {
+	return r.Update(ctx, task)
+}
+
+func (r *fakeTaskRepo) FindById(ctx context.Context, id string) (*domain.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[id]
+	if !ok {
+		return nil, nil
+	}
+	return &task, nil
+}
+
+func (r *fakeTaskRepo) Update(ctx context.Context, task *domain.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.updateErr != nil {
+		if err := r.updateErr(task); err != nil {
+			return err
+		}
+	}
+	r.tasks[task.ID] = *task
+	return nil
+}
+
+func (r *fakeTaskRepo) UpdateWithOutbox(ctx context.Context, task *domain.Task, messages ...*domain.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tasks[task.ID] = *task
+	for _, msg := range messages {
+		r.outbox = append(r.outbox, &fakeOutboxEntry{msg: msg})
+	}
+	return nil
+}
+
+func (r *fakeTaskRepo) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]*domain.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var messages []*domain.OutboxMessage
+	for _, entry := range r.outbox {
+		if len(messages) < limit && !entry.claimedUntil.After(now) {
+			entry.claimedUntil = now.Add(lease)
+			messages = append(messages, entry.msg)
+		}
+	}
+	return messages, nil
+}
+
+func (r *fakeTaskRepo) DeleteOutbox(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, entry := range r.outbox {
+		if entry.msg.ID == id {
+			r.outbox = append(r.outbox[:i], r.outbox[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *fakeTaskRepo) outboxLen() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.outbox)
+}
+
+func (r *fakeTaskRepo) List(ctx context.Context, status domain.TaskStatus) ([]*domain.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tasks []*domain.Task
+	for _, task := range r.tasks {
+		if status == "" || task.Status == status {
+			tasks = append(tasks, &task)
+		}
+	}
+	return tasks, nil
+}
+
+func (r *fakeTaskRepo) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tasks, id)
+	return nil
+}
+
+func (r *fakeTaskRepo) FindScheduled(ctx context.Context, from, to time.Time) ([]*domain.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tasks []*domain.Task
+	for _, task := range r.tasks {
+		if !task.ScheduledAt.IsZero() && !task.ScheduledAt.Before(from) && !task.ScheduledAt.After(to) {
+			tasks = append(tasks, &task)
+		}
+	}
+	return tasks, nil
+}
+
+type fakeRunRepo struct {
+	mu        sync.Mutex
+	runs      map[string]domain.TaskRun
+	output    map[string][]domain.OutputChunk
+	cancelled map[string]bool
+	// returned by CreateRun when set, to make processing fail
+	createErr error
+}
+
+func newFakeRunRepo() *fakeRunRepo {
+	return &fakeRunRepo{
+		runs:      make(map[string]domain.TaskRun),
+		output:    make(map[string][]domain.OutputChunk),
+		cancelled: make(map[string]bool),
+	}
+}
+
+func (r *fakeRunRepo) CreateRun(ctx context.Context, run *domain.TaskRun) error {
+	r.mu.Lock()
+	err := r.createErr
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.UpdateRun(ctx, run)
+}
+
+func (r *fakeRunRepo) UpdateRun(ctx context.Context, run *domain.TaskRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[run.TaskID+":"+run.ID] = *run
+	return nil
+}
+
+func (r *fakeRunRepo) FindRun(ctx context.Context, taskID, runID string) (*domain.TaskRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.runs[taskID+":"+runID]
+	if !ok {
+		return nil, nil
+	}
+	return &run, nil
+}
+
+func (r *fakeRunRepo) ListRuns(ctx context.Context, taskID string) ([]*domain.TaskRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var runs []*domain.TaskRun
+	for _, run := range r.runs {
+		if run.TaskID == taskID {
+			runs = append(runs, &run)
+		}
+	}
+	return runs, nil
+}
+
+func (r *fakeRunRepo) ListRunsBetween(ctx context.Context, from, to time.Time) ([]*domain.TaskRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var runs []*domain.TaskRun
+	for _, run := range r.runs {
+		if !run.StartedAt.Before(from) && !run.StartedAt.After(to) {
+			runs = append(runs, &run)
+		}
+	}
+	return runs, nil
+}
+
+func (r *fakeRunRepo) CancelRun(ctx context.Context, taskID, runID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancelled[taskID+":"+runID] = true
+	return nil
+}
+
+func (r *fakeRunRepo) IsCancelled(ctx context.Context, taskID, runID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cancelled[taskID+":"+runID], nil
+}
+
+func (r *fakeRunRepo) AppendOutput(ctx context.Context, taskID, runID string, stream domain.OutputStream, data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := taskID + ":" + runID
+	r.output[key] = append(r.output[key], domain.OutputChunk{Stream: stream, Data: string(data)})
+	return nil
+}
+
+func (r *fakeRunRepo) CloseOutput(ctx context.Context, taskID, runID string) error {
+	return nil
+}
+
+func (r *fakeRunRepo) GetOutput(ctx context.Context, taskID, runID string) (*domain.RunOutput, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var output domain.RunOutput
+	for _, chunk := range r.output[taskID+":"+runID] {
+		if chunk.Stream == domain.OutputStdout {
+			output.Stdout += chunk.Data
+		} else {
+			output.Stderr += chunk.Data
+		}
+	}
+	return &output, nil
+}
+
+func (r *fakeRunRepo) ReadOutput(ctx context.Context, taskID, runID, after string, block time.Duration) ([]domain.OutputChunk, bool, error) {
+	return nil, true, nil
+}
+
+type fakeSecretRepo struct {
+	mu      sync.Mutex
+	secrets map[string]domain.Secret
+}
+
+func newFakeSecretRepo() *fakeSecretRepo {
+	return &fakeSecretRepo{secrets: make(map[string]domain.Secret)}
+}
+
+func (r *fakeSecretRepo) Set(ctx context.Context, secret *domain.Secret) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secrets[secret.Name] = *secret
+	return nil
+}
+
+func (r *fakeSecretRepo) Get(ctx context.Context, name string) (*domain.Secret, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	secret, ok := r.secrets[name]
+	if !ok {
+		return nil, nil
+	}
+	return &secret, nil
+}
+
+func (r *fakeSecretRepo) List(ctx context.Context) ([]*domain.Secret, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var secrets []*domain.Secret
+	for _, secret := range r.secrets {
+		secrets = append(secrets, &domain.Secret{Name: secret.Name})
+	}
+	return secrets, nil
+}
+
+func (r *fakeSecretRepo) Delete(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.secrets, name)
+	return nil
+}
+
+type fakeDeadLetterRepo struct {
+	mu      sync.Mutex
+	letters []domain.DeadLetter
+}
+
+func newFakeDeadLetterRepo() *fakeDeadLetterRepo {
+	return &fakeDeadLetterRepo{}
+}
+
+func (r *fakeDeadLetterRepo) SaveDeadLetter(ctx context.Context, letter *domain.DeadLetter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.letters = append(r.letters, *letter)
+	return nil
+}
+
+func (r *fakeDeadLetterRepo) FindDeadLetter(ctx context.Context, id string) (*domain.DeadLetter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, letter := range r.letters {
+		if letter.ID == id {
+			return &letter, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeDeadLetterRepo) ListDeadLetters(ctx context.Context) ([]*domain.DeadLetter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var letters []*domain.DeadLetter
+	for _, letter := range r.letters {
+		letters = append(letters, &letter)
+	}
+	return letters, nil
+}
+
+func (r *fakeDeadLetterRepo) DeleteDeadLetter(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, letter := range r.letters {
+		if letter.ID == id {
+			r.letters = append(r.letters[:i], r.letters[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *fakeDeadLetterRepo) PurgeDeadLetters(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	purged := len(r.letters)
+	r.letters = nil
+	return purged, nil
+}
+
+type fakeConsumerRepo struct {
+	mu        sync.Mutex
+	consumers map[string]map[string]bool
+}
+
+func newFakeConsumerRepo() *fakeConsumerRepo {
+	return &fakeConsumerRepo{consumers: make(map[string]map[string]bool)}
+}
+
+func (r *fakeConsumerRepo) RegisterConsumer(ctx context.Context, workerID string, queues []string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, queue := range queues {
+		if r.consumers[queue] == nil {
+			r.consumers[queue] = make(map[string]bool)
+		}
+		r.consumers[queue][workerID] = true
+	}
+	return nil
+}
+
+func (r *fakeConsumerRepo) UnregisterConsumer(ctx context.Context, workerID string, queues []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, queue := range queues {
+		delete(r.consumers[queue], workerID)
+	}
+	return nil
+}
+
+func (r *fakeConsumerRepo) CountConsumers(ctx context.Context, queue string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.consumers[queue]), nil
+}
+
+type fakeProcessedRepo struct {
+	mu        sync.Mutex
+	processed map[string]bool
+}
+
+func newFakeProcessedRepo() *fakeProcessedRepo {
+	return &fakeProcessedRepo{processed: make(map[string]bool)}
+}
+
+func (r *fakeProcessedRepo) IsProcessed(ctx context.Context, messageID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.processed[messageID], nil
+}
+
+func (r *fakeProcessedRepo) MarkProcessed(ctx context.Context, messageID string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processed[messageID] = true
+	return nil
+}
+
+type fakeNotificationRepo struct {
+	mu         sync.Mutex
+	rules      []*domain.NotificationRule
+	deliveries []*domain.NotificationDelivery
+}
+
+func (r *fakeNotificationRepo) SaveRule(ctx context.Context, rule *domain.NotificationRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, rule)
+	return nil
+}
+
+func (r *fakeNotificationRepo) FindRule(ctx context.Context, id string) (*domain.NotificationRule, error) {
+	return nil, nil
+}
+
+func (r *fakeNotificationRepo) ListRules(ctx context.Context) ([]*domain.NotificationRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*domain.NotificationRule(nil), r.rules...), nil
+}
+
+func (r *fakeNotificationRepo) DeleteRule(ctx context.Context, id string) error {
+	return nil
+}
+
+func (r *fakeNotificationRepo) SaveDelivery(ctx context.Context, delivery *domain.NotificationDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, delivery)
+	return nil
+}
+
+func (r *fakeNotificationRepo) ListDeliveries(ctx context.Context, limit int) ([]*domain.NotificationDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*domain.NotificationDelivery(nil), r.deliveries...), nil
+}
+
+type fakeMatrixRepo struct {
+	mu     sync.Mutex
+	groups map[string]domain.MatrixGroup
+}
+
+func newFakeMatrixRepo() *fakeMatrixRepo {
+	return &fakeMatrixRepo{groups: make(map[string]domain.MatrixGroup)}
+}
+
+func (r *fakeMatrixRepo) CreateGroup(ctx context.Context, group *domain.MatrixGroup) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.groups[group.TaskID+":"+group.RunID] = *group
+	return nil
+}
+
+func (r *fakeMatrixRepo) FindGroup(ctx context.Context, taskID, runID string) (*domain.MatrixGroup, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	group, ok := r.groups[taskID+":"+runID]
+	if !ok {
+		return nil, nil
+	}
+	return &group, nil
+}
+
+func (r *fakeMatrixRepo) NextChild(ctx context.Context, taskID, runID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	group := r.groups[taskID+":"+runID]
+	group.Started++
+	r.groups[taskID+":"+runID] = group
+	return group.Started - 1, nil
+}
+
+func (r *fakeMatrixRepo) FinishChild(ctx context.Context, taskID, runID string, status domain.TaskStatus) (*domain.MatrixGroup, error) {
+	return r.count(taskID, runID, func(group *domain.MatrixGroup) {
+		if status == domain.TaskStatusFailed {
+			group.Failed++
+		} else {
+			group.Completed++
+		}
+	})
+}
+
+func (r *fakeMatrixRepo) SkipChild(ctx context.Context, taskID, runID string) (*domain.MatrixGroup, error) {
+	return r.count(taskID, runID, func(group *domain.MatrixGroup) {
+		group.Skipped++
+	})
+}
+
+func (r *fakeMatrixRepo) count(taskID, runID string, increment func(group *domain.MatrixGroup)) (*domain.MatrixGroup, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	group := r.groups[taskID+":"+runID]
+	increment(&group)
+	r.groups[taskID+":"+runID] = group
+	group.Started = min(group.Started, group.Total)
+	return &group, nil
+}
+
+type fakeLock struct {
+	owner   string
+	expires time.Time
+}
+
+type fakeLockRepo struct {
+	mu    sync.Mutex
+	locks map[string]fakeLock
+}
+
+func newFakeLockRepo() *fakeLockRepo {
+	return &fakeLockRepo{locks: make(map[string]fakeLock)}
+}
+
+func (r *fakeLockRepo) AcquireLocks(ctx context.Context, names []string, owner string, ttl time.Duration) (string, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, name := range names {
+		if lock, ok := r.locks[name]; ok && lock.expires.After(now) {
+			return name, lock.owner, nil
+		}
+	}
+	for _, name := range names {
+		r.locks[name] = fakeLock{owner: owner, expires: now.Add(ttl)}
+	}
+	return "", "", nil
+}
+
+func (r *fakeLockRepo) RenewLocks(ctx context.Context, names []string, owner string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		if lock, ok := r.locks[name]; ok && lock.owner == owner {
+			r.locks[name] = fakeLock{owner: owner, expires: time.Now().Add(ttl)}
+		}
+	}
+	return nil
+}
+
+func (r *fakeLockRepo) ReleaseLocks(ctx context.Context, names []string, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		if r.locks[name].owner == owner {
+			delete(r.locks, name)
+		}
+	}
+	return nil
+}
+
+func (r *fakeLockRepo) holder(name string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.locks[name].owner
+}
+
+type fakeBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+type fakeRateLimitRepo struct {
+	mu      sync.Mutex
+	limits  map[string]*domain.RateLimit
+	running map[string]map[string]time.Time
+	buckets map[string]fakeBucket
+}
+
+func newFakeRateLimitRepo() *fakeRateLimitRepo {
+	return &fakeRateLimitRepo{
+		limits:  make(map[string]*domain.RateLimit),
+		running: make(map[string]map[string]time.Time),
+		buckets: make(map[string]fakeBucket),
+	}
+}
+
+func (r *fakeRateLimitRepo) SetLimit(ctx context.Context, limit *domain.RateLimit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *limit
+	r.limits[limit.Name] = &stored
+	return nil
+}
+
+func (r *fakeRateLimitRepo) FindLimit(ctx context.Context, name string) (*domain.RateLimit, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limit, ok := r.limits[name]
+	if !ok {
+		return nil, nil
+	}
+	found := *limit
+	return &found, nil
+}
+
+func (r *fakeRateLimitRepo) ListLimits(ctx context.Context) ([]*domain.RateLimit, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var limits []*domain.RateLimit
+	for _, limit := range r.limits {
+		found := *limit
+		limits = append(limits, &found)
+	}
+	return limits, nil
+}
+
+func (r *fakeRateLimitRepo) DeleteLimit(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.limits, name)
+	delete(r.running, name)
+	delete(r.buckets, name)
+	return nil
+}
+
+func (r *fakeRateLimitRepo) AcquireSlots(ctx context.Context, limits []*domain.RateLimit, owner string,
+	ttl time.Duration) (string, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	tokens := make(map[string]float64)
+	for _, limit := range limits {
+		if limit.MaxConcurrent > 0 {
+			running := 0
+			for other, expires := range r.running[limit.Name] {
+				if other != owner && expires.After(now) {
+					running++
+				}
+			}
+			if running >= limit.MaxConcurrent {
+				return limit.Name, 0, nil
+			}
+		}
+		if limit.StartsPerMinute > 0 {
+			rate := float64(limit.StartsPerMinute)
+			bucket, ok := r.buckets[limit.Name]
+			if !ok {
+				bucket = fakeBucket{tokens: rate, at: now}
+			}
+			left := min(rate, bucket.tokens+now.Sub(bucket.at).Minutes()*rate)
+			if left < 1 {
+				return limit.Name, time.Duration((1 - left) / rate * float64(time.Minute)), nil
+			}
+			tokens[limit.Name] = left
+		}
+	}
+	for _, limit := range limits {
+		if limit.MaxConcurrent > 0 {
+			if r.running[limit.Name] == nil {
+				r.running[limit.Name] = make(map[string]time.Time)
+			}
+			r.running[limit.Name][owner] = now.Add(ttl)
+		}
+		if left, ok := tokens[limit.Name]; ok {
+			r.buckets[limit.Name] = fakeBucket{tokens: left - 1, at: now}
+		}
+	}
+	return "", 0, nil
+}
+
+func (r *fakeRateLimitRepo) RenewSlots(ctx context.Context, limits []*domain.RateLimit, owner string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, limit := range limits {
+		if _, ok := r.running[limit.Name][owner]; ok {
+			r.running[limit.Name][owner] = time.Now().Add(ttl)
+		}
+	}
+	return nil
+}
+
+func (r *fakeRateLimitRepo) ReleaseSlots(ctx context.Context, limits []*domain.RateLimit, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, limit := range limits {
+		delete(r.running[limit.Name], owner)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package worker_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Relays the outbox every few milliseconds until the test ends
+func (tw *testWorker) startRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			_ = tw.worker.RelayOutbox(ctx)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+}
+
+// Waits until the task has a run with the status and returns it
+func (tw *testWorker) waitRun(t *testing.T, taskID string, status domain.TaskStatus) *domain.TaskRun {
+	var run *domain.TaskRun
+	require.Eventually(t, func() bool {
+		runs, _ := tw.runRepo.ListRuns(context.Background(), taskID)
+		for _, r := range runs {
+			if r.Status == status {
+				run = r
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	return run
+}
+
+func TestWorkerTriggersOnSuccessTasks(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+	tw.startRelay(t)
+
+	parent := domain.Task{ID: "extract", Name: "Extract", Command: `echo '{"rows": 3}'`, Status: domain.TaskStatusRunning,
+		OnSuccess: []string{"load"}, OnFailure: []string{"alert"}, PassOutput: true,
+		Success: &domain.SuccessCriteria{JSONResult: true}}
+	child := domain.Task{ID: "load", Name: "Load", Status: domain.TaskStatusCompleted,
+		Command: `echo "$TASK_PARENT_ID $TASK_PARENT_STATUS $TASK_PARENT_EXIT_CODE $TASK_PARENT_RESULT"`}
+	alert := domain.Task{ID: "alert", Name: "Alert", Command: "true", Status: domain.TaskStatusPending}
+	for _, task := range []*domain.Task{&parent, &child, &alert} {
+		require.NoError(t, tw.taskRepo.Create(context.Background(), task))
+	}
+
+	taskMsg := domain.NewTaskMessage("extract")
+	tw.publishTask(t, taskMsg)
+
+	parentRun := tw.waitRun(t, "extract", domain.TaskStatusCompleted)
+	childRun := tw.waitRun(t, "load", domain.TaskStatusCompleted)
+	assert.Equal(t, "extract/"+parentRun.ID, childRun.TriggeredBy)
+	assert.Equal(t, taskMsg.CorrelationID, childRun.CorrelationID)
+
+	output, err := tw.runRepo.GetOutput(context.Background(), "load", childRun.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "extract completed 0 {\"rows\": 3}\n", output.Stdout)
+
+	runs, err := tw.runRepo.ListRuns(context.Background(), "alert")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
+
+func TestWorkerTriggersOnFailureTasksWithoutOutput(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+	tw.startRelay(t)
+
+	parent := domain.Task{ID: "flaky", Name: "Flaky", Command: "echo secret-ish; exit 2", Status: domain.TaskStatusRunning,
+		OnFailure: []string{"cleanup"}}
+	child := domain.Task{ID: "cleanup", Name: "Cleanup", Status: domain.TaskStatusPending,
+		Command: `echo "$TASK_PARENT_STATUS $TASK_PARENT_EXIT_CODE [$TASK_PARENT_STDOUT]"`}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &parent))
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &child))
+
+	tw.publishTask(t, domain.NewTaskMessage("flaky"))
+
+	childRun := tw.waitRun(t, "cleanup", domain.TaskStatusCompleted)
+	output, err := tw.runRepo.GetOutput(context.Background(), "cleanup", childRun.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "failed 2 []\n", output.Stdout)
+}
+
+func TestWorkerSkipsRunningFollowUpTask(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	parent := domain.Task{ID: "first", Name: "First", Command: "true", Status: domain.TaskStatusRunning,
+		OnSuccess: []string{"busy"}}
+	child := domain.Task{ID: "busy", Name: "Busy", Command: "true", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &parent))
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &child))
+
+	tw.publishTask(t, domain.NewTaskMessage("first"))
+	tw.waitRun(t, "first", domain.TaskStatusCompleted)
+	tw.waitQueueSettled(t)
+
+	assert.Zero(t, tw.taskRepo.outboxLen())
+}
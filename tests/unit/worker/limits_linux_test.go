@@ -0,0 +1,60 @@
+//go:build linux
+
+package worker_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerAppliesLimitsBeforeTheCommandRuns(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	run := tw.runTask(t, &domain.Task{ID: "ulimit", Name: "Ulimit", Command: "ulimit -n; grep 'Max file size' /proc/self/limits",
+		Limits: &domain.ResourceLimits{OpenFiles: 64, FileSizeBytes: 1 << 20}})
+
+	assert.Equal(t, domain.TaskStatusCompleted, run.Status, run.Error)
+	output, err := tw.runRepo.GetOutput(context.Background(), "ulimit", run.ID)
+	require.NoError(t, err)
+	assert.Regexp(t, `^64\nMax file size +1048576 +1048576 +bytes`, output.Stdout)
+}
+
+func TestWorkerRecordsCPUTimeLimitHit(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	run := tw.runTask(t, &domain.Task{ID: "spin", Name: "Spin", Command: "while :; do :; done",
+		Limits: &domain.ResourceLimits{CPUTimeSeconds: 1}})
+
+	assert.Equal(t, domain.TaskStatusFailed, run.Status)
+	assert.Equal(t, domain.LimitCPUTime, run.LimitExceeded)
+}
+
+func TestWorkerRecordsFileSizeLimitHit(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	out := filepath.Join(t.TempDir(), "out")
+	run := tw.runTask(t, &domain.Task{ID: "dump", Name: "Dump", Command: "head -c 65536 /dev/zero > " + out,
+		Limits: &domain.ResourceLimits{FileSizeBytes: 4096}})
+
+	assert.Equal(t, domain.TaskStatusFailed, run.Status)
+	assert.Equal(t, domain.LimitFileSize, run.LimitExceeded)
+}
+
+func TestWorkerDoesNotBlameLimitsForTheOutput(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	run := tw.runTask(t, &domain.Task{ID: "oom", Name: "OOM", Command: `echo "out of memory: too many open files" >&2; exit 1`,
+		Limits: &domain.ResourceLimits{AddressSpaceBytes: 1 << 30, OpenFiles: 64, CPUTimeSeconds: 10}})
+
+	assert.Equal(t, domain.TaskStatusFailed, run.Status)
+	assert.Empty(t, run.LimitExceeded)
+}
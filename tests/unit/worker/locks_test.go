@@ -0,0 +1,80 @@
+package worker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withLockRetry(cfg *config.AppConfig) {
+	cfg.LockTTLSeconds = 3
+	cfg.LockRetrySeconds = 1
+}
+
+func TestWorkerNeverRunsTasksSharingALockAtOnce(t *testing.T) {
+	// a consumer per queue, so both tasks could run at once
+	tw := newTestWorker(t, withLockRetry, func(cfg *config.AppConfig) {
+		cfg.WorkerQueues = []string{messaging.DefaultTaskQueue, "reports"}
+	})
+	tw.startConsumer(t)
+
+	for _, task := range []*domain.Task{
+		{ID: "migrate", Name: "Migrate", Command: "sleep 0.5", Locks: []string{"db-main"}},
+		{ID: "vacuum", Name: "Vacuum", Command: "sleep 0.5", Locks: []string{"db-main"}, Queue: "reports"},
+	} {
+		task.Status = domain.TaskStatusRunning
+		require.NoError(t, tw.taskRepo.Create(context.Background(), task))
+		require.NoError(t, tw.broker.Publish(context.Background(), messaging.Publishing{
+			Exchange:   messaging.TasksExchange,
+			RoutingKey: messaging.TaskRoutingKey(task.Queue),
+			Body:       marshalTaskMessage(t, domain.NewTaskMessage(task.ID)),
+		}))
+	}
+
+	migrate := tw.waitRun(t, "migrate", domain.TaskStatusCompleted)
+	vacuum := tw.waitRun(t, "vacuum", domain.TaskStatusCompleted)
+	first, second := migrate, vacuum
+	if second.StartedAt.Before(first.StartedAt) {
+		first, second = second, first
+	}
+	assert.False(t, second.StartedAt.Before(first.FinishedAt), "runs overlapped")
+
+	// the deferred run kept its run ID and attempt
+	runs, err := tw.runRepo.ListRuns(context.Background(), second.TaskID)
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+	assert.Empty(t, tw.locks.holder("db-main"))
+}
+
+func TestWorkerDefersTaskWhileLockIsHeld(t *testing.T) {
+	tw := newTestWorker(t, withLockRetry)
+	tw.startConsumer(t)
+
+	_, _, err := tw.locks.AcquireLocks(context.Background(), []string{"db-main"}, "other", time.Minute)
+	require.NoError(t, err)
+
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &domain.Task{ID: "report", Name: "Report",
+		Command: "true", Status: domain.TaskStatusRunning, Locks: []string{"cache", "db-main"}}))
+	taskMsg := domain.NewTaskMessage("report")
+	tw.publishTask(t, taskMsg)
+
+	time.Sleep(1500 * time.Millisecond)
+	runs, err := tw.runRepo.ListRuns(context.Background(), "report")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+	// none of the locks is taken while another is held
+	assert.Empty(t, tw.locks.holder("cache"))
+
+	require.NoError(t, tw.locks.ReleaseLocks(context.Background(), []string{"db-main"}, "other"))
+	run := tw.waitRun(t, "report", domain.TaskStatusCompleted)
+	assert.Equal(t, taskMsg.RunID, run.ID)
+	letters, err := tw.deadLetters.ListDeadLetters(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
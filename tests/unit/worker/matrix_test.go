@@ -0,0 +1,146 @@
+package worker_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates the matrix task and publishes a message for it
+func (tw *testWorker) startMatrix(t *testing.T, task *domain.Task) {
+	task.Status = domain.TaskStatusRunning
+	require.NoError(t, tw.taskRepo.Create(context.Background(), task))
+	tw.publishTask(t, domain.NewTaskMessage(task.ID))
+}
+
+func TestWorkerRunsMatrixChildren(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+	tw.startRelay(t)
+
+	tw.startMatrix(t, &domain.Task{ID: "report", Name: "Report", Labels: map[string]string{"team": "billing"},
+		Command: `sleep 0.2; echo "$CUSTOMER $TASK_MATRIX_INDEX $TASK_PARENT_ID"`,
+		Matrix: &domain.Matrix{MaxParallel: 2, Params: []map[string]string{
+			{"CUSTOMER": "acme"}, {"CUSTOMER": "globex"}, {"CUSTOMER": "initech"}, {"CUSTOMER": "umbrella"},
+		}}})
+
+	run := tw.waitRun(t, "report", domain.TaskStatusCompleted)
+	require.NotNil(t, run.Matrix)
+	assert.Equal(t, domain.MatrixGroup{TaskID: "report", RunID: run.ID, Total: 4, Started: 4, Completed: 4},
+		*run.Matrix)
+
+	var children []*domain.TaskRun
+	for i, customer := range []string{"acme", "globex", "initech", "umbrella"} {
+		id := domain.MatrixChildID("report", i)
+		child, err := tw.taskRepo.FindById(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, "report", child.Parent)
+		assert.Equal(t, domain.TaskStatusCompleted, child.Status)
+		assert.Equal(t, "billing", child.Labels["team"])
+
+		runs, err := tw.runRepo.ListRuns(context.Background(), id)
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		assert.Equal(t, "report/"+run.ID, runs[0].TriggeredBy)
+		children = append(children, runs[0])
+
+		output, err := tw.runRepo.GetOutput(context.Background(), id, runs[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, customer+" "+string(rune('1'+i))+" report\n", output.Stdout)
+	}
+
+	// no more than max_parallel children ran at the same time
+	type change struct {
+		at    time.Time
+		delta int
+	}
+	var changes []change
+	for _, child := range children {
+		changes = append(changes, change{child.StartedAt, 1}, change{child.FinishedAt, -1})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].at.Equal(changes[j].at) {
+			return changes[i].delta < changes[j].delta
+		}
+		return changes[i].at.Before(changes[j].at)
+	})
+	running := 0
+	for _, c := range changes {
+		running += c.delta
+		assert.LessOrEqual(t, running, 2)
+	}
+
+	output, err := tw.runRepo.GetOutput(context.Background(), "report", run.ID)
+	require.NoError(t, err)
+	assert.Contains(t, output.Stdout, "Starting 4 children, 2 at once\n")
+	assert.Contains(t, output.Stdout, "4 children completed, 0 failed, 0 skipped\n")
+}
+
+func TestWorkerToleratesMatrixFailuresUpToThreshold(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+	tw.startRelay(t)
+
+	tw.startMatrix(t, &domain.Task{ID: "sync", Name: "Sync", Command: `exit $CODE`,
+		Matrix: &domain.Matrix{FailureThreshold: 1, Params: []map[string]string{
+			{"CODE": "0"}, {"CODE": "1"}, {"CODE": "0"},
+		}}})
+
+	run := tw.waitRun(t, "sync", domain.TaskStatusCompleted)
+	assert.Equal(t, 2, run.Matrix.Completed)
+	assert.Equal(t, 1, run.Matrix.Failed)
+
+	child, err := tw.taskRepo.FindById(context.Background(), "sync-2")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusFailed, child.Status)
+}
+
+func TestWorkerSkipsMatrixChildrenAfterTooManyFailures(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+	tw.startRelay(t)
+
+	tw.startMatrix(t, &domain.Task{ID: "deploy", Name: "Deploy", Command: `exit $CODE`,
+		Matrix: &domain.Matrix{MaxParallel: 1, Params: []map[string]string{
+			{"CODE": "0"}, {"CODE": "1"}, {"CODE": "0"}, {"CODE": "0"},
+		}}})
+
+	run := tw.waitRun(t, "deploy", domain.TaskStatusFailed)
+	assert.Equal(t, "1 of 4 children failed, 2 skipped", run.Error)
+	assert.Equal(t, 1, run.Matrix.Completed)
+	assert.Equal(t, 1, run.Matrix.Failed)
+	assert.Equal(t, 2, run.Matrix.Skipped)
+
+	for _, id := range []string{"deploy-3", "deploy-4"} {
+		child, err := tw.taskRepo.FindById(context.Background(), id)
+		require.NoError(t, err)
+		assert.Nil(t, child)
+	}
+
+	task, err := tw.taskRepo.FindById(context.Background(), "deploy")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusFailed, task.Status)
+}
+
+func TestWorkerFailsMatrixOverlappingOtherTask(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+	tw.startRelay(t)
+
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &domain.Task{ID: "backup-2", Name: "Backup 2",
+		Command: "true", Status: domain.TaskStatusPending}))
+	tw.startMatrix(t, &domain.Task{ID: "backup", Name: "Backup", Command: "true",
+		Matrix: &domain.Matrix{Params: []map[string]string{{"DB": "a"}, {"DB": "b"}}}})
+
+	run := tw.waitRun(t, "backup", domain.TaskStatusFailed)
+	assert.Contains(t, run.Error, "task backup-2 already exists")
+
+	runs, err := tw.runRepo.ListRuns(context.Background(), "backup-1")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
@@ -0,0 +1,74 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerNotifiesFailedRun(t *testing.T) {
+	payloads := make(chan []byte, 10)
+	signatures := make(chan string, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		payloads <- body
+		signatures <- r.Header.Get(notify.HeaderSignature)
+	}))
+	t.Cleanup(receiver.Close)
+
+	tw := newTestWorker(t)
+	require.NoError(t, tw.notifications.SaveRule(context.Background(), &domain.NotificationRule{
+		ID:     "on-failure",
+		TaskID: "broken",
+		URL:    receiver.URL,
+		Events: []domain.EventType{domain.EventRunFailed},
+		Secret: "s3cret",
+	}))
+	tw.startConsumer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, tw.worker.StartNotificationConsumer(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	task := domain.Task{ID: "broken", Name: "Broken", Command: "echo oops >&2; exit 2", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	tw.publishTask(t, domain.NewTaskMessage("broken"))
+
+	var body []byte
+	select {
+	case body = <-payloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+	}
+	assert.Equal(t, notify.Sign("s3cret", body), <-signatures)
+
+	var payload domain.NotificationPayload
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, domain.EventRunFailed, payload.Event)
+	assert.Equal(t, domain.TaskStatusFailed, payload.Status)
+	require.NotNil(t, payload.OutputTail)
+	assert.Equal(t, "oops\n", payload.OutputTail.Stderr)
+
+	// run.started and run.succeeded don't match the rule
+	select {
+	case <-payloads:
+		t.Fatal("unexpected notification")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
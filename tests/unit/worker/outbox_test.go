@@ -0,0 +1,69 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Records the task as running together with its message, as the scheduler does
+func (tw *testWorker) enqueue(t *testing.T, task *domain.Task) {
+	body, err := json.Marshal(domain.NewTaskMessage(task.ID))
+	require.NoError(t, err)
+
+	msg := domain.NewOutboxMessage(messaging.TasksExchange, messaging.TaskRoutingKey(task.Queue), body)
+	msg.Mandatory = true
+	msg.TaskID = task.ID
+
+	task.Status = domain.TaskStatusRunning
+	require.NoError(t, tw.taskRepo.UpdateWithOutbox(context.Background(), task, msg))
+}
+
+func TestOutboxRelayPublishesMessages(t *testing.T) {
+	tw := newTestWorker(t)
+
+	task := &domain.Task{ID: "relayed", Name: "Relayed", Command: "true", Status: domain.TaskStatusPending}
+	tw.enqueue(t, task)
+	require.Equal(t, 1, tw.taskRepo.outboxLen())
+
+	require.NoError(t, tw.worker.RelayOutbox(context.Background()))
+
+	ready, _ := tw.broker.Stats(messaging.TasksQueue)
+	assert.Equal(t, 1, ready)
+	assert.Zero(t, tw.taskRepo.outboxLen())
+}
+
+func TestOutboxRelayKeepsMessagesItFailsToPublish(t *testing.T) {
+	tw := newTestWorker(t)
+
+	task := &domain.Task{ID: "kept", Name: "Kept", Command: "true", Status: domain.TaskStatusPending}
+	tw.enqueue(t, task)
+
+	// the broker refuses every publish
+	require.NoError(t, tw.broker.Close())
+	require.NoError(t, tw.worker.RelayOutbox(context.Background()))
+
+	assert.Equal(t, 1, tw.taskRepo.outboxLen())
+	stored, err := tw.taskRepo.FindById(context.Background(), "kept")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusRunning, stored.Status)
+}
+
+func TestOutboxRelayRevertsTaskOfUnroutableMessage(t *testing.T) {
+	tw := newTestWorker(t)
+
+	task := &domain.Task{ID: "orphan", Name: "Orphan", Command: "true", Status: domain.TaskStatusPending, Queue: "nobody"}
+	tw.enqueue(t, task)
+
+	require.NoError(t, tw.worker.RelayOutbox(context.Background()))
+
+	assert.Zero(t, tw.taskRepo.outboxLen())
+	stored, err := tw.taskRepo.FindById(context.Background(), "orphan")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusPending, stored.Status)
+}
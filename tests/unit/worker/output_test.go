@@ -0,0 +1,81 @@
+package worker_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (tw *testWorker) storedChunks(taskID, runID string) []domain.OutputChunk {
+	tw.runRepo.mu.Lock()
+	defer tw.runRepo.mu.Unlock()
+	return append([]domain.OutputChunk(nil), tw.runRepo.output[taskID+":"+runID]...)
+}
+
+func TestWorkerRedactsSecretSplitAcrossWrites(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+	require.NoError(t, tw.secrets.Set(context.Background(), &domain.Secret{Name: "API_TOKEN", Value: "s3cr3t-token"}))
+
+	// the two halves reach the worker in different reads of the pipe
+	run := tw.runTask(t, &domain.Task{ID: "leaky", Name: "Leaky", Secrets: []string{"API_TOKEN"},
+		Command: `printf 'token=s3cr'; sleep 0.2; printf '3t-token\n'`})
+	require.Equal(t, domain.TaskStatusCompleted, run.Status)
+
+	chunks := tw.storedChunks("leaky", run.ID)
+	require.NotEmpty(t, chunks)
+	var stored strings.Builder
+	for _, chunk := range chunks {
+		assert.NotContains(t, chunk.Data, "s3cr3t")
+		stored.WriteString(chunk.Data)
+	}
+	assert.Equal(t, "token=[REDACTED]\n", stored.String())
+}
+
+func TestWorkerTruncatesOutputOverTheLimit(t *testing.T) {
+	tw := newTestWorker(t, func(cfg *config.AppConfig) {
+		cfg.OutputMaxBytes = 16
+	})
+	tw.startConsumer(t)
+
+	run := tw.runTask(t, &domain.Task{ID: "chatty", Name: "Chatty", Command: `printf '0123456789'; printf 'abcdefghij'`})
+	require.Equal(t, domain.TaskStatusCompleted, run.Status)
+	assert.True(t, run.OutputTruncated)
+
+	output, err := tw.runRepo.GetOutput(context.Background(), "chatty", run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", output.Stdout)
+}
+
+func TestWorkerReadsJSONResultPastTheOutputLimit(t *testing.T) {
+	tw := newTestWorker(t, func(cfg *config.AppConfig) {
+		cfg.OutputMaxBytes = 64
+	})
+	tw.startConsumer(t)
+
+	run := tw.runTask(t, &domain.Task{ID: "export", Name: "Export", Success: &domain.SuccessCriteria{JSONResult: true},
+		Command: `head -c 500 /dev/zero | tr '\0' x; echo; echo '{"rows": 3}'`})
+
+	assert.Equal(t, domain.TaskStatusCompleted, run.Status, run.Error)
+	assert.True(t, run.OutputTruncated)
+	assert.JSONEq(t, `{"rows": 3}`, string(run.Result))
+}
+
+func TestWorkerFindsForbiddenOutputPastTheOutputLimit(t *testing.T) {
+	tw := newTestWorker(t, func(cfg *config.AppConfig) {
+		cfg.OutputMaxBytes = 64
+	})
+	tw.startConsumer(t)
+
+	run := tw.runTask(t, &domain.Task{ID: "export", Name: "Export",
+		Success: &domain.SuccessCriteria{ForbiddenOutput: []string{"FATAL"}, RequiredOutput: []string{"^start"}},
+		Command: `echo start; head -c 500 /dev/zero | tr '\0' x; echo; echo 'FATAL: disk full'`})
+
+	assert.Equal(t, domain.TaskStatusFailed, run.Status)
+	assert.Contains(t, run.Error, domain.ErrForbiddenOutput.Error())
+}
@@ -0,0 +1,88 @@
+package worker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/scheduling"
+	"github.com/siluk00/task_scheduler/internal/worker"
+	"github.com/siluk00/task_scheduler/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerRunsOnlyTasksOfItsQueues(t *testing.T) {
+	tw := newTestWorker(t, func(cfg *config.AppConfig) {
+		cfg.WorkerQueues = []string{"reports"}
+	})
+	tw.startConsumer(t)
+
+	// published in the queue of reports by hand, as the scheduler would
+	task := domain.Task{ID: "report", Name: "Report", Command: "echo report", Status: domain.TaskStatusRunning, Queue: "reports"}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	body := marshalTaskMessage(t, domain.NewTaskMessage("report"))
+	require.NoError(t, tw.broker.Publish(context.Background(), messaging.Publishing{
+		Exchange:   messaging.TasksExchange,
+		RoutingKey: messaging.TaskRoutingKey("reports"),
+		Body:       body,
+		Mandatory:  true,
+	}))
+
+	require.Eventually(t, func() bool {
+		stored, _ := tw.taskRepo.FindById(context.Background(), "report")
+		return stored.Status == domain.TaskStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// nobody declared the default queue, so its tasks can't be published
+	err := tw.broker.Publish(context.Background(), messaging.Publishing{
+		Exchange:   messaging.TasksExchange,
+		RoutingKey: messaging.TasksRoutingKey,
+		Body:       body,
+		Mandatory:  true,
+	})
+	assert.ErrorIs(t, err, messaging.ErrUnroutable)
+}
+
+func TestWorkerRegistersAsConsumerOfItsQueues(t *testing.T) {
+	tw := newTestWorker(t, func(cfg *config.AppConfig) {
+		cfg.WorkerQueues = []string{"gpu-free", "reports"}
+		cfg.SchedulerMode = scheduling.ModeDelayed
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, tw.worker.Start(ctx))
+	}()
+
+	for _, queue := range []string{"gpu-free", "reports"} {
+		require.Eventually(t, func() bool {
+			count, _ := tw.consumers.CountConsumers(context.Background(), queue)
+			return count == 1
+		}, time.Second, 10*time.Millisecond)
+	}
+	count, err := tw.consumers.CountConsumers(context.Background(), messaging.DefaultTaskQueue)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	cancel()
+	<-done
+	tw.worker.Stop(context.Background())
+
+	count, err = tw.consumers.CountConsumers(context.Background(), "reports")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestWorkerRejectsInvalidQueueName(t *testing.T) {
+	tw := newTestWorker(t)
+	w := worker.NewTaskWorkerWithDependencies(&config.AppConfig{WorkerQueues: []string{"bad queue"}}, worker.Dependencies{
+		Broker: tw.broker,
+	})
+
+	assert.ErrorIs(t, w.SetupTopology(context.Background()), domain.ErrInvalidQueue)
+}
@@ -0,0 +1,71 @@
+package worker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerCapsConcurrentTasksWithALabel(t *testing.T) {
+	// a consumer per queue, so both tasks could run at once
+	tw := newTestWorker(t, withLockRetry, func(cfg *config.AppConfig) {
+		cfg.WorkerQueues = []string{messaging.DefaultTaskQueue, "reports"}
+	})
+	tw.startConsumer(t)
+	require.NoError(t, tw.rateLimits.SetLimit(context.Background(),
+		&domain.RateLimit{Name: "reports-api", Label: "team=reports", MaxConcurrent: 1}))
+
+	for _, task := range []*domain.Task{
+		{ID: "daily", Name: "Daily", Command: "sleep 0.5", Labels: map[string]string{"team": "reports"}},
+		{ID: "weekly", Name: "Weekly", Command: "sleep 0.5", Labels: map[string]string{"team": "reports"}, Queue: "reports"},
+	} {
+		task.Status = domain.TaskStatusRunning
+		require.NoError(t, tw.taskRepo.Create(context.Background(), task))
+		require.NoError(t, tw.broker.Publish(context.Background(), messaging.Publishing{
+			Exchange:   messaging.TasksExchange,
+			RoutingKey: messaging.TaskRoutingKey(task.Queue),
+			Body:       marshalTaskMessage(t, domain.NewTaskMessage(task.ID)),
+		}))
+	}
+
+	first := tw.waitRun(t, "daily", domain.TaskStatusCompleted)
+	second := tw.waitRun(t, "weekly", domain.TaskStatusCompleted)
+	if second.StartedAt.Before(first.StartedAt) {
+		first, second = second, first
+	}
+	assert.False(t, second.StartedAt.Before(first.FinishedAt), "runs overlapped")
+}
+
+func TestWorkerLimitsStartsPerMinuteOfAQueue(t *testing.T) {
+	tw := newTestWorker(t, withLockRetry)
+	tw.startConsumer(t)
+	require.NoError(t, tw.rateLimits.SetLimit(context.Background(),
+		&domain.RateLimit{Name: "default-api", Queue: messaging.DefaultTaskQueue, StartsPerMinute: 2}))
+	// the limits of other queues don't apply
+	require.NoError(t, tw.rateLimits.SetLimit(context.Background(),
+		&domain.RateLimit{Name: "gpu", Queue: "gpu", StartsPerMinute: 1}))
+
+	for _, id := range []string{"first", "second", "third"} {
+		require.NoError(t, tw.taskRepo.Create(context.Background(), &domain.Task{ID: id, Name: id,
+			Command: "true", Status: domain.TaskStatusRunning}))
+		tw.publishTask(t, domain.NewTaskMessage(id))
+	}
+
+	tw.waitRun(t, "first", domain.TaskStatusCompleted)
+	tw.waitRun(t, "second", domain.TaskStatusCompleted)
+
+	// the third start waits for the bucket to refill, about 30 seconds
+	time.Sleep(time.Second)
+	runs, err := tw.runRepo.ListRuns(context.Background(), "third")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+	letters, err := tw.deadLetters.ListDeadLetters(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
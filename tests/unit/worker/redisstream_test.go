@@ -0,0 +1,55 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/messaging/redisstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerDeadLettersAfterMaxAttemptsOnRedisStreams(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	broker := redisstream.NewBroker(client, time.Second)
+	t.Cleanup(func() { broker.Close() })
+
+	tw := newTestWorkerOn(t, broker)
+	tw.runRepo.createErr = errors.New("store unavailable")
+	tw.startConsumer(t)
+
+	task := domain.Task{ID: "broken", Name: "Broken", Command: "true", Status: domain.TaskStatusRunning}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+
+	require.NoError(t, broker.Publish(context.Background(), messaging.Publishing{
+		Exchange:   messaging.TasksExchange,
+		RoutingKey: messaging.TaskRoutingKey(""),
+		Body:       marshalTaskMessage(t, domain.NewTaskMessage("broken")),
+	}))
+
+	letters := tw.waitDeadLetters(t, 1)
+	assert.Equal(t, domain.DeadLetterMaxAttempts, letters[0].Reason)
+	assert.Equal(t, "broken", letters[0].TaskID)
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Contains(t, letters[0].Error, "store unavailable")
+
+	// every attempt was acked, nothing is left in the task queue or the dead letter queue
+	require.Eventually(t, func() bool {
+		for _, queue := range []string{messaging.TasksQueue, messaging.DeadLetterQueue} {
+			length, _ := client.XLen(context.Background(), "mq:queue:"+queue).Result()
+			pending, _ := client.XPending(context.Background(), "mq:queue:"+queue, "workers").Result()
+			if length != 0 || pending == nil || pending.Count != 0 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
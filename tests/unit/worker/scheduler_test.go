@@ -0,0 +1,241 @@
+package worker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/siluk00/task_scheduler/internal/messaging"
+	"github.com/siluk00/task_scheduler/internal/scheduling"
+	"github.com/siluk00/task_scheduler/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts the scheduler, the outbox relay and the consumers until the test ends
+func (tw *testWorker) startWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, tw.worker.Start(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestDelayedSchedulerRunsTaskWhenDue(t *testing.T) {
+	tw := newTestWorker(t, func(cfg *config.AppConfig) {
+		cfg.SchedulerMode = scheduling.ModeDelayed
+		cfg.SchedulerHorizonSeconds = 60
+	})
+
+	scheduledAt := time.Now().Add(1500 * time.Millisecond)
+	task := domain.Task{
+		ID:          "later",
+		Name:        "Later",
+		Command:     "echo later",
+		Status:      domain.TaskStatusPending,
+		ScheduledAt: scheduledAt,
+	}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	tw.startWorker(t)
+
+	// published ahead and waiting in the broker
+	require.Eventually(t, func() bool {
+		stored, _ := tw.taskRepo.FindById(context.Background(), "later")
+		return stored.Status == domain.TaskStatusQueued
+	}, time.Second, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		stored, _ := tw.taskRepo.FindById(context.Background(), "later")
+		return stored.Status == domain.TaskStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	runs, err := tw.runRepo.ListRuns(context.Background(), "later")
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.False(t, runs[0].StartedAt.Before(scheduledAt), "the task ran before it was due")
+}
+
+func TestPollSchedulerRunsDueTask(t *testing.T) {
+	tw := newTestWorker(t)
+
+	// due a moment ago, and a task already done that must not run again
+	due := domain.Task{ID: "due", Name: "Due", Command: "true", Status: domain.TaskStatusPending,
+		ScheduledAt: time.Now().Add(-time.Second)}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &due))
+	done := domain.Task{ID: "done", Name: "Done", Command: "true", Status: domain.TaskStatusCompleted,
+		ScheduledAt: time.Now().Add(-time.Hour)}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &done))
+	tw.startWorker(t)
+
+	tw.waitRun(t, "due", domain.TaskStatusCompleted)
+	runs, err := tw.runRepo.ListRuns(context.Background(), "done")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
+
+// A delayed scheduler passing every second
+func withFastScheduler(cfg *config.AppConfig) {
+	cfg.SchedulerMode = scheduling.ModeDelayed
+	cfg.SchedulerHorizonSeconds = 4
+}
+
+// Moves the stored task to now, as if its next occurrence came
+func (tw *testWorker) makeDue(t *testing.T, id string) {
+	stored, err := tw.taskRepo.FindById(context.Background(), id)
+	require.NoError(t, err)
+	stored.ScheduledAt = time.Now()
+	require.NoError(t, tw.taskRepo.Update(context.Background(), stored))
+}
+
+func TestWorkerSchedulesRecurringTaskAgainAfterItsRun(t *testing.T) {
+	tw := newTestWorker(t, withFastScheduler)
+
+	task := domain.Task{ID: "backup", Name: "Backup", Command: "true", Status: domain.TaskStatusPending,
+		Schedule: "0 2 * * *", Timezone: "America/Sao_Paulo"}
+	next, err := task.NextRun(time.Now())
+	require.NoError(t, err)
+	task.ScheduledAt = next
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	tw.startWorker(t)
+
+	// a run triggered by hand keeps the next occurrence
+	tw.publishTask(t, domain.NewTaskMessage("backup"))
+	tw.waitRun(t, "backup", domain.TaskStatusCompleted)
+	var stored *domain.Task
+	require.Eventually(t, func() bool {
+		stored, _ = tw.taskRepo.FindById(context.Background(), "backup")
+		return stored.Status == domain.TaskStatusPending
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, next.UTC(), stored.ScheduledAt.UTC())
+
+	// the scheduler runs the pending task again once it is due
+	tw.makeDue(t, "backup")
+	require.Eventually(t, func() bool {
+		runs, _ := tw.runRepo.ListRuns(context.Background(), "backup")
+		return len(runs) == 2 && runs[0].Status == domain.TaskStatusCompleted && runs[1].Status == domain.TaskStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stored, err = tw.taskRepo.FindById(context.Background(), "backup")
+	require.NoError(t, err)
+	assert.Equal(t, domain.TaskStatusPending, stored.Status)
+	assert.True(t, stored.ScheduledAt.After(time.Now()))
+	loc, err := domain.LoadTimezone("America/Sao_Paulo")
+	require.NoError(t, err)
+	assert.Equal(t, "02:00", stored.ScheduledAt.In(loc).Format("15:04"))
+}
+
+func TestSchedulerQueuesOccurrenceDueWhileTaskRuns(t *testing.T) {
+	tw := newTestWorker(t, withFastScheduler, withLockRetry, func(cfg *config.AppConfig) {
+		cfg.WorkerQueues = []string{messaging.DefaultTaskQueue, "reports"}
+	})
+
+	task := domain.Task{ID: "sync", Name: "Sync", Command: "sleep 2", Status: domain.TaskStatusPending,
+		Schedule: "* * * * *", ConcurrencyPolicy: domain.ConcurrencyForbid}
+	next, err := task.NextRun(time.Now())
+	require.NoError(t, err)
+	task.ScheduledAt = next
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	tw.startWorker(t)
+
+	// a run started by hand through the other queue takes longer than the task takes to be due
+	first := domain.NewTaskMessage("sync")
+	require.NoError(t, tw.broker.Publish(context.Background(), messaging.Publishing{
+		Exchange:   messaging.TasksExchange,
+		RoutingKey: messaging.TaskRoutingKey("reports"),
+		Body:       marshalTaskMessage(t, first),
+	}))
+	tw.waitRun(t, "sync", domain.TaskStatusRunning)
+	tw.makeDue(t, "sync")
+
+	// the scheduler queued the occurrence and moved on, the running one made forbid skip it
+	skipped := tw.waitRun(t, "sync", domain.TaskStatusSkipped)
+	assert.Contains(t, skipped.Error, first.RunID)
+	stored, err := tw.taskRepo.FindById(context.Background(), "sync")
+	require.NoError(t, err)
+	assert.True(t, stored.ScheduledAt.After(time.Now()))
+
+	completed := tw.waitRun(t, "sync", domain.TaskStatusCompleted)
+	assert.Equal(t, first.RunID, completed.ID)
+	require.Eventually(t, func() bool {
+		stored, _ = tw.taskRepo.FindById(context.Background(), "sync")
+		return stored.Status == domain.TaskStatusPending
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, stored.ScheduledAt.After(time.Now()), "the run set the task back to the occurrence it skipped")
+}
+
+func TestWorkerFailsRecurringTaskItCantScheduleAgain(t *testing.T) {
+	tw := newTestWorker(t, withFastScheduler)
+
+	// the zone was valid when the task was saved but the worker doesn't know it
+	task := domain.Task{ID: "backup", Name: "Backup", Command: "true", Status: domain.TaskStatusPending,
+		Schedule: "0 2 * * *", Timezone: "Mars/Olympus_Mons", ScheduledAt: time.Now()}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	tw.startWorker(t)
+
+	require.Eventually(t, func() bool {
+		stored, _ := tw.taskRepo.FindById(context.Background(), "backup")
+		return stored.Status == domain.TaskStatusFailed
+	}, 5*time.Second, 10*time.Millisecond)
+	runs, err := tw.runRepo.ListRuns(context.Background(), "backup")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
+
+func TestConsumerDropsMessageOfRescheduledTask(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	// queued for a minute from now, then moved an hour later
+	dueAt := time.Now().Add(time.Minute)
+	task := domain.Task{ID: "moved", Name: "Moved", Command: "true", Status: domain.TaskStatusPending,
+		ScheduledAt: dueAt.Add(time.Hour)}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+
+	stale := domain.NewTaskMessage("moved")
+	stale.DueAt = dueAt
+	tw.publishTask(t, stale)
+
+	require.Eventually(t, func() bool {
+		ready, unacked := tw.broker.Stats("tasks_queue")
+		return ready == 0 && unacked == 0
+	}, time.Second, 10*time.Millisecond)
+	runs, err := tw.runRepo.ListRuns(context.Background(), "moved")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+
+	// the message of the current time runs it
+	current := domain.NewTaskMessage("moved")
+	current.DueAt = task.ScheduledAt
+	tw.publishTask(t, current)
+	tw.waitRun(t, "moved", domain.TaskStatusCompleted)
+}
+
+func TestConsumerDropsOccurrenceOfRescheduledRecurringTask(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	// queued at its occurrence and moved on to the next one, then rescheduled by hand
+	stale := domain.NewTaskMessage("hourly")
+	stale.DueAt = time.Now()
+	task := domain.Task{ID: "hourly", Name: "Hourly", Command: "true", Status: domain.TaskStatusPending,
+		Schedule: "@hourly", ScheduledAt: time.Now().Add(2 * time.Hour), RescheduledAt: time.Now()}
+	require.NoError(t, tw.taskRepo.Create(context.Background(), &task))
+	tw.publishTask(t, stale)
+	tw.waitQueueSettled(t)
+
+	runs, err := tw.runRepo.ListRuns(context.Background(), "hourly")
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+
+	// an occurrence queued after that runs, although the task already moved past it
+	current := domain.NewTaskMessage("hourly")
+	current.DueAt = time.Now()
+	tw.publishTask(t, current)
+	tw.waitRun(t, "hourly", domain.TaskStatusCompleted)
+}
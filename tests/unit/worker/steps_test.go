@@ -0,0 +1,106 @@
+package worker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/siluk00/task_scheduler/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Runs the task through the consumer and returns its finished run
+func (tw *testWorker) runTask(t *testing.T, task *domain.Task) *domain.TaskRun {
+	task.Status = domain.TaskStatusRunning
+	require.NoError(t, tw.taskRepo.Create(context.Background(), task))
+	tw.publishTask(t, domain.NewTaskMessage(task.ID))
+
+	var run *domain.TaskRun
+	require.Eventually(t, func() bool {
+		runs, _ := tw.runRepo.ListRuns(context.Background(), task.ID)
+		if len(runs) == 1 && runs[0].Status.IsFinished() {
+			run = runs[0]
+			return true
+		}
+		return false
+	}, 10*time.Second, 10*time.Millisecond)
+	return run
+}
+
+func TestWorkerRunsStepsInOrder(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	run := tw.runTask(t, &domain.Task{ID: "etl", Name: "ETL", Steps: []domain.Step{
+		{Name: "extract", Command: "echo extracted > /dev/stderr; echo 1"},
+		{Command: "echo 2"},
+		{Name: "load", Command: "echo 3"},
+	}})
+
+	assert.Equal(t, domain.TaskStatusCompleted, run.Status)
+	require.Len(t, run.Steps, 3)
+	assert.Equal(t, []string{"extract", "step-2", "load"},
+		[]string{run.Steps[0].Name, run.Steps[1].Name, run.Steps[2].Name})
+	for _, step := range run.Steps {
+		assert.Equal(t, domain.StepStatusCompleted, step.Status)
+		assert.False(t, step.FinishedAt.Before(step.StartedAt))
+	}
+	assert.Equal(t, "1\n", run.Steps[0].Output.Stdout)
+	assert.Equal(t, "extracted\n", run.Steps[0].Output.Stderr)
+	assert.Equal(t, "3\n", run.Steps[2].Output.Stdout)
+
+	output, err := tw.runRepo.GetOutput(context.Background(), "etl", run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n2\n3\n", output.Stdout)
+}
+
+func TestWorkerStopsStepsAtFailure(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	run := tw.runTask(t, &domain.Task{ID: "broken", Name: "Broken", Steps: []domain.Step{
+		{Name: "prepare", Command: "true"},
+		{Name: "build", Command: "echo oops; exit 3"},
+		{Name: "deploy", Command: "echo deployed"},
+	}})
+
+	assert.Equal(t, domain.TaskStatusFailed, run.Status)
+	assert.Equal(t, 3, run.ExitCode)
+	assert.Contains(t, run.Error, "step build failed")
+	assert.Equal(t, domain.StepStatusCompleted, run.Steps[0].Status)
+	assert.Equal(t, domain.StepStatusFailed, run.Steps[1].Status)
+	assert.Equal(t, 3, run.Steps[1].ExitCode)
+	assert.Equal(t, domain.StepStatusSkipped, run.Steps[2].Status)
+	assert.Nil(t, run.Steps[2].Output)
+}
+
+func TestWorkerContinuesAfterStepAllowedToFail(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	run := tw.runTask(t, &domain.Task{ID: "lenient", Name: "Lenient", Steps: []domain.Step{
+		{Name: "cleanup", Command: "exit 1", ContinueOnError: true},
+		{Name: "work", Command: "echo done"},
+	}})
+
+	assert.Equal(t, domain.TaskStatusCompleted, run.Status)
+	assert.Equal(t, domain.StepStatusFailed, run.Steps[0].Status)
+	assert.Equal(t, 1, run.Steps[0].ExitCode)
+	assert.Equal(t, domain.StepStatusCompleted, run.Steps[1].Status)
+}
+
+func TestWorkerKillsStepAfterTimeout(t *testing.T) {
+	tw := newTestWorker(t)
+	tw.startConsumer(t)
+
+	started := time.Now()
+	run := tw.runTask(t, &domain.Task{ID: "stuck", Name: "Stuck", Steps: []domain.Step{
+		{Name: "wait", Command: "sleep 10", TimeoutSeconds: 1},
+	}})
+
+	assert.Less(t, time.Since(started), 5*time.Second)
+	assert.Equal(t, domain.TaskStatusFailed, run.Status)
+	assert.Equal(t, domain.StepStatusFailed, run.Steps[0].Status)
+	assert.Contains(t, run.Steps[0].Error, "timed out after 1s")
+}